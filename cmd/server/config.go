@@ -2,15 +2,20 @@ package main
 
 import (
 	"fmt"
+	"github.com/Farengier/smart-home/internal/mqtt"
+	"github.com/Farengier/smart-home/internal/telegram"
 	log "github.com/sirupsen/logrus"
 	"time"
 )
 
 type YamlConfig struct {
-	Log      LogConfig    `yaml:"log"`
-	Server   ServerConfig `yaml:"server"`
-	Telegram TBotConfig   `yaml:"telegram"`
-	DataBase DBConfig     `yaml:"db"`
+	Log      LogConfig      `yaml:"log"`
+	Server   ServerConfig   `yaml:"server"`
+	Telegram TBotConfig     `yaml:"telegram"`
+	DataBase DBConfig       `yaml:"db"`
+	MQTT     MQTTConfig     `yaml:"mqtt"`
+	Schedule ScheduleConfig `yaml:"scheduler"`
+	Series   SeriesConfig   `yaml:"timeseries"`
 }
 
 type LogConfig struct {
@@ -20,15 +25,30 @@ type LogConfig struct {
 
 type TBotConfig struct {
 	BotToken string `yaml:"token"`
+	Endpoint string `yaml:"api_endpoint"`
 	TimeOut  struct {
 		Sensitive string `yaml:"sensitive"`
 		Low       string `yaml:"low"`
 	} `yaml:"spam_timeout"`
+	Session struct {
+		Lifetime  string `yaml:"lifetime"`
+		Idle      string `yaml:"idle"`
+		Sensitive string `yaml:"sensitive_otp"`
+	} `yaml:"session"`
+	Mode    string `yaml:"mode"`
+	Webhook struct {
+		URL    string `yaml:"url"`
+		Path   string `yaml:"path"`
+		Secret string `yaml:"secret"`
+	} `yaml:"webhook"`
 }
 
 func (tbc TBotConfig) Token() string {
 	return tbc.BotToken
 }
+func (tbc TBotConfig) APIEndpoint() string {
+	return tbc.Endpoint
+}
 func (tbc TBotConfig) SpamFilterDurationSensitive() time.Duration {
 	d, err := time.ParseDuration(tbc.TimeOut.Sensitive)
 	if err != nil {
@@ -45,6 +65,45 @@ func (tbc TBotConfig) SpamFilterDurationLow() time.Duration {
 	}
 	return d
 }
+func (tbc TBotConfig) SessionLifetime() time.Duration {
+	d, err := time.ParseDuration(tbc.Session.Lifetime)
+	if err != nil {
+		log.Errorf("[Config] wrong tg session lifetime format: %s", err)
+		d = time.Hour * 24 * 30
+	}
+	return d
+}
+func (tbc TBotConfig) SessionIdleTimeout() time.Duration {
+	d, err := time.ParseDuration(tbc.Session.Idle)
+	if err != nil {
+		log.Errorf("[Config] wrong tg session idle timeout format: %s", err)
+		d = time.Hour * 24
+	}
+	return d
+}
+func (tbc TBotConfig) SensitiveOtpWindow() time.Duration {
+	d, err := time.ParseDuration(tbc.Session.Sensitive)
+	if err != nil {
+		log.Errorf("[Config] wrong tg sensitive otp window format: %s", err)
+		d = time.Minute * 5
+	}
+	return d
+}
+func (tbc TBotConfig) UpdatesMode() string {
+	if tbc.Mode == "" {
+		return telegram.ModePolling
+	}
+	return tbc.Mode
+}
+func (tbc TBotConfig) WebhookURL() string {
+	return tbc.Webhook.URL
+}
+func (tbc TBotConfig) WebhookPath() string {
+	return tbc.Webhook.Path
+}
+func (tbc TBotConfig) WebhookSecret() string {
+	return tbc.Webhook.Secret
+}
 
 type ServerConfig struct {
 	Listen  string `yaml:"listen"`
@@ -90,3 +149,141 @@ func (dbc DBConfig) SyncInterval() time.Duration {
 func (dbc DBConfig) Backups() int {
 	return dbc.BackupCnt
 }
+
+type MQTTConfig struct {
+	BrokerURL string             `yaml:"broker"`
+	Client    string             `yaml:"client_id"`
+	User      string             `yaml:"username"`
+	Pass      string             `yaml:"password"`
+	Devices   []MQTTDeviceConfig `yaml:"devices"`
+	Z2M       struct {
+		Enabled   bool   `yaml:"enabled"`
+		BaseTopic string `yaml:"base_topic"`
+	} `yaml:"zigbee2mqtt"`
+	Discovery struct {
+		Enabled bool                `yaml:"enabled"`
+		Prefix  string              `yaml:"prefix"`
+		Virtual []MQTTVirtualConfig `yaml:"virtual"`
+	} `yaml:"discovery"`
+}
+
+type MQTTVirtualConfig struct {
+	ID        string `yaml:"id"`
+	Name      string `yaml:"name"`
+	Component string `yaml:"component"`
+}
+
+type MQTTDeviceConfig struct {
+	ID           string `yaml:"id"`
+	Name         string `yaml:"name"`
+	StateTopic   string `yaml:"state_topic"`
+	CommandTopic string `yaml:"command_topic"`
+	Property     string `yaml:"property"`
+	Unit         string `yaml:"unit"`
+	Format       string `yaml:"format"`
+	PayloadOn    string `yaml:"payload_on"`
+	PayloadOff   string `yaml:"payload_off"`
+}
+
+func (mc MQTTConfig) Enabled() bool {
+	return mc.BrokerURL != ""
+}
+func (mc MQTTConfig) Broker() string {
+	return mc.BrokerURL
+}
+func (mc MQTTConfig) ClientID() string {
+	if mc.Client == "" {
+		return "zy-smart-home"
+	}
+	return mc.Client
+}
+func (mc MQTTConfig) Username() string {
+	return mc.User
+}
+func (mc MQTTConfig) Password() string {
+	return mc.Pass
+}
+func (mc MQTTConfig) Zigbee2MQTTEnabled() bool {
+	return mc.Z2M.Enabled
+}
+func (mc MQTTConfig) Zigbee2MQTTBaseTopic() string {
+	if mc.Z2M.BaseTopic == "" {
+		return "zigbee2mqtt"
+	}
+	return mc.Z2M.BaseTopic
+}
+func (mc MQTTConfig) DiscoveryEnabled() bool {
+	return mc.Discovery.Enabled
+}
+func (mc MQTTConfig) DiscoveryPrefix() string {
+	if mc.Discovery.Prefix == "" {
+		return "homeassistant"
+	}
+	return mc.Discovery.Prefix
+}
+func (mc MQTTConfig) VirtualDevices() []mqtt.VirtualDevice {
+	res := make([]mqtt.VirtualDevice, 0, len(mc.Discovery.Virtual))
+	for _, v := range mc.Discovery.Virtual {
+		res = append(res, mqtt.VirtualDevice{
+			ID:        v.ID,
+			Name:      v.Name,
+			Component: v.Component,
+		})
+	}
+	return res
+}
+func (mc MQTTConfig) Bindings() []mqtt.Binding {
+	res := make([]mqtt.Binding, 0, len(mc.Devices))
+	for _, d := range mc.Devices {
+		res = append(res, mqtt.Binding{
+			ID:           d.ID,
+			Name:         d.Name,
+			StateTopic:   d.StateTopic,
+			CommandTopic: d.CommandTopic,
+			Property:     d.Property,
+			Unit:         d.Unit,
+			Format:       d.Format,
+			PayloadOn:    d.PayloadOn,
+			PayloadOff:   d.PayloadOff,
+		})
+	}
+	return res
+}
+
+type ScheduleConfig struct {
+	Lat float64 `yaml:"latitude"`
+	Lon float64 `yaml:"longitude"`
+}
+
+func (sc ScheduleConfig) Latitude() float64 {
+	return sc.Lat
+}
+func (sc ScheduleConfig) Longitude() float64 {
+	return sc.Lon
+}
+
+type SeriesConfig struct {
+	Raw     string            `yaml:"raw"`
+	Rollups map[string]string `yaml:"rollups"`
+}
+
+func (tc SeriesConfig) RawRetention() time.Duration {
+	d, err := time.ParseDuration(tc.Raw)
+	if err != nil {
+		log.Errorf("[Config] wrong timeseries raw retention format: %s", err)
+		d = time.Hour * 24 * 7
+	}
+	return d
+}
+func (tc SeriesConfig) Retention(res string) time.Duration {
+	s, ok := tc.Rollups[res]
+	if !ok || s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Errorf("[Config] wrong timeseries %s retention format: %s", res, err)
+		return 0
+	}
+	return d
+}
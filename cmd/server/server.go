@@ -9,9 +9,17 @@ import (
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 
+	"github.com/Farengier/smart-home/internal/alert"
+	"github.com/Farengier/smart-home/internal/automation"
 	"github.com/Farengier/smart-home/internal/db"
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/mqtt"
+	"github.com/Farengier/smart-home/internal/reqid"
+	"github.com/Farengier/smart-home/internal/scene"
+	"github.com/Farengier/smart-home/internal/scheduler"
 	"github.com/Farengier/smart-home/internal/signal"
 	"github.com/Farengier/smart-home/internal/telegram"
+	"github.com/Farengier/smart-home/internal/timeseries"
 	"github.com/Farengier/smart-home/internal/web"
 )
 
@@ -44,11 +52,60 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	devices := device.NewRegistry()
+	device.Persist(devices, dbc.GORM())
+	timeseries.Start(cfg.Series, dbc.GORM())
 
-	web.Start(cfg.Server)
-	err = telegram.StartBot(cfg.Telegram, dbc)
+	if cfg.MQTT.Enabled() {
+		mq, err := mqtt.Connect(cfg.MQTT)
+		if err != nil {
+			panic(err)
+		}
+		err = mqtt.Bind(mq, devices, cfg.MQTT.Bindings())
+		if err != nil {
+			panic(err)
+		}
+		if cfg.MQTT.Zigbee2MQTTEnabled() {
+			err = mqtt.Zigbee2MQTT(mq, devices, dbc.GORM(), cfg.MQTT.Zigbee2MQTTBaseTopic())
+			if err != nil {
+				panic(err)
+			}
+		}
+		if cfg.MQTT.DiscoveryEnabled() {
+			err = mqtt.HomeAssistant(mq, devices, dbc.GORM(), cfg.MQTT.DiscoveryPrefix(), cfg.MQTT.ClientID(), cfg.MQTT.VirtualDevices())
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	rules, err := automation.New(dbc.GORM(), devices)
+	if err != nil {
+		panic(err)
+	}
+	jobs, err := scheduler.New(cfg.Schedule, dbc.GORM(), rules)
+	if err != nil {
+		panic(err)
+	}
+	alerts, err := alert.New(dbc.GORM(), devices)
+	if err != nil {
+		panic(err)
+	}
+
+	srv := web.New(cfg.Server)
+	bot, err := telegram.StartBot(cfg.Telegram, dbc, telegram.Services{
+		Devices:    devices,
+		Automation: rules,
+		Scheduler:  jobs,
+		Scenes:     scene.New(dbc.GORM(), devices),
+		Alerts:     alerts,
+	}, srv.Router())
+	srv.Start()
 	if err != nil {
 		signal.Shutdown()
+	} else {
+		rules.Start(bot)
+		alerts.Start(bot)
 	}
 	signal.Wait()
 	log.Info("[Server] Closing")
@@ -94,5 +151,6 @@ func initLogging(cfg LogConfig) error {
 
 	log.SetOutput(w)
 	log.SetLevel(lvl)
+	log.AddHook(reqid.Hook{})
 	return nil
 }
@@ -0,0 +1,148 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/orm"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+	RoleGuest = "guest"
+)
+
+const (
+	LevelRead    = "read"
+	LevelControl = "control"
+)
+
+var roleRank = map[string]int{
+	RoleGuest: 1,
+	RoleUser:  2,
+	RoleAdmin: 3,
+}
+
+var levelRank = map[string]int{
+	LevelRead:    1,
+	LevelControl: 2,
+}
+
+var ErrUnknownLevel = errors.New("unknown access level")
+
+// RoleAllows проверяет, что роль не ниже требуемой. Пустое требование выполняется всегда
+func RoleAllows(role string, required string) bool {
+	if required == "" {
+		return true
+	}
+	return roleRank[role] >= roleRank[required]
+}
+
+func IsRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+type checker struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *checker {
+	return &checker{db: db}
+}
+
+// CanRead пользователи и админы видят все устройства, гости только выданные им
+func (c *checker) CanRead(userID uint, role string, deviceID string) bool {
+	return c.allowed(userID, role, deviceID, LevelRead)
+}
+
+func (c *checker) CanControl(userID uint, role string, deviceID string) bool {
+	return c.allowed(userID, role, deviceID, LevelControl)
+}
+
+func (c *checker) allowed(userID uint, role string, deviceID string, level string) bool {
+	if RoleAllows(role, RoleUser) {
+		return true
+	}
+	if !RoleAllows(role, RoleGuest) {
+		return false
+	}
+
+	var grants []orm.Grant
+	res := c.db.
+		Where("user_id = ? AND device_id = ?", userID, deviceID).
+		Or("user_id = ? AND room_id IN (?)", userID, c.db.Model(&orm.Device{}).Select("room_id").Where("uid = ?", deviceID)).
+		Find(&grants)
+	if res.Error != nil {
+		log.Errorf("[Access] grants of user %d failed: %s", userID, res.Error)
+		return false
+	}
+
+	for _, g := range grants {
+		if levelRank[g.Level] >= levelRank[level] {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantDevice выдаёт доступ к устройству, повторная выдача меняет уровень
+func (c *checker) GrantDevice(userID uint, deviceID string, level string) error {
+	if _, ok := levelRank[level]; !ok {
+		return ErrUnknownLevel
+	}
+	res := c.db.Where(orm.Grant{UserID: userID, DeviceID: deviceID}).
+		Assign(orm.Grant{Level: level}).
+		FirstOrCreate(&orm.Grant{})
+	return res.Error
+}
+
+// GrantRoom выдаёт доступ ко всем устройствам комнаты
+func (c *checker) GrantRoom(userID uint, room string, level string) error {
+	if _, ok := levelRank[level]; !ok {
+		return ErrUnknownLevel
+	}
+	rec := &orm.Room{}
+	res := c.db.Where("name = ?", room).Limit(1).Find(rec)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("room %s not found", room)
+	}
+	res = c.db.Where(orm.Grant{UserID: userID, RoomID: &rec.ID}).
+		Assign(orm.Grant{Level: level}).
+		FirstOrCreate(&orm.Grant{})
+	return res.Error
+}
+
+// Revoke удаляет все выдачи пользователю на устройство или комнату с именем target
+func (c *checker) Revoke(userID uint, target string) (int64, error) {
+	res := c.db.Unscoped().
+		Where("user_id = ? AND device_id = ?", userID, target).
+		Or("user_id = ? AND room_id IN (?)", userID, c.db.Model(&orm.Room{}).Select("id").Where("name = ?", target)).
+		Delete(&orm.Grant{})
+	return res.RowsAffected, res.Error
+}
+
+// AssignRoom переносит устройство в комнату, создавая её при необходимости
+func (c *checker) AssignRoom(deviceID string, room string) error {
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		rec := &orm.Room{}
+		err := tx.Where(orm.Room{Name: room}).FirstOrCreate(rec).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&orm.Device{}).Where("uid = ?", deviceID).Update("room_id", rec.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("device %s not found", deviceID)
+		}
+		return nil
+	})
+}
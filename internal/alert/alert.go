@@ -0,0 +1,287 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/signal"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const checkInterval = time.Second * 30
+const eventsChanBufferLen = 64
+
+var ErrAlertNotFound = errors.New("alert not found")
+
+type Notifier interface {
+	Notify(chatID int64, msg string)
+}
+
+type alert struct {
+	orm.Alert
+	threshold device.Value
+}
+
+type alerts struct {
+	db       *gorm.DB
+	devices  *device.Registry
+	notifier Notifier
+	list     []*alert
+	events   chan device.Event
+	mtx      sync.Mutex
+}
+
+func New(db *gorm.DB, devices *device.Registry) (*alerts, error) {
+	a := &alerts{
+		db:      db,
+		devices: devices,
+		events:  make(chan device.Event, eventsChanBufferLen),
+	}
+	err := a.load(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("loading alerts failed: %w", err)
+	}
+	return a, nil
+}
+
+func (a *alerts) Start(n Notifier) {
+	a.notifier = n
+	a.devices.Subscribe(func(ev device.Event) {
+		if ev.Type != device.EventValues {
+			return
+		}
+		select {
+		case a.events <- ev:
+		default:
+			log.Errorf("[Alert] events queue is full, dropping event for %s", ev.Device.ID())
+		}
+	})
+
+	ctx, cncl := context.WithCancel(context.Background())
+	signal.OnShutdown(func() error {
+		log.Info("[Alert] Shutdown alerts")
+		cncl()
+		return nil
+	})
+	signal.Run(func() { a.run(ctx) })
+}
+
+func (a *alerts) run(ctx context.Context) {
+	log.Info("[Alert] running alerts checker")
+
+	t := time.NewTicker(checkInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-a.events:
+			a.onValues(ev, time.Now())
+		case now := <-t.C:
+			a.check(now)
+		}
+	}
+}
+
+func (a *alerts) onValues(ev device.Event, now time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for _, al := range a.list {
+		if al.DeviceID != ev.Device.ID() {
+			continue
+		}
+		v, ok := ev.Values[al.Property]
+		if !ok {
+			continue
+		}
+
+		cond, err := device.Compare(v, al.Op, al.threshold)
+		if err != nil {
+			log.Errorf("[Alert] alert %d: %s", al.ID, err)
+			continue
+		}
+
+		switch {
+		case cond && al.Since.IsZero():
+			al.Since = now
+			a.save(al)
+		// гистерезис держит только уже сработавший алерт, ожидание For сбрасывается сразу
+		case !cond && !al.Since.IsZero() && (!al.Active || al.cleared(v)):
+			if al.Active {
+				a.notify(al, fmt.Sprintf("✅ Resolved: %s, now %s", al.describe(a.devices), v))
+			}
+			al.Since = time.Time{}
+			al.Active = false
+			a.save(al)
+		}
+	}
+	a.fire(now)
+}
+
+func (a *alerts) check(now time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.fire(now)
+}
+
+// fire уведомляет о сработавших и всё ещё активных алертах
+func (a *alerts) fire(now time.Time) {
+	for _, al := range a.list {
+		if al.Since.IsZero() {
+			continue
+		}
+
+		switch {
+		case !al.Active && now.Sub(al.Since) >= al.For:
+			al.Active = true
+			a.notify(al, fmt.Sprintf("⚠️ Alert: %s, now %s", al.describe(a.devices), a.current(al)))
+		case al.Active && al.Renotify > 0 && now.Sub(al.LastNotified) >= al.Renotify:
+			a.notify(al, fmt.Sprintf("⚠️ Still active since %s: %s, now %s", al.Since.Format(time.DateTime), al.describe(a.devices), a.current(al)))
+		default:
+			continue
+		}
+		al.LastNotified = now
+		a.save(al)
+	}
+}
+
+// cleared проверяет, что значение ушло от порога дальше гистерезиса
+func (al *alert) cleared(v device.Value) bool {
+	if al.Hysteresis == 0 || v.Type != device.TypeFloat || al.threshold.Type != device.TypeFloat {
+		return true
+	}
+	switch al.Op {
+	case ">", ">=":
+		return v.Num < al.threshold.Num-al.Hysteresis
+	case "<", "<=":
+		return v.Num > al.threshold.Num+al.Hysteresis
+	}
+	return true
+}
+
+func (al *alert) describe(devices *device.Registry) string {
+	name := al.DeviceID
+	if d, ok := devices.Device(al.DeviceID); ok {
+		name = d.Name()
+	}
+	s := fmt.Sprintf("%s %s %s %s", name, al.Property, al.Op, al.threshold)
+	if al.For > 0 {
+		s += " for " + al.For.String()
+	}
+	return s
+}
+
+func (a *alerts) current(al *alert) string {
+	v, ok := a.devices.Values(al.DeviceID)[al.Property]
+	if !ok {
+		return "unknown"
+	}
+	return v.String()
+}
+
+func (a *alerts) notify(al *alert, msg string) {
+	if a.notifier == nil {
+		log.Warnf("[Alert] alert %d: notifier is not set, message dropped: %s", al.ID, msg)
+		return
+	}
+	a.notifier.Notify(al.ChatID, msg)
+}
+
+func (a *alerts) save(al *alert) {
+	res := a.db.Model(&orm.Alert{}).Where("id = ?", al.ID).Updates(map[string]any{
+		"since":         al.Since,
+		"active":        al.Active,
+		"last_notified": al.LastNotified,
+	})
+	if res.Error != nil {
+		log.Errorf("[Alert] alert %d: saving state failed: %s", al.ID, res.Error)
+	}
+}
+
+func (a *alerts) load(ctx context.Context) error {
+	var recs []orm.Alert
+	res := a.db.WithContext(ctx).Order("id").Find(&recs)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	list := make([]*alert, 0, len(recs))
+	for _, rec := range recs {
+		th, err := parseThreshold(rec.Threshold)
+		if err != nil {
+			log.Errorf("[Alert] alert %d is broken, skipped: %s", rec.ID, err)
+			continue
+		}
+		list = append(list, &alert{Alert: rec, threshold: th})
+	}
+
+	a.mtx.Lock()
+	a.list = list
+	a.mtx.Unlock()
+	log.Infof("[Alert] %d alerts loaded", len(list))
+	return nil
+}
+
+func parseThreshold(s string) (device.Value, error) {
+	var raw any
+	err := json.Unmarshal([]byte(s), &raw)
+	if err != nil {
+		// строки можно писать без кавычек
+		raw = s
+	}
+	return device.FromRaw(raw)
+}
+
+// Reload перечитывает алерты после изменений в базе в обход сервиса
+func (a *alerts) Reload(ctx context.Context) error {
+	return a.load(ctx)
+}
+
+// Alerts возвращает алерты чата
+func (a *alerts) Alerts(ctx context.Context, chatID int64) ([]orm.Alert, error) {
+	var recs []orm.Alert
+	res := a.db.WithContext(ctx).Where("chat_id = ?", chatID).Order("id").Find(&recs)
+	return recs, res.Error
+}
+
+func (a *alerts) Add(ctx context.Context, rec orm.Alert) (*orm.Alert, error) {
+	th, err := parseThreshold(rec.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	_, err = device.Compare(th, rec.Op, th)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Hysteresis < 0 || rec.For < 0 || rec.Renotify < 0 {
+		return nil, fmt.Errorf("durations and hysteresis must not be negative")
+	}
+
+	rec.Since = time.Time{}
+	rec.Active = false
+	res := a.db.WithContext(ctx).Create(&rec)
+	if res.Error != nil {
+		return nil, fmt.Errorf("saving alert failed: %w", res.Error)
+	}
+	return &rec, a.load(ctx)
+}
+
+func (a *alerts) Remove(ctx context.Context, chatID int64, id uint) error {
+	res := a.db.WithContext(ctx).Unscoped().Where("id = ? AND chat_id = ?", id, chatID).Delete(&orm.Alert{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAlertNotFound
+	}
+	return a.load(ctx)
+}
@@ -0,0 +1,182 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testSensor struct{}
+
+func (testSensor) ID() string   { return "t" }
+func (testSensor) Name() string { return "Bedroom" }
+
+type testNotifier struct {
+	sent []string
+}
+
+// Notify запоминает только вид сообщения
+func (n *testNotifier) Notify(chatID int64, msg string) {
+	switch {
+	case strings.HasPrefix(msg, "⚠️ Alert"):
+		n.sent = append(n.sent, "alert")
+	case strings.HasPrefix(msg, "⚠️ Still"):
+		n.sent = append(n.sent, "still")
+	case strings.HasPrefix(msg, "✅ Resolved"):
+		n.sent = append(n.sent, "resolved")
+	default:
+		n.sent = append(n.sent, msg)
+	}
+}
+
+func testAlerts(t *testing.T) (*alerts, *testNotifier) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&orm.Alert{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	a, err := New(db, device.NewRegistry())
+	if err != nil {
+		t.Fatalf("new alerts: %s", err)
+	}
+	n := &testNotifier{}
+	a.notifier = n
+	return a, n
+}
+
+// step значение датчика через at после начала или, если value пустое, только проверка по таймеру
+type step struct {
+	at    time.Duration
+	value string
+}
+
+func TestHysteresis(t *testing.T) {
+	base := time.Date(2023, 6, 5, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name  string
+		alert orm.Alert
+		steps []step
+		want  []string
+	}{
+		{
+			name:  "fires and resolves without hysteresis",
+			alert: orm.Alert{Op: ">", Threshold: "27"},
+			steps: []step{{0, "27.5"}, {time.Minute, "26.9"}},
+			want:  []string{"alert", "resolved"},
+		},
+		{
+			name:  "active alert holds inside hysteresis band",
+			alert: orm.Alert{Op: ">", Threshold: "27", Hysteresis: 0.5},
+			steps: []step{{0, "27.5"}, {time.Minute, "26.8"}, {2 * time.Minute, "27.2"}, {3 * time.Minute, "26.4"}},
+			want:  []string{"alert", "resolved"},
+		},
+		{
+			name:  "below threshold alert holds inside hysteresis band",
+			alert: orm.Alert{Op: "<", Threshold: "18", Hysteresis: 1},
+			steps: []step{{0, "17"}, {time.Minute, "18.5"}, {2 * time.Minute, "19.5"}},
+			want:  []string{"alert", "resolved"},
+		},
+		{
+			name:  "pending alert resets as soon as condition is false",
+			alert: orm.Alert{Op: ">", Threshold: "27", Hysteresis: 0.5, For: 5 * time.Minute},
+			steps: []step{{0, "27.5"}, {4 * time.Minute, "26.8"}, {5 * time.Minute, ""}, {6 * time.Minute, "27.1"}, {10 * time.Minute, ""}},
+			want:  nil,
+		},
+		{
+			name:  "fires after for",
+			alert: orm.Alert{Op: ">", Threshold: "27", For: 5 * time.Minute},
+			steps: []step{{0, "27.5"}, {4 * time.Minute, "27.6"}, {5 * time.Minute, ""}, {6 * time.Minute, ""}},
+			want:  []string{"alert"},
+		},
+		{
+			name:  "renotifies while active",
+			alert: orm.Alert{Op: ">", Threshold: "27", Hysteresis: 0.5, Renotify: 10 * time.Minute},
+			steps: []step{{0, "28"}, {5 * time.Minute, "26.9"}, {10 * time.Minute, ""}, {15 * time.Minute, ""}, {20 * time.Minute, "26"}},
+			want:  []string{"alert", "still", "resolved"},
+		},
+		{
+			name:  "boolean condition ignores hysteresis",
+			alert: orm.Alert{Op: "==", Threshold: "false", Hysteresis: 1},
+			steps: []step{{0, "false"}, {time.Minute, "true"}},
+			want:  []string{"alert", "resolved"},
+		},
+	}
+	for _, c := range cases {
+		a, n := testAlerts(t)
+		c.alert.ChatID = 7
+		c.alert.DeviceID = "t"
+		c.alert.Property = "temperature"
+		if _, err := a.Add(context.Background(), c.alert); err != nil {
+			t.Fatalf("%s: add: %s", c.name, err)
+		}
+
+		for _, st := range c.steps {
+			now := base.Add(st.at)
+			if st.value == "" {
+				a.check(now)
+				continue
+			}
+			ev := device.Event{
+				Type:   device.EventValues,
+				Device: testSensor{},
+				Values: device.Values{"temperature": device.Parse(st.value, "")},
+			}
+			a.onValues(ev, now)
+		}
+		if strings.Join(n.sent, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: notifications %v, want %v", c.name, n.sent, c.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	a, _ := testAlerts(t)
+	cases := []struct {
+		alert orm.Alert
+		ok    bool
+	}{
+		{orm.Alert{Op: ">", Threshold: "27"}, true},
+		{orm.Alert{Op: "==", Threshold: "ON"}, true},
+		{orm.Alert{Op: ">", Threshold: "false"}, false},
+		{orm.Alert{Op: "=~", Threshold: "1"}, false},
+		{orm.Alert{Op: ">", Threshold: "1", Hysteresis: -1}, false},
+		{orm.Alert{Op: ">", Threshold: "1", For: -time.Second}, false},
+	}
+	for _, c := range cases {
+		_, err := a.Add(context.Background(), c.alert)
+		if (err == nil) != c.ok {
+			t.Errorf("%+v: error %v, want ok %v", c.alert, err, c.ok)
+		}
+	}
+}
+
+// TestCancelledContext запросы идут в контексте команды и прерываются вместе с ней
+func TestCancelledContext(t *testing.T) {
+	a, _ := testAlerts(t)
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+
+	calls := map[string]func() error{
+		"alerts": func() error { _, err := a.Alerts(ctx, 7); return err },
+		"add":    func() error { _, err := a.Add(ctx, orm.Alert{Op: ">", Threshold: "1"}); return err },
+		"remove": func() error { return a.Remove(ctx, 7, 1) },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: error %v, want %v", name, err, context.Canceled)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/signal"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const eventsChanBufferLen = 64
+
+var ErrRuleNotFound = errors.New("rule not found")
+
+type Notifier interface {
+	Notify(chatID int64, msg string)
+}
+
+type rule struct {
+	orm.Rule
+	spec *Spec
+	// matched последнее вычисленное состояние для state-триггера
+	matched bool
+}
+
+type engine struct {
+	db       *gorm.DB
+	devices  *device.Registry
+	notifier Notifier
+	rules    []*rule
+	events   chan device.Event
+	mtx      sync.Mutex
+}
+
+func New(db *gorm.DB, devices *device.Registry) (*engine, error) {
+	e := &engine{
+		db:      db,
+		devices: devices,
+		events:  make(chan device.Event, eventsChanBufferLen),
+	}
+
+	err := e.load(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("loading rules failed: %w", err)
+	}
+	return e, nil
+}
+
+// Start запускает обработку правил. Уведомления уходят через n
+func (e *engine) Start(n Notifier) {
+	// RunActions из планировщика может выполняться уже сейчас
+	e.mtx.Lock()
+	e.notifier = n
+	e.mtx.Unlock()
+
+	e.devices.Subscribe(func(ev device.Event) {
+		if ev.Type != device.EventValues {
+			return
+		}
+		select {
+		case e.events <- ev:
+		default:
+			log.Errorf("[Automation] events queue is full, dropping event for %s", ev.Device.ID())
+		}
+	})
+
+	ctx, cncl := context.WithCancel(context.Background())
+	signal.OnShutdown(func() error {
+		log.Info("[Automation] Shutdown rules engine")
+		cncl()
+		return nil
+	})
+	signal.Run(func() { e.run(ctx) })
+}
+
+func (e *engine) run(ctx context.Context) {
+	log.Info("[Automation] running rules engine")
+
+	// тикаем в начале каждой минуты, чтобы время срабатывания не уплывало
+	timer := time.NewTimer(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-e.events:
+			e.onValues(ev)
+		case now := <-timer.C:
+			e.onTime(now)
+			timer.Reset(time.Until(now.Truncate(time.Minute).Add(time.Minute)))
+		}
+	}
+}
+
+func (e *engine) onValues(ev device.Event) {
+	e.mtx.Lock()
+	var fired []*rule
+	for _, r := range e.rules {
+		t := r.spec.Trigger
+		if !r.Enabled || t.Device != ev.Device.ID() {
+			continue
+		}
+
+		switch t.Type {
+		case TriggerValue:
+			v, ok := ev.Values[t.Property]
+			if t.Property != "" && !ok {
+				continue
+			}
+			if t.Op != "" && !e.match(r, v, t.Op, t.Value) {
+				continue
+			}
+		case TriggerState:
+			v, ok := ev.Values[t.Property]
+			if !ok {
+				continue
+			}
+			was := r.matched
+			r.matched = e.match(r, v, t.Op, t.Value)
+			if was || !r.matched {
+				continue
+			}
+		default:
+			continue
+		}
+
+		fired = append(fired, r)
+	}
+	e.mtx.Unlock()
+
+	// действия выполняются без блокировки: SetState ходит в брокер и может надолго задержать остальные правила
+	for _, r := range fired {
+		e.fire(r)
+	}
+}
+
+func (e *engine) onTime(now time.Time) {
+	e.mtx.Lock()
+	var fired []*rule
+	m := now.Hour()*60 + now.Minute()
+	for _, r := range e.rules {
+		if r.Enabled && r.spec.Trigger.Type == TriggerTime && clock(r.spec.Trigger.At) == m {
+			fired = append(fired, r)
+		}
+	}
+	e.mtx.Unlock()
+
+	for _, r := range fired {
+		e.fire(r)
+	}
+}
+
+func (e *engine) match(r *rule, v device.Value, op string, raw any) bool {
+	target, _ := device.FromRaw(raw)
+	ok, err := device.Compare(v, op, target)
+	if err != nil {
+		log.Errorf("[Automation] rule %s: %s", r.Name, err)
+		return false
+	}
+	return ok
+}
+
+// fire проверяет условия и выполняет действия правила. Вызывается без e.mtx
+func (e *engine) fire(r *rule) {
+	if !e.conditions(r) {
+		log.Debugf("[Automation] rule %s triggered, conditions not met", r.Name)
+		return
+	}
+
+	log.Infof("[Automation] rule %s fired", r.Name)
+	for _, err := range e.RunActions(r.spec.Actions, r.ChatID) {
+		log.Errorf("[Automation] rule %s: %s", r.Name, err)
+	}
+}
+
+func (e *engine) conditions(r *rule) bool {
+	now := time.Now()
+	m := now.Hour()*60 + now.Minute()
+
+	for _, c := range r.spec.Conditions {
+		switch c.Type {
+		case ConditionValue:
+			v, ok := e.devices.Values(c.Device)[c.Property]
+			if !ok || !e.match(r, v, c.Op, c.Value) {
+				return false
+			}
+		case ConditionTime:
+			after, before := clock(c.After), clock(c.Before)
+			in := m >= after && m < before
+			if after > before {
+				// интервал через полночь
+				in = m >= after || m < before
+			}
+			if !in {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RunActions выполняет действия по очереди и возвращает ошибки неудавшихся. Нельзя вызывать под e.mtx
+func (e *engine) RunActions(actions []Action, chatID int64) []error {
+	var errs []error
+	for i, a := range actions {
+		err := e.runAction(a, chatID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("action %d (%s): %w", i, a.Type, err))
+		}
+	}
+	return errs
+}
+
+func (e *engine) runAction(a Action, chatID int64) error {
+	switch a.Type {
+	case ActionSet:
+		act, ok := e.devices.Actuator(a.Device)
+		if !ok {
+			return fmt.Errorf("actuator %s not found", a.Device)
+		}
+		v, err := device.FromRaw(a.Value)
+		if err != nil {
+			return err
+		}
+		return act.SetState(device.Values{a.Property: v})
+	case ActionNotify:
+		if a.Chat != 0 {
+			chatID = a.Chat
+		}
+		if chatID == 0 {
+			return fmt.Errorf("no chat to notify")
+		}
+		e.mtx.Lock()
+		n := e.notifier
+		e.mtx.Unlock()
+		if n == nil {
+			return fmt.Errorf("notifier is not set")
+		}
+		n.Notify(chatID, a.Text)
+		return nil
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+}
+
+func (e *engine) load(ctx context.Context) error {
+	var recs []orm.Rule
+	res := e.db.WithContext(ctx).Order("name").Find(&recs)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	rules := make([]*rule, 0, len(recs))
+	for _, rec := range recs {
+		spec, err := ParseSpec(rec.Spec)
+		if err != nil {
+			log.Errorf("[Automation] rule %s is broken, skipped: %s", rec.Name, err)
+			continue
+		}
+		rules = append(rules, &rule{Rule: rec, spec: spec})
+	}
+
+	e.mtx.Lock()
+	// иначе после любого изменения списка state-правила сработают повторно на текущее состояние
+	prev := make(map[uint]*rule, len(e.rules))
+	for _, r := range e.rules {
+		prev[r.ID] = r
+	}
+	for _, r := range rules {
+		if old, ok := prev[r.ID]; ok && old.Enabled && r.Enabled && old.Spec == r.Spec {
+			r.matched = old.matched
+		}
+	}
+	e.rules = rules
+	e.mtx.Unlock()
+	log.Infof("[Automation] %d rules loaded", len(rules))
+	return nil
+}
+
+// Reload перечитывает правила после изменений в базе в обход движка
+func (e *engine) Reload(ctx context.Context) error {
+	return e.load(ctx)
+}
+
+func (e *engine) Rules(ctx context.Context) ([]orm.Rule, error) {
+	var recs []orm.Rule
+	res := e.db.WithContext(ctx).Order("name").Find(&recs)
+	return recs, res.Error
+}
+
+// AddRule сохраняет правило пользователя с ролью role из чата chatID
+func (e *engine) AddRule(ctx context.Context, name string, spec string, chatID int64, role string) error {
+	parsed, err := ParseSpec(spec)
+	if err != nil {
+		return err
+	}
+	err = CheckChats(parsed.Actions, chatID, role)
+	if err != nil {
+		return err
+	}
+
+	res := e.db.WithContext(ctx).Create(&orm.Rule{Name: name, Enabled: true, Spec: spec, ChatID: chatID})
+	if res.Error != nil {
+		return fmt.Errorf("saving rule failed: %w", res.Error)
+	}
+	return e.load(ctx)
+}
+
+func (e *engine) RemoveRule(ctx context.Context, name string) error {
+	res := e.db.WithContext(ctx).Unscoped().Where("name = ?", name).Delete(&orm.Rule{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRuleNotFound
+	}
+	return e.load(ctx)
+}
+
+func (e *engine) EnableRule(ctx context.Context, name string, enabled bool) error {
+	res := e.db.WithContext(ctx).Model(&orm.Rule{}).Where("name = ?", name).Update("enabled", enabled)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRuleNotFound
+	}
+	return e.load(ctx)
+}
+
+// FireRule запускает правило с триггером command
+func (e *engine) FireRule(name string) error {
+	r, err := e.commandRule(name)
+	if err != nil {
+		return err
+	}
+	e.fire(r)
+	return nil
+}
+
+func (e *engine) commandRule(name string) (*rule, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for _, r := range e.rules {
+		if r.Name != name {
+			continue
+		}
+		if r.spec.Trigger.Type != TriggerCommand {
+			return nil, fmt.Errorf("rule %s is not triggered by command", name)
+		}
+		if !r.Enabled {
+			return nil, fmt.Errorf("rule %s is disabled", name)
+		}
+		return r, nil
+	}
+	return nil, ErrRuleNotFound
+}
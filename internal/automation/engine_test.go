@@ -0,0 +1,187 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testActuator struct {
+	id     string
+	e      *engine
+	mtx    sync.Mutex
+	states []device.Values
+	// locked SetState вызван под блокировкой движка
+	locked bool
+}
+
+func (a *testActuator) ID() string   { return a.id }
+func (a *testActuator) Name() string { return a.id }
+func (a *testActuator) State() (device.Values, error) {
+	return device.Values{}, nil
+}
+func (a *testActuator) SetState(state device.Values) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.e.mtx.TryLock() {
+		a.e.mtx.Unlock()
+	} else {
+		a.locked = true
+	}
+	a.states = append(a.states, state)
+	return nil
+}
+
+type testNotifier struct {
+	mtx  sync.Mutex
+	sent map[int64][]string
+}
+
+func (n *testNotifier) Notify(chatID int64, msg string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.sent[chatID] = append(n.sent[chatID], msg)
+}
+
+func testEngine(t *testing.T) (*engine, *testActuator, *testNotifier) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&orm.Rule{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+
+	devices := device.NewRegistry()
+	e, err := New(db, devices)
+	if err != nil {
+		t.Fatalf("new engine: %s", err)
+	}
+	lamp := &testActuator{id: "lamp", e: e}
+	if err := devices.Add(lamp); err != nil {
+		t.Fatalf("add lamp: %s", err)
+	}
+	n := &testNotifier{sent: map[int64][]string{}}
+	e.mtx.Lock()
+	e.notifier = n
+	e.mtx.Unlock()
+	return e, lamp, n
+}
+
+func door(open bool) device.Event {
+	return device.Event{
+		Type:   device.EventValues,
+		Device: &testActuator{id: "door"},
+		Values: device.Values{"contact": device.Bool(!open)},
+	}
+}
+
+const doorRule = `{"trigger":{"type":"state","device":"door","property":"contact","op":"==","value":false},` +
+	`"actions":[{"type":"notify","text":"Door opened"},{"type":"set","device":"lamp","property":"state","value":true}]}`
+
+func TestStateTrigger(t *testing.T) {
+	e, lamp, n := testEngine(t)
+	if err := e.AddRule(context.Background(), "door", doorRule, 7, access.RoleUser); err != nil {
+		t.Fatalf("add rule: %s", err)
+	}
+
+	e.onValues(door(true))
+	e.onValues(door(true))
+	if got := n.sent[7]; len(got) != 1 || got[0] != "Door opened" {
+		t.Fatalf("notifications %v, want one", got)
+	}
+	if len(lamp.states) != 1 || !lamp.states[0]["state"].Bool {
+		t.Errorf("lamp states %v", lamp.states)
+	}
+	if lamp.locked {
+		t.Errorf("actions run under engine lock")
+	}
+
+	// изменение списка правил не сбрасывает состояние
+	if err := e.AddRule(context.Background(), "other", `{"trigger":{"type":"command"},"actions":[{"type":"notify","text":"x"}]}`, 7, access.RoleUser); err != nil {
+		t.Fatalf("add rule: %s", err)
+	}
+	e.onValues(door(true))
+	if got := n.sent[7]; len(got) != 1 {
+		t.Errorf("rule fired again after reload: %v", got)
+	}
+
+	e.onValues(door(false))
+	e.onValues(door(true))
+	if got := n.sent[7]; len(got) != 2 {
+		t.Errorf("rule not fired on new transition: %v", got)
+	}
+
+	// после выключения и включения правило заново оценивает состояние
+	_ = e.EnableRule(context.Background(), "door", false)
+	_ = e.EnableRule(context.Background(), "door", true)
+	e.onValues(door(true))
+	if got := n.sent[7]; len(got) != 3 {
+		t.Errorf("re-enabled rule not fired: %v", got)
+	}
+}
+
+func TestFireRule(t *testing.T) {
+	e, lamp, n := testEngine(t)
+	_ = e.AddRule(context.Background(), "night", `{"trigger":{"type":"command"},"actions":[{"type":"set","device":"lamp","property":"state","value":false},{"type":"notify","text":"Good night","chat":7}]}`, 7, access.RoleUser)
+	_ = e.AddRule(context.Background(), "door", doorRule, 7, access.RoleUser)
+
+	if err := e.FireRule("night"); err != nil {
+		t.Fatalf("fire: %s", err)
+	}
+	if len(lamp.states) != 1 || lamp.locked {
+		t.Errorf("lamp states %v, locked %v", lamp.states, lamp.locked)
+	}
+	if got := n.sent[7]; len(got) != 1 || got[0] != "Good night" {
+		t.Errorf("notifications %v", got)
+	}
+
+	spam := `{"trigger":{"type":"command"},"actions":[{"type":"notify","text":"x","chat":8}]}`
+	if err := e.AddRule(context.Background(), "spam", spam, 7, access.RoleUser); err == nil {
+		t.Errorf("user rule notifying other chat accepted")
+	}
+	if err := e.AddRule(context.Background(), "spam", spam, 7, access.RoleAdmin); err != nil {
+		t.Errorf("admin rule notifying other chat: %s", err)
+	}
+
+	if err := e.FireRule("door"); err == nil {
+		t.Errorf("state rule fired by command")
+	}
+	if err := e.FireRule("missing"); err != ErrRuleNotFound {
+		t.Errorf("missing rule: %v", err)
+	}
+	_ = e.EnableRule(context.Background(), "night", false)
+	if err := e.FireRule("night"); err == nil {
+		t.Errorf("disabled rule fired")
+	}
+}
+
+// TestCancelledContext запросы идут в контексте команды и прерываются вместе с ней
+func TestCancelledContext(t *testing.T) {
+	e, _, _ := testEngine(t)
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+
+	calls := map[string]func() error{
+		"rules":  func() error { _, err := e.Rules(ctx); return err },
+		"add":    func() error { return e.AddRule(ctx, "door", doorRule, 7, access.RoleUser) },
+		"enable": func() error { return e.EnableRule(ctx, "door", true) },
+		"remove": func() error { return e.RemoveRule(ctx, "door") },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: error %v, want %v", name, err, context.Canceled)
+		}
+	}
+}
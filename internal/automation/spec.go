@@ -0,0 +1,190 @@
+package automation
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/device"
+)
+
+const (
+	// TriggerValue срабатывает на каждое новое значение свойства (с необязательным фильтром op/value)
+	TriggerValue = "value"
+	// TriggerState срабатывает когда свойство устройства переходит в состояние op/value
+	TriggerState = "state"
+	// TriggerTime срабатывает ежедневно в at (ЧЧ:ММ)
+	TriggerTime = "time"
+	// TriggerCommand срабатывает по команде /rule run из телеграма
+	TriggerCommand = "command"
+
+	ConditionValue = "value"
+	ConditionTime  = "time"
+
+	ActionSet    = "set"
+	ActionNotify = "notify"
+)
+
+const clockLayout = "15:04"
+
+type Spec struct {
+	Trigger    Trigger     `json:"trigger"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	Actions    []Action    `json:"actions"`
+}
+
+type Trigger struct {
+	Type     string `json:"type"`
+	Device   string `json:"device,omitempty"`
+	Property string `json:"property,omitempty"`
+	Op       string `json:"op,omitempty"`
+	Value    any    `json:"value,omitempty"`
+	At       string `json:"at,omitempty"`
+}
+
+type Condition struct {
+	Type     string `json:"type"`
+	Device   string `json:"device,omitempty"`
+	Property string `json:"property,omitempty"`
+	Op       string `json:"op,omitempty"`
+	Value    any    `json:"value,omitempty"`
+	After    string `json:"after,omitempty"`
+	Before   string `json:"before,omitempty"`
+}
+
+type Action struct {
+	Type     string `json:"type"`
+	Device   string `json:"device,omitempty"`
+	Property string `json:"property,omitempty"`
+	Value    any    `json:"value,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Chat     int64  `json:"chat,omitempty"`
+}
+
+func ParseSpec(s string) (*Spec, error) {
+	spec := &Spec{}
+	err := json.Unmarshal([]byte(s), spec)
+	if err != nil {
+		return nil, fmt.Errorf("json decode failed: %w", err)
+	}
+	return spec, spec.validate()
+}
+
+// ParseActions разбирает json список действий, используется планировщиком и сценами
+func ParseActions(s string) ([]Action, error) {
+	var actions []Action
+	err := json.Unmarshal([]byte(s), &actions)
+	if err != nil {
+		return nil, fmt.Errorf("json decode failed: %w", err)
+	}
+	return actions, validateActions(actions)
+}
+
+func (s *Spec) validate() error {
+	t := s.Trigger
+	switch t.Type {
+	case TriggerValue:
+		if t.Device == "" {
+			return fmt.Errorf("trigger: device is required")
+		}
+		if t.Op != "" {
+			if t.Property == "" {
+				return fmt.Errorf("trigger: property is required with op")
+			}
+			if err := checkOp(t.Op, t.Value); err != nil {
+				return fmt.Errorf("trigger: %w", err)
+			}
+		}
+	case TriggerState:
+		if t.Device == "" || t.Property == "" || t.Op == "" {
+			return fmt.Errorf("trigger: device, property and op are required")
+		}
+		if err := checkOp(t.Op, t.Value); err != nil {
+			return fmt.Errorf("trigger: %w", err)
+		}
+	case TriggerTime:
+		if _, err := time.Parse(clockLayout, t.At); err != nil {
+			return fmt.Errorf("trigger: bad time %q", t.At)
+		}
+	case TriggerCommand:
+	default:
+		return fmt.Errorf("trigger: unknown type %q", t.Type)
+	}
+
+	for i, c := range s.Conditions {
+		switch c.Type {
+		case ConditionValue:
+			if c.Device == "" || c.Property == "" || c.Op == "" {
+				return fmt.Errorf("condition %d: device, property and op are required", i)
+			}
+			if err := checkOp(c.Op, c.Value); err != nil {
+				return fmt.Errorf("condition %d: %w", i, err)
+			}
+		case ConditionTime:
+			if _, err := time.Parse(clockLayout, c.After); err != nil {
+				return fmt.Errorf("condition %d: bad time %q", i, c.After)
+			}
+			if _, err := time.Parse(clockLayout, c.Before); err != nil {
+				return fmt.Errorf("condition %d: bad time %q", i, c.Before)
+			}
+		default:
+			return fmt.Errorf("condition %d: unknown type %q", i, c.Type)
+		}
+	}
+
+	if len(s.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	return validateActions(s.Actions)
+}
+
+func validateActions(actions []Action) error {
+	for i, a := range actions {
+		switch a.Type {
+		case ActionSet:
+			if a.Device == "" || a.Property == "" {
+				return fmt.Errorf("action %d: device and property are required", i)
+			}
+			if _, err := device.FromRaw(a.Value); err != nil {
+				return fmt.Errorf("action %d: %w", i, err)
+			}
+		case ActionNotify:
+			if a.Text == "" {
+				return fmt.Errorf("action %d: text is required", i)
+			}
+		default:
+			return fmt.Errorf("action %d: unknown type %q", i, a.Type)
+		}
+	}
+	return nil
+}
+
+// CheckChats проверяет, что уведомления в чужие чаты настраивает только админ. chatID чат автора
+func CheckChats(actions []Action, chatID int64, role string) error {
+	if access.RoleAllows(role, access.RoleAdmin) {
+		return nil
+	}
+	for i, a := range actions {
+		if a.Type == ActionNotify && a.Chat != 0 && a.Chat != chatID {
+			return fmt.Errorf("action %d: only admins can notify other chats", i)
+		}
+	}
+	return nil
+}
+
+// checkOp проверяет образец и применимость к нему оператора
+func checkOp(op string, raw any) error {
+	v, err := device.FromRaw(raw)
+	if err != nil {
+		return err
+	}
+	_, err = device.Compare(v, op, v)
+	return err
+}
+
+// clock возвращает минуты от начала суток
+func clock(s string) int {
+	t, _ := time.Parse(clockLayout, s)
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,60 @@
+package automation
+
+import (
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/access"
+)
+
+func TestParseSpec(t *testing.T) {
+	cases := []struct {
+		name string
+		spec string
+		ok   bool
+	}{
+		{"value any", `{"trigger":{"type":"value","device":"t"},"actions":[{"type":"notify","text":"x"}]}`, true},
+		{"value filter", `{"trigger":{"type":"value","device":"t","property":"temperature","op":">","value":25},"actions":[{"type":"notify","text":"x"}]}`, true},
+		{"value op without property", `{"trigger":{"type":"value","device":"t","op":">","value":25},"actions":[{"type":"notify","text":"x"}]}`, false},
+		{"value unknown op", `{"trigger":{"type":"value","device":"t","property":"temperature","op":"=>","value":25},"actions":[{"type":"notify","text":"x"}]}`, false},
+		{"state", `{"trigger":{"type":"state","device":"door","property":"contact","op":"==","value":false},"actions":[{"type":"notify","text":"x"}]}`, true},
+		{"state bool ordering", `{"trigger":{"type":"state","device":"door","property":"contact","op":">","value":false},"actions":[{"type":"notify","text":"x"}]}`, false},
+		{"state without op", `{"trigger":{"type":"state","device":"door","property":"contact","value":false},"actions":[{"type":"notify","text":"x"}]}`, false},
+		{"time", `{"trigger":{"type":"time","at":"07:30"},"actions":[{"type":"notify","text":"x"}]}`, true},
+		{"bad time", `{"trigger":{"type":"time","at":"7.30"},"actions":[{"type":"notify","text":"x"}]}`, false},
+		{"unknown trigger", `{"trigger":{"type":"sometimes"},"actions":[{"type":"notify","text":"x"}]}`, false},
+		{"condition", `{"trigger":{"type":"command"},"conditions":[{"type":"value","device":"t","property":"temperature","op":"<","value":18},{"type":"time","after":"22:00","before":"06:00"}],"actions":[{"type":"notify","text":"x"}]}`, true},
+		{"condition unknown op", `{"trigger":{"type":"command"},"conditions":[{"type":"value","device":"t","property":"temperature","op":"~","value":18}],"actions":[{"type":"notify","text":"x"}]}`, false},
+		{"no actions", `{"trigger":{"type":"command"}}`, false},
+		{"set without property", `{"trigger":{"type":"command"},"actions":[{"type":"set","device":"lamp","value":true}]}`, false},
+		{"notify without text", `{"trigger":{"type":"command"},"actions":[{"type":"notify"}]}`, false},
+		{"broken json", `{"trigger":`, false},
+	}
+	for _, c := range cases {
+		_, err := ParseSpec(c.spec)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: error %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestCheckChats(t *testing.T) {
+	own := []Action{{Type: ActionNotify, Text: "x"}, {Type: ActionNotify, Text: "x", Chat: 7}}
+	other := []Action{{Type: ActionSet, Device: "lamp", Property: "state", Value: true}, {Type: ActionNotify, Text: "x", Chat: 8}}
+	cases := []struct {
+		name    string
+		actions []Action
+		role    string
+		ok      bool
+	}{
+		{"own chat", own, access.RoleUser, true},
+		{"other chat by user", other, access.RoleUser, false},
+		{"other chat by guest", other, access.RoleGuest, false},
+		{"other chat by admin", other, access.RoleAdmin, true},
+	}
+	for _, c := range cases {
+		err := CheckChats(c.actions, 7, c.role)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: error %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"github.com/Farengier/smart-home/internal/orm"
 	"github.com/Farengier/smart-home/internal/signal"
 	"github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
@@ -59,18 +60,19 @@ func New(cfg Config) (*db, error) {
 	if err != nil {
 		return nil, fmt.Errorf("db failed creating memory connection: %w", err)
 	}
+	// у каждого соединения своя база в памяти, поэтому соединение одно на всех
+	dbc.SetMaxOpenConns(1)
 	d.dbc = dbc
 
-	gormLog := logger.New(
-		log.StandardLogger(),
-		logger.Config{
+	gormLog := ctxLogger{
+		cfg: logger.Config{
 			SlowThreshold:             time.Second, // Slow SQL threshold
 			LogLevel:                  logger.Info, // Log level
 			IgnoreRecordNotFoundError: true,        // Ignore ErrRecordNotFound error for logger
 			ParameterizedQueries:      false,       // Don't include params in the SQL log
 			Colorful:                  false,       // Disable color
 		},
-	)
+	}
 	d.gormDB, err = gorm.Open(gormSqlite.Dialector{Conn: d.dbc}, &gorm.Config{Logger: gormLog})
 	if err != nil {
 		return nil, fmt.Errorf("db failed gorm-ing connection: %w", err)
@@ -100,10 +102,37 @@ func (d *db) init(ctx context.Context) error {
 		return fmt.Errorf("sync up failed: %w", err)
 	}
 
+	err = d.migrate()
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
 	signal.Run(d.syncer)
 	return nil
 }
 
+func (d *db) migrate() error {
+	log.Info("[DB] migrating schema")
+	return d.gormDB.AutoMigrate(
+		&orm.User{},
+		&orm.UserRole{},
+		&orm.Room{},
+		&orm.Device{},
+		&orm.SensorReading{},
+		&orm.ReadingRollup{},
+		&orm.Rule{},
+		&orm.Job{},
+		&orm.Scene{},
+		&orm.SceneState{},
+		&orm.Alert{},
+		&orm.Grant{},
+		&orm.ChatSession{},
+		&orm.RecoveryCode{},
+		&orm.Outbox{},
+		&orm.Deletion{},
+	)
+}
+
 func (d *db) syncUp(ctx context.Context) error {
 	files, err := os.ReadDir(d.cfg.DBDirPath())
 	if err != nil {
@@ -166,7 +195,7 @@ func (d *db) syncUp(ctx context.Context) error {
 		for {
 			ok, err := bck.Step(1)
 			if err != nil {
-				log.Errorf("[DB] sync up error: %w", err)
+				log.Errorf("[DB] sync up error: %s", err)
 			}
 			if ok {
 				log.Infof("[DB] sync up finishing")
@@ -175,7 +204,7 @@ func (d *db) syncUp(ctx context.Context) error {
 		}
 		err = bck.Finish()
 		if err != nil {
-			log.Errorf("[DB] sync done with error: %w", err)
+			log.Errorf("[DB] sync done with error: %s", err)
 			return nil
 		}
 		log.Infof("[DB] sync done")
@@ -265,7 +294,7 @@ func (d *db) syncDown() error {
 		for {
 			ok, err := bck.Step(1)
 			if err != nil {
-				log.Errorf("[DB] sync down error: %w", err)
+				log.Errorf("[DB] sync down error: %s", err)
 			}
 			if ok {
 				log.Infof("[DB] sync down finishing")
@@ -274,7 +303,7 @@ func (d *db) syncDown() error {
 		}
 		err = bck.Finish()
 		if err != nil {
-			log.Errorf("[DB] sync done with error: %w", err)
+			log.Errorf("[DB] sync done with error: %s", err)
 			return nil
 		}
 		log.Infof("[DB] sync down done")
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ctxLogger логгер GORM, который пишет через log.WithContext, чтобы в записи попадал идентификатор запроса
+type ctxLogger struct {
+	cfg logger.Config
+}
+
+func (l ctxLogger) LogMode(level logger.LogLevel) logger.Interface {
+	l.cfg.LogLevel = level
+	return l
+}
+func (l ctxLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.cfg.LogLevel >= logger.Info {
+		log.WithContext(ctx).Infof("[DB] %s "+msg, append([]interface{}{caller()}, data...)...)
+	}
+}
+func (l ctxLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.cfg.LogLevel >= logger.Warn {
+		log.WithContext(ctx).Warnf("[DB] %s "+msg, append([]interface{}{caller()}, data...)...)
+	}
+}
+func (l ctxLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.cfg.LogLevel >= logger.Error {
+		log.WithContext(ctx).Errorf("[DB] %s "+msg, append([]interface{}{caller()}, data...)...)
+	}
+}
+func (l ctxLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.cfg.LogLevel <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	ms := float64(elapsed.Nanoseconds()) / 1e6
+	entry := log.WithContext(ctx)
+
+	switch {
+	case err != nil && l.cfg.LogLevel >= logger.Error && (!errors.Is(err, gorm.ErrRecordNotFound) || !l.cfg.IgnoreRecordNotFoundError):
+		sql, rows := fc()
+		entry.Errorf("[DB] %s %s [%.3fms] [rows:%d] %s", caller(), err, ms, rows, sql)
+	case l.cfg.SlowThreshold != 0 && elapsed > l.cfg.SlowThreshold && l.cfg.LogLevel >= logger.Warn:
+		sql, rows := fc()
+		entry.Warnf("[DB] %s slow sql >= %s [%.3fms] [rows:%d] %s", caller(), l.cfg.SlowThreshold, ms, rows, sql)
+	case l.cfg.LogLevel == logger.Info:
+		sql, rows := fc()
+		entry.Infof("[DB] %s [%.3fms] [rows:%d] %s", caller(), ms, rows, sql)
+	}
+}
+
+// caller место в коде приложения, откуда пришёл запрос: первый кадр стека вне GORM и этого файла
+func caller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.Contains(f.File, "gorm.io/") && !strings.HasSuffix(f.File, "internal/db/logger.go") {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
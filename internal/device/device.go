@@ -0,0 +1,19 @@
+package device
+
+type Device interface {
+	ID() string
+	Name() string
+}
+
+type Sensor interface {
+	Device
+	// Read возвращает последние известные значения всех свойств сенсора
+	Read() (Values, error)
+}
+
+type Actuator interface {
+	Device
+	// SetState устанавливает значения переданных свойств, остальные не меняются
+	SetState(state Values) error
+	State() (Values, error)
+}
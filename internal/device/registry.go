@@ -0,0 +1,189 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/signal"
+	log "github.com/sirupsen/logrus"
+)
+
+const eventsChanBufferLen = 64
+
+type EventType int
+
+const (
+	EventAdded EventType = iota
+	EventRemoved
+	EventValues
+)
+
+type Event struct {
+	Type   EventType
+	Device Device
+	Values Values
+	Time   time.Time
+}
+
+type Registry struct {
+	devices   map[string]Device
+	values    map[string]Values
+	listeners []func(e Event)
+	events    chan Event
+	mtx       sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{
+		devices: make(map[string]Device),
+		values:  make(map[string]Values),
+		events:  make(chan Event, eventsChanBufferLen),
+	}
+
+	ctx, cncl := context.WithCancel(context.Background())
+	signal.OnShutdown(func() error {
+		log.Info("[Devices] Shutdown registry")
+		cncl()
+		return nil
+	})
+	signal.Run(func() { r.dispatch(ctx) })
+	return r
+}
+
+func (r *Registry) Add(d Device) error {
+	r.mtx.Lock()
+	if _, ok := r.devices[d.ID()]; ok {
+		r.mtx.Unlock()
+		return fmt.Errorf("device %s already registered", d.ID())
+	}
+	r.devices[d.ID()] = d
+	r.mtx.Unlock()
+
+	log.Infof("[Devices] added %s [%s]", d.ID(), d.Name())
+	r.emit(Event{Type: EventAdded, Device: d, Time: time.Now()})
+	return nil
+}
+
+func (r *Registry) Remove(id string) {
+	r.mtx.Lock()
+	d, ok := r.devices[id]
+	delete(r.devices, id)
+	delete(r.values, id)
+	r.mtx.Unlock()
+
+	if !ok {
+		return
+	}
+	log.Infof("[Devices] removed %s [%s]", d.ID(), d.Name())
+	r.emit(Event{Type: EventRemoved, Device: d, Time: time.Now()})
+}
+
+func (r *Registry) Device(id string) (Device, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	d, ok := r.devices[id]
+	return d, ok
+}
+
+func (r *Registry) Sensor(id string) (Sensor, bool) {
+	d, ok := r.Device(id)
+	if !ok {
+		return nil, false
+	}
+	s, ok := d.(Sensor)
+	return s, ok
+}
+
+func (r *Registry) Actuator(id string) (Actuator, bool) {
+	d, ok := r.Device(id)
+	if !ok {
+		return nil, false
+	}
+	a, ok := d.(Actuator)
+	return a, ok
+}
+
+// Devices возвращает все зарегистрированные устройства, отсортированные по ID
+func (r *Registry) Devices() []Device {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make([]Device, 0, len(r.devices))
+	for _, d := range r.devices {
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID() < res[j].ID()
+	})
+	return res
+}
+
+// Report сохраняет полученные от устройства значения и рассылает их подписчикам
+func (r *Registry) Report(id string, vals Values) {
+	r.mtx.Lock()
+	d, ok := r.devices[id]
+	if !ok {
+		r.mtx.Unlock()
+		log.Warnf("[Devices] values reported for unknown device %s", id)
+		return
+	}
+	last, ok := r.values[id]
+	if !ok {
+		last = Values{}
+		r.values[id] = last
+	}
+	for k, v := range vals {
+		last[k] = v
+	}
+	r.mtx.Unlock()
+
+	r.emit(Event{Type: EventValues, Device: d, Values: vals, Time: time.Now()})
+}
+
+// Values возвращает копию последних полученных от устройства значений
+func (r *Registry) Values(id string) Values {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := Values{}
+	for k, v := range r.values[id] {
+		res[k] = v
+	}
+	return res
+}
+
+// Subscribe регистрирует обработчик событий реестра. Обработчики вызываются последовательно из одной горутины
+func (r *Registry) Subscribe(fn func(e Event)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+func (r *Registry) emit(e Event) {
+	select {
+	case r.events <- e:
+	default:
+		log.Errorf("[Devices] events queue is full, dropping event for %s", e.Device.ID())
+	}
+}
+
+func (r *Registry) dispatch(ctx context.Context) {
+	log.Info("[Devices] running events dispatcher")
+	for {
+		select {
+		case e := <-r.events:
+			r.mtx.RLock()
+			listeners := r.listeners
+			r.mtx.RUnlock()
+
+			for _, fn := range listeners {
+				fn(e)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package device
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/orm"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	KindSensor   = "sensor"
+	KindActuator = "actuator"
+	KindBoth     = "sensor,actuator"
+)
+
+func KindOf(d Device) string {
+	_, isSensor := d.(Sensor)
+	_, isActuator := d.(Actuator)
+	switch {
+	case isSensor && isActuator:
+		return KindBoth
+	case isActuator:
+		return KindActuator
+	default:
+		return KindSensor
+	}
+}
+
+type store struct {
+	db  *gorm.DB
+	ids map[string]uint
+	mtx sync.Mutex
+}
+
+// Persist сохраняет метаданные зарегистрированных устройств и полученные от них значения в БД
+func Persist(r *Registry, db *gorm.DB) {
+	s := &store{db: db, ids: make(map[string]uint)}
+	r.Subscribe(s.handle)
+}
+
+func (s *store) handle(e Event) {
+	switch e.Type {
+	case EventAdded:
+		s.saveDevice(e.Device)
+	case EventValues:
+		s.saveValues(e.Device, e.Values, e.Time)
+	}
+}
+
+func (s *store) saveDevice(d Device) {
+	dev := &orm.Device{}
+	res := s.db.Where(orm.Device{UID: d.ID()}).
+		Assign(orm.Device{Name: d.Name(), Kind: KindOf(d)}).
+		FirstOrCreate(dev)
+	if res.Error != nil {
+		log.Errorf("[Devices] saving device %s failed: %s", d.ID(), res.Error)
+		return
+	}
+
+	s.mtx.Lock()
+	s.ids[d.ID()] = dev.ID
+	s.mtx.Unlock()
+}
+
+func (s *store) saveValues(d Device, vals Values, t time.Time) {
+	s.mtx.Lock()
+	id, ok := s.ids[d.ID()]
+	s.mtx.Unlock()
+	if !ok {
+		log.Warnf("[Devices] device %s is not stored, values skipped", d.ID())
+		return
+	}
+
+	readings := make([]orm.SensorReading, 0, len(vals))
+	for p, v := range vals {
+		ts := v.Time
+		if ts.IsZero() {
+			ts = t
+		}
+		readings = append(readings, orm.SensorReading{
+			DeviceID: id,
+			Property: p,
+			Type:     int(v.Type),
+			Num:      v.Num,
+			Bool:     v.Bool,
+			Str:      v.Str,
+			Unit:     v.Unit,
+			Time:     ts.UTC(),
+		})
+	}
+	if len(readings) == 0 {
+		return
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&readings).Error; err != nil {
+			return err
+		}
+		return tx.Model(&orm.Device{}).Where("id = ?", id).Update("last_seen", t).Error
+	})
+	if err != nil {
+		log.Errorf("[Devices] saving values of %s failed: %s", d.ID(), err)
+	}
+}
@@ -0,0 +1,158 @@
+package device
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ValueType int
+
+const (
+	TypeFloat ValueType = iota
+	TypeBool
+	TypeString
+)
+
+// Value одно измеренное или заданное значение свойства устройства
+type Value struct {
+	Type ValueType
+	Num  float64
+	Bool bool
+	Str  string
+	Unit string
+	Time time.Time
+}
+
+// Values значения свойств устройства по их именам ("temperature", "state", ...)
+type Values map[string]Value
+
+func Float(v float64, unit string) Value {
+	return Value{Type: TypeFloat, Num: v, Unit: unit, Time: time.Now()}
+}
+
+func Bool(v bool) Value {
+	return Value{Type: TypeBool, Bool: v, Time: time.Now()}
+}
+
+func String(v string) Value {
+	return Value{Type: TypeString, Str: v, Time: time.Now()}
+}
+
+// Parse угадывает тип значения по строке: число, true/false или строка
+func Parse(s string, unit string) Value {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return Float(f, unit)
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return Bool(b)
+	}
+	return String(s)
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case TypeFloat:
+		s := strconv.FormatFloat(v.Num, 'f', -1, 64)
+		if v.Unit != "" {
+			s += " " + v.Unit
+		}
+		return s
+	case TypeBool:
+		return strconv.FormatBool(v.Bool)
+	case TypeString:
+		return v.Str
+	default:
+		return fmt.Sprintf("unknown value type %d", v.Type)
+	}
+}
+
+// Raw возвращает значение в виде пригодном для json.Marshal
+func (v Value) Raw() any {
+	switch v.Type {
+	case TypeFloat:
+		return v.Num
+	case TypeBool:
+		return v.Bool
+	default:
+		return v.Str
+	}
+}
+
+// FromRaw строит значение из результата json.Unmarshal
+func FromRaw(raw any) (Value, error) {
+	switch v := raw.(type) {
+	case float64:
+		return Float(v, ""), nil
+	case int:
+		return Float(float64(v), ""), nil
+	case bool:
+		return Bool(v), nil
+	case string:
+		return String(v), nil
+	default:
+		return Value{}, fmt.Errorf("unsupported value %v", raw)
+	}
+}
+
+// Compare сравнивает значение с образцом. Для строк и булевых значений допустимы только == и !=
+func Compare(v Value, op string, target Value) (bool, error) {
+	// "ON" от устройства и true в правиле считаем одним и тем же
+	if v.Type == TypeString && target.Type == TypeBool {
+		if b, ok := strBool(v.Str); ok {
+			v = Bool(b)
+		}
+	}
+	if v.Type == TypeBool && target.Type == TypeString {
+		if b, ok := strBool(target.Str); ok {
+			target = Bool(b)
+		}
+	}
+	if v.Type != target.Type {
+		return false, fmt.Errorf("type mismatch: %s vs %s", v, target)
+	}
+
+	switch v.Type {
+	case TypeFloat:
+		switch op {
+		case "==":
+			return v.Num == target.Num, nil
+		case "!=":
+			return v.Num != target.Num, nil
+		case ">":
+			return v.Num > target.Num, nil
+		case ">=":
+			return v.Num >= target.Num, nil
+		case "<":
+			return v.Num < target.Num, nil
+		case "<=":
+			return v.Num <= target.Num, nil
+		}
+		return false, fmt.Errorf("unknown operator %s", op)
+	case TypeBool:
+		return compareEq(v.Bool == target.Bool, op)
+	default:
+		return compareEq(v.Str == target.Str, op)
+	}
+}
+
+func strBool(s string) (bool, bool) {
+	switch strings.ToUpper(s) {
+	case "ON", "TRUE", "OPEN", "1":
+		return true, true
+	case "OFF", "FALSE", "CLOSED", "0":
+		return false, true
+	}
+	return false, false
+}
+
+func compareEq(eq bool, op string) (bool, error) {
+	switch op {
+	case "==":
+		return eq, nil
+	case "!=":
+		return !eq, nil
+	}
+	return false, fmt.Errorf("operator %s is not applicable", op)
+}
@@ -0,0 +1,213 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/device"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FormatJSON = "json"
+	FormatRaw  = "raw"
+
+	defaultProperty = "state"
+)
+
+// Binding описывает устройство, доступное через топики брокера
+type Binding struct {
+	ID   string
+	Name string
+	// StateTopic топик, из которого читаются значения сенсора или состояние актуатора
+	StateTopic string
+	// CommandTopic топик для команд актуатору. Если пуст, устройство только сенсор
+	CommandTopic string
+	// Property имя свойства для не-json значений
+	Property string
+	Unit     string
+	// Format формат команд: json объект свойств или raw значение свойства Property
+	Format string
+	// PayloadOn, PayloadOff raw-представления булевых значений (например ON/OFF у Tasmota)
+	PayloadOn  string
+	PayloadOff string
+}
+
+type sensor struct {
+	b       Binding
+	cli     Client
+	devices *device.Registry
+}
+
+type actuator struct {
+	*sensor
+}
+
+func (s *sensor) ID() string {
+	return s.b.ID
+}
+
+func (s *sensor) Name() string {
+	return s.b.Name
+}
+
+func (s *sensor) Read() (device.Values, error) {
+	return s.devices.Values(s.b.ID), nil
+}
+
+func (a *actuator) State() (device.Values, error) {
+	return a.devices.Values(a.b.ID), nil
+}
+
+func (a *actuator) SetState(state device.Values) error {
+	var payload []byte
+	if a.b.Format == FormatRaw {
+		v, ok := state[a.b.Property]
+		if !ok {
+			return fmt.Errorf("property %s is required for %s", a.b.Property, a.b.ID)
+		}
+		payload = []byte(a.b.raw(v))
+	} else {
+		obj := make(map[string]any, len(state))
+		for k, v := range state {
+			obj[k] = v.Raw()
+		}
+		var err error
+		payload, err = json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("marshal state failed: %w", err)
+		}
+	}
+
+	err := a.cli.Publish(a.b.CommandTopic, payload, false)
+	if err != nil {
+		return fmt.Errorf("publish to %s failed: %w", a.b.CommandTopic, err)
+	}
+	return nil
+}
+
+func (s *sensor) onMessage(topic string, payload []byte) {
+	if v, ok := s.b.boolPayload(payload); ok {
+		s.devices.Report(s.b.ID, device.Values{s.b.Property: v})
+		return
+	}
+
+	vals, err := ParsePayload(payload, s.b.Property, s.b.Unit)
+	if err != nil {
+		log.Errorf("[MQTT] bad payload in %s: %s", topic, err)
+		return
+	}
+	s.devices.Report(s.b.ID, vals)
+}
+
+func (b Binding) raw(v device.Value) string {
+	if v.Type != device.TypeBool || b.PayloadOn == "" {
+		return v.String()
+	}
+	if v.Bool {
+		return b.PayloadOn
+	}
+	return b.PayloadOff
+}
+
+func (b Binding) boolPayload(payload []byte) (device.Value, bool) {
+	if b.PayloadOn == "" {
+		return device.Value{}, false
+	}
+	switch strings.TrimSpace(string(payload)) {
+	case b.PayloadOn:
+		return device.Bool(true), true
+	case b.PayloadOff:
+		return device.Bool(false), true
+	}
+	return device.Value{}, false
+}
+
+// ParsePayload разбирает json объект в значения свойств, любое другое содержимое считается значением property
+func ParsePayload(payload []byte, property string, unit string) (device.Values, error) {
+	if property == "" {
+		property = defaultProperty
+	}
+
+	trimmed := strings.TrimSpace(string(payload))
+	if !strings.HasPrefix(trimmed, "{") {
+		return device.Values{property: device.Parse(trimmed, unit)}, nil
+	}
+
+	obj := map[string]any{}
+	err := json.Unmarshal(payload, &obj)
+	if err != nil {
+		return nil, fmt.Errorf("json decode failed: %w", err)
+	}
+
+	vals := device.Values{}
+	for k, raw := range obj {
+		switch v := raw.(type) {
+		case float64:
+			u := ""
+			if k == property {
+				u = unit
+			}
+			vals[k] = device.Float(v, u)
+		case bool:
+			vals[k] = device.Bool(v)
+		case string:
+			vals[k] = device.String(v)
+		}
+	}
+	return vals, nil
+}
+
+// Bind регистрирует устройства в реестре и подписывает их на топики состояния
+func Bind(cli Client, devices *device.Registry, bindings []Binding) error {
+	for _, b := range bindings {
+		_, err := bind(cli, devices, b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bind(cli Client, devices *device.Registry, b Binding) (*sensor, error) {
+	if b.ID == "" || b.StateTopic == "" && b.CommandTopic == "" {
+		return nil, fmt.Errorf("binding %q: id and at least one topic are required", b.ID)
+	}
+	if b.Name == "" {
+		b.Name = b.ID
+	}
+	if b.Property == "" {
+		b.Property = defaultProperty
+	}
+
+	s := &sensor{b: b, cli: cli, devices: devices}
+	var d device.Device = s
+	if b.CommandTopic != "" {
+		d = &actuator{sensor: s}
+	}
+
+	err := devices.Add(d)
+	if err != nil {
+		return nil, fmt.Errorf("binding %s: %w", b.ID, err)
+	}
+	if b.StateTopic == "" {
+		return s, nil
+	}
+	err = cli.Subscribe(b.StateTopic, s.onMessage)
+	if err != nil {
+		devices.Remove(b.ID)
+		return nil, fmt.Errorf("binding %s: subscribe to %s failed: %w", b.ID, b.StateTopic, err)
+	}
+	return s, nil
+}
+
+func unbind(cli Client, devices *device.Registry, b Binding) {
+	if b.StateTopic != "" {
+		err := cli.Unsubscribe(b.StateTopic)
+		if err != nil {
+			log.Errorf("[MQTT] unsubscribe from %s failed: %s", b.StateTopic, err)
+		}
+	}
+	devices.Remove(b.ID)
+}
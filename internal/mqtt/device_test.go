@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/device"
+)
+
+func TestParsePayload(t *testing.T) {
+	cases := []struct {
+		payload  string
+		property string
+		unit     string
+		want     device.Values
+	}{
+		{"21.5", "temperature", "°C", device.Values{"temperature": device.Float(21.5, "°C")}},
+		{" true ", "", "", device.Values{"state": device.Bool(true)}},
+		{"idle", "mode", "", device.Values{"mode": device.String("idle")}},
+		{
+			`{"temperature": 20, "battery": 90, "occupancy": false, "action": "single"}`, "temperature", "°C",
+			device.Values{
+				"temperature": device.Float(20, "°C"),
+				"battery":     device.Float(90, ""),
+				"occupancy":   device.Bool(false),
+				"action":      device.String("single"),
+			},
+		},
+	}
+	for _, c := range cases {
+		got, err := ParsePayload([]byte(c.payload), c.property, c.unit)
+		if err != nil {
+			t.Errorf("ParsePayload(%q): %s", c.payload, err)
+			continue
+		}
+		assertValues(t, c.payload, got, c.want)
+	}
+
+	_, err := ParsePayload([]byte(`{"broken"`), "", "")
+	if err == nil {
+		t.Errorf("broken json accepted")
+	}
+}
+
+func TestBindRaw(t *testing.T) {
+	cli := NewMemoryClient()
+	devices := device.NewRegistry()
+	err := Bind(cli, devices, []Binding{{
+		ID:           "plug",
+		StateTopic:   "tasmota/plug/POWER",
+		CommandTopic: "tasmota/plug/cmnd/POWER",
+		Property:     "power",
+		Format:       FormatRaw,
+		PayloadOn:    "ON",
+		PayloadOff:   "OFF",
+	}})
+	if err != nil {
+		t.Fatalf("bind: %s", err)
+	}
+
+	_ = cli.Publish("tasmota/plug/POWER", []byte("ON"), false)
+	assertValues(t, "ON", devices.Values("plug"), device.Values{"power": device.Bool(true)})
+	_ = cli.Publish("tasmota/plug/POWER", []byte("OFF"), false)
+	assertValues(t, "OFF", devices.Values("plug"), device.Values{"power": device.Bool(false)})
+
+	cmds := collect(cli, t, "tasmota/plug/cmnd/POWER")
+	a, ok := devices.Actuator("plug")
+	if !ok {
+		t.Fatalf("plug is not an actuator")
+	}
+	if err := a.SetState(device.Values{"power": device.Bool(true)}); err != nil {
+		t.Fatalf("set state: %s", err)
+	}
+	if err := a.SetState(device.Values{"power": device.Bool(false)}); err != nil {
+		t.Fatalf("set state: %s", err)
+	}
+	if len(*cmds) != 2 || (*cmds)[0].payload != "ON" || (*cmds)[1].payload != "OFF" {
+		t.Errorf("commands %v, want ON, OFF", *cmds)
+	}
+
+	if err := a.SetState(device.Values{"other": device.Bool(true)}); err == nil {
+		t.Errorf("raw command without property accepted")
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	cli := NewMemoryClient()
+	devices := device.NewRegistry()
+	err := Bind(cli, devices, []Binding{
+		{ID: "lamp", StateTopic: "z2m/lamp", CommandTopic: "z2m/lamp/set", Format: FormatJSON},
+		{ID: "thermo", StateTopic: "z2m/thermo", Unit: "°C", Property: "temperature"},
+	})
+	if err != nil {
+		t.Fatalf("bind: %s", err)
+	}
+	if _, ok := devices.Actuator("thermo"); ok {
+		t.Errorf("binding without command topic is an actuator")
+	}
+
+	_ = cli.Publish("z2m/thermo", []byte(`{"temperature": 22.5, "humidity": 41}`), false)
+	assertValues(t, "thermo", devices.Values("thermo"), device.Values{
+		"temperature": device.Float(22.5, "°C"),
+		"humidity":    device.Float(41, ""),
+	})
+
+	cmds := collect(cli, t, "z2m/lamp/set")
+	a, _ := devices.Actuator("lamp")
+	err = a.SetState(device.Values{"state": device.String("ON"), "brightness": device.Float(100, "")})
+	if err != nil {
+		t.Fatalf("set state: %s", err)
+	}
+	if len(*cmds) != 1 {
+		t.Fatalf("commands %v, want one", *cmds)
+	}
+	got := map[string]any{}
+	if err := json.Unmarshal([]byte((*cmds)[0].payload), &got); err != nil {
+		t.Fatalf("command is not json: %s", err)
+	}
+	if got["state"] != "ON" || got["brightness"] != float64(100) {
+		t.Errorf("command %v", got)
+	}
+}
+
+func TestBindInvalid(t *testing.T) {
+	cli := NewMemoryClient()
+	devices := device.NewRegistry()
+	cases := []Binding{
+		{StateTopic: "a"},
+		{ID: "x"},
+	}
+	for _, b := range cases {
+		if err := Bind(cli, devices, []Binding{b}); err == nil {
+			t.Errorf("binding %+v accepted", b)
+		}
+	}
+
+	_ = Bind(cli, devices, []Binding{{ID: "dup", StateTopic: "a"}})
+	if err := Bind(cli, devices, []Binding{{ID: "dup", StateTopic: "b"}}); err == nil {
+		t.Errorf("duplicate id accepted")
+	}
+}
+
+func assertValues(t *testing.T, name string, got, want device.Values) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: values %v, want %v", name, got, want)
+		return
+	}
+	for k, w := range want {
+		g, ok := got[k]
+		if !ok || g.Type != w.Type || g.Num != w.Num || g.Bool != w.Bool || g.Str != w.Str || g.Unit != w.Unit {
+			t.Errorf("%s: %s = %v, want %v", name, k, g, w)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&orm.Room{}, &orm.Device{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	return db
+}
+
+func dbDevice(t *testing.T, db *gorm.DB, uid string) orm.Device {
+	t.Helper()
+	var d orm.Device
+	if err := db.Where("uid = ?", uid).First(&d).Error; err != nil {
+		t.Fatalf("device %s: %s", uid, err)
+	}
+	return d
+}
+
+const z2mLampV1 = `[
+	{"ieee_address": "0x01", "type": "Coordinator"},
+	{"ieee_address": "0xaa", "friendly_name": "lamp", "type": "Router", "supported": true,
+	 "definition": {"model": "LED1545G12", "vendor": "IKEA", "exposes": [
+		{"type": "light", "features": [
+			{"type": "binary", "name": "state", "property": "state", "access": 7},
+			{"type": "numeric", "name": "brightness", "property": "brightness", "access": 7}
+		]},
+		{"type": "numeric", "name": "linkquality", "property": "linkquality", "access": 1}
+	 ]}},
+	{"ieee_address": "0xbb", "friendly_name": "thermo", "type": "EndDevice", "supported": true,
+	 "definition": {"model": "WSDCGQ11LM", "vendor": "Aqara", "exposes": [
+		{"type": "numeric", "name": "temperature", "property": "temperature", "access": 1, "unit": "°C"}
+	 ]}}
+]`
+
+const z2mLampRenamed = `[
+	{"ieee_address": "0xaa", "friendly_name": "kitchen lamp", "type": "Router", "supported": true,
+	 "definition": {"model": "LED1545G12", "vendor": "IKEA", "exposes": [
+		{"type": "binary", "name": "state", "property": "state", "access": 7}
+	 ]}}
+]`
+
+func TestZigbee2MQTT(t *testing.T) {
+	cli := NewMemoryClient()
+	devices := device.NewRegistry()
+	db := testDB(t)
+	if err := Zigbee2MQTT(cli, devices, db, "z2m"); err != nil {
+		t.Fatalf("zigbee2mqtt: %s", err)
+	}
+
+	// добавление
+	_ = cli.Publish("z2m/bridge/devices", []byte(z2mLampV1), true)
+	if _, ok := devices.Actuator("0xaa"); !ok {
+		t.Errorf("lamp is not bound as actuator")
+	}
+	if _, ok := devices.Actuator("0xbb"); ok {
+		t.Errorf("thermometer bound as actuator")
+	}
+	if _, ok := devices.Device("0x01"); ok {
+		t.Errorf("coordinator bound")
+	}
+	lamp := dbDevice(t, db, "0xaa")
+	if lamp.Name != "lamp" || lamp.Kind != device.KindBoth || lamp.Vendor != "IKEA" || !lamp.Online {
+		t.Errorf("lamp record %+v", lamp)
+	}
+	if lamp.Capabilities != "brightness:set,linkquality,state:set" {
+		t.Errorf("lamp capabilities %q", lamp.Capabilities)
+	}
+	if th := dbDevice(t, db, "0xbb"); th.Kind != device.KindSensor {
+		t.Errorf("thermometer kind %q", th.Kind)
+	}
+
+	_ = cli.Publish("z2m/thermo", []byte(`{"temperature": 21}`), false)
+	if v := devices.Values("0xbb")["temperature"]; v.Num != 21 {
+		t.Errorf("thermometer value %v", v)
+	}
+
+	_ = cli.Publish("z2m/thermo/availability", []byte(`{"state": "offline"}`), false)
+	if dbDevice(t, db, "0xbb").Online {
+		t.Errorf("thermometer still online")
+	}
+
+	// переименование и удаление
+	_ = cli.Publish("z2m/bridge/devices", []byte(z2mLampRenamed), true)
+	d, ok := devices.Device("0xaa")
+	if !ok || d.Name() != "kitchen lamp" {
+		t.Fatalf("lamp not renamed: %v", d)
+	}
+	if _, ok := devices.Device("0xbb"); ok {
+		t.Errorf("removed thermometer still bound")
+	}
+	if dbDevice(t, db, "0xbb").Online {
+		t.Errorf("removed thermometer still online")
+	}
+	if got := dbDevice(t, db, "0xaa"); got.Name != "kitchen lamp" || got.Capabilities != "state:set" {
+		t.Errorf("renamed lamp record %+v", got)
+	}
+
+	// новое имя слушается, старое нет
+	_ = cli.Publish("z2m/lamp", []byte(`{"state": "ON"}`), false)
+	if _, ok := devices.Values("0xaa")["state"]; ok {
+		t.Errorf("old topic still bound")
+	}
+	_ = cli.Publish("z2m/kitchen lamp", []byte(`{"state": "ON"}`), false)
+	if v := devices.Values("0xaa")["state"]; v.Str != "ON" {
+		t.Errorf("lamp state %v", v)
+	}
+
+	cmds := collect(cli, t, "z2m/kitchen lamp/set")
+	a, _ := devices.Actuator("0xaa")
+	_ = a.SetState(device.Values{"state": device.String("OFF")})
+	if len(*cmds) != 1 || (*cmds)[0].payload != `{"state":"OFF"}` {
+		t.Errorf("lamp commands %v", *cmds)
+	}
+}
+
+func TestHomeAssistant(t *testing.T) {
+	cli := NewMemoryClient()
+	devices := device.NewRegistry()
+	db := testDB(t)
+	virtual := []VirtualDevice{{ID: "guest_mode", Name: "Guest mode", Component: "switch"}}
+	if err := HomeAssistant(cli, devices, db, "homeassistant", "smarthome", virtual); err != nil {
+		t.Fatalf("homeassistant: %s", err)
+	}
+
+	// собственный анонс не подключается повторно
+	announced := collect(cli, t, "homeassistant/switch/smarthome/guest_mode/config")
+	if len(*announced) != 1 {
+		t.Fatalf("virtual device not announced: %v", *announced)
+	}
+	if len(devices.Devices()) != 1 {
+		t.Errorf("devices %v, want only virtual", devices.Devices())
+	}
+
+	// добавление, в том числе сокращённые ключи и шаблон значения
+	_ = cli.Publish("homeassistant/switch/plug/config", []byte(
+		`{"~": "tasmota/plug", "name": "Plug", "uniq_id": "plug_1", "stat_t": "~/POWER", "cmd_t": "~/cmnd/POWER"}`), true)
+	_ = cli.Publish("homeassistant/sensor/node/temp/config", []byte(
+		`{"name": "Temp", "state_topic": "node/sensor", "unit_of_measurement": "°C", "value_template": "{{ value_json.temperature }}"}`), true)
+
+	plug, ok := devices.Actuator("plug_1")
+	if !ok || plug.Name() != "Plug" {
+		t.Fatalf("plug not bound: %v", plug)
+	}
+	if _, ok := devices.Sensor("sensor_node_temp"); !ok {
+		t.Fatalf("sensor not bound")
+	}
+	if got := dbDevice(t, db, "plug_1"); got.Source != SourceHomeAssistant || !got.Online {
+		t.Errorf("plug record %+v", got)
+	}
+
+	_ = cli.Publish("tasmota/plug/POWER", []byte("ON"), false)
+	if v := devices.Values("plug_1")["state"]; v.Type != device.TypeBool || !v.Bool {
+		t.Errorf("plug state %v", v)
+	}
+	_ = cli.Publish("node/sensor", []byte(`{"temperature": 23.5}`), false)
+	if v := devices.Values("sensor_node_temp")["temperature"]; v.Num != 23.5 || v.Unit != "°C" {
+		t.Errorf("sensor value %v", v)
+	}
+
+	cmds := collect(cli, t, "tasmota/plug/cmnd/POWER")
+	_ = plug.SetState(device.Values{"state": device.Bool(false)})
+	if len(*cmds) != 1 || (*cmds)[0].payload != "OFF" {
+		t.Errorf("plug commands %v", *cmds)
+	}
+
+	// переименование
+	_ = cli.Publish("homeassistant/switch/plug/config", []byte(
+		`{"~": "tasmota/plug", "name": "Desk plug", "uniq_id": "plug_1", "stat_t": "~/POWER", "cmd_t": "~/cmnd/POWER"}`), true)
+	if d, ok := devices.Device("plug_1"); !ok || d.Name() != "Desk plug" {
+		t.Errorf("plug not renamed: %v", d)
+	}
+
+	// удаление пустым retained сообщением
+	_ = cli.Publish("homeassistant/switch/plug/config", nil, true)
+	if _, ok := devices.Device("plug_1"); ok {
+		t.Errorf("removed plug still bound")
+	}
+	if dbDevice(t, db, "plug_1").Online {
+		t.Errorf("removed plug still online")
+	}
+
+	// неподдерживаемый шаблон пропускается
+	_ = cli.Publish("homeassistant/sensor/x/config", []byte(
+		`{"state_topic": "x", "value_template": "{{ value | float }}"}`), true)
+	if _, ok := devices.Device("sensor_x"); ok {
+		t.Errorf("unsupported template bound")
+	}
+
+	// одинаковые узел и объект у разных компонентов не перезаписывают друг друга
+	_ = cli.Publish("homeassistant/switch/node/temp/config", []byte(
+		`{"name": "Heater", "state_topic": "node/heater", "command_topic": "node/heater/set"}`), true)
+	if _, ok := devices.Actuator("switch_node_temp"); !ok {
+		t.Errorf("switch with the sensor's node and object not bound")
+	}
+	if _, ok := devices.Sensor("sensor_node_temp"); !ok {
+		t.Errorf("sensor replaced by a switch with the same node and object")
+	}
+
+	// виртуальный выключатель подтверждает команду в retained топик состояния
+	_ = cli.Publish("smarthome/guest_mode/set", []byte("ON"), false)
+	if v := devices.Values("guest_mode")["state"]; !v.Bool {
+		t.Errorf("virtual state %v", v)
+	}
+	state := collect(cli, t, "smarthome/guest_mode/state")
+	if len(*state) != 1 || (*state)[0].payload != "ON" {
+		t.Errorf("virtual retained state %v", *state)
+	}
+}
@@ -0,0 +1,292 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const SourceHomeAssistant = "homeassistant"
+
+const (
+	haComponentSwitch = "switch"
+	haPayloadOn       = "ON"
+	haPayloadOff      = "OFF"
+)
+
+var haValueJSONTpl = regexp.MustCompile(`^\{\{\s*value_json(?:\.(\w+)|\[['"](\w+)['"]\])\s*\}\}$`)
+
+// haConfig поля discovery-сообщения, которые мы понимаем. Поддерживаются и сокращённые ключи
+type haConfig struct {
+	Base          string `json:"~"`
+	Name          string `json:"name"`
+	UniqueID      string `json:"unique_id"`
+	UniqID        string `json:"uniq_id"`
+	StateTopic    string `json:"state_topic"`
+	StatT         string `json:"stat_t"`
+	CommandTopic  string `json:"command_topic"`
+	CmdT          string `json:"cmd_t"`
+	Unit          string `json:"unit_of_measurement"`
+	UnitOfMeas    string `json:"unit_of_meas"`
+	ValueTemplate string `json:"value_template"`
+	ValTpl        string `json:"val_tpl"`
+	PayloadOn     string `json:"payload_on"`
+	PlOn          string `json:"pl_on"`
+	PayloadOff    string `json:"payload_off"`
+	PlOff         string `json:"pl_off"`
+	DeviceClass   string `json:"device_class"`
+	DevCla        string `json:"dev_cla"`
+}
+
+type haDiscoveryMsg struct {
+	Name         string   `json:"name"`
+	UniqueID     string   `json:"unique_id"`
+	StateTopic   string   `json:"state_topic"`
+	CommandTopic string   `json:"command_topic"`
+	PayloadOn    string   `json:"payload_on"`
+	PayloadOff   string   `json:"payload_off"`
+	Device       haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+type VirtualDevice struct {
+	ID        string
+	Name      string
+	Component string
+}
+
+type homeAssistant struct {
+	cli     Client
+	devices *device.Registry
+	db      *gorm.DB
+	prefix  string
+	node    string
+	bound   map[string]Binding
+	mtx     sync.Mutex
+}
+
+// HomeAssistant подключает устройства из homeassistant discovery и публикует discovery для виртуальных устройств
+func HomeAssistant(cli Client, devices *device.Registry, db *gorm.DB, prefix string, node string, virtual []VirtualDevice) error {
+	ha := &homeAssistant{
+		cli:     cli,
+		devices: devices,
+		db:      db,
+		prefix:  prefix,
+		node:    node,
+		bound:   make(map[string]Binding),
+	}
+
+	for _, vd := range virtual {
+		err := ha.virtual(vd)
+		if err != nil {
+			return fmt.Errorf("virtual device %s: %w", vd.ID, err)
+		}
+	}
+
+	for _, t := range []string{ha.prefix + "/+/+/config", ha.prefix + "/+/+/+/config"} {
+		err := cli.Subscribe(t, ha.onConfig)
+		if err != nil {
+			return fmt.Errorf("discovery subscribe to %s failed: %w", t, err)
+		}
+	}
+	return nil
+}
+
+func (ha *homeAssistant) onConfig(topic string, payload []byte) {
+	// <prefix>/<component>/[<node_id>/]<object_id>/config
+	parts := strings.Split(strings.TrimPrefix(topic, ha.prefix+"/"), "/")
+	if len(parts) == 4 && parts[1] == ha.node {
+		// наше собственное сообщение
+		return
+	}
+	// компонент входит в id: sensor/<node>/<obj> и switch/<node>/<obj> это разные устройства
+	id := strings.Join(parts[:len(parts)-1], "_")
+
+	ha.mtx.Lock()
+	defer ha.mtx.Unlock()
+
+	if len(payload) == 0 {
+		if b, ok := ha.bound[id]; ok {
+			log.Infof("[HA] device %s removed", id)
+			unbind(ha.cli, ha.devices, b)
+			delete(ha.bound, id)
+			res := ha.db.Model(&orm.Device{}).Where("uid = ?", b.ID).Update("online", false)
+			if res.Error != nil {
+				log.Errorf("[HA] marking device %s offline failed: %s", b.ID, res.Error)
+			}
+		}
+		return
+	}
+
+	c := haConfig{}
+	err := json.Unmarshal(payload, &c)
+	if err != nil {
+		log.Errorf("[HA] bad discovery payload in %s: %s", topic, err)
+		return
+	}
+
+	b, err := c.binding(id)
+	if err != nil {
+		log.Errorf("[HA] unsupported discovery payload in %s: %s", topic, err)
+		return
+	}
+
+	old, ok := ha.bound[id]
+	if ok && old == b {
+		return
+	}
+	if ok {
+		unbind(ha.cli, ha.devices, old)
+		delete(ha.bound, id)
+	}
+
+	_, err = bind(ha.cli, ha.devices, b)
+	if err != nil {
+		log.Errorf("[HA] binding %s failed: %s", id, err)
+		return
+	}
+	ha.bound[id] = b
+	log.Infof("[HA] device %s [%s] bound", b.ID, b.Name)
+
+	res := ha.db.Where(orm.Device{UID: b.ID}).
+		Assign(orm.Device{Source: SourceHomeAssistant, Online: true}).
+		FirstOrCreate(&orm.Device{})
+	if res.Error != nil {
+		log.Errorf("[HA] saving device %s failed: %s", b.ID, res.Error)
+	}
+}
+
+func (c haConfig) binding(id string) (Binding, error) {
+	uid := first(c.UniqueID, c.UniqID)
+	if uid != "" {
+		id = uid
+	}
+
+	b := Binding{
+		ID:           id,
+		Name:         first(c.Name, id),
+		StateTopic:   c.topic(first(c.StateTopic, c.StatT)),
+		CommandTopic: c.topic(first(c.CommandTopic, c.CmdT)),
+		Unit:         first(c.Unit, c.UnitOfMeas),
+		Property:     first(c.DeviceClass, c.DevCla, defaultProperty),
+		Format:       FormatRaw,
+	}
+
+	tpl := strings.TrimSpace(first(c.ValueTemplate, c.ValTpl))
+	if tpl != "" {
+		m := haValueJSONTpl.FindStringSubmatch(tpl)
+		if m == nil {
+			return Binding{}, fmt.Errorf("value template %q is not supported", tpl)
+		}
+		b.Property = first(m[1], m[2])
+	}
+
+	if b.CommandTopic != "" || c.PayloadOn != "" || c.PlOn != "" {
+		b.PayloadOn = first(c.PayloadOn, c.PlOn, haPayloadOn)
+		b.PayloadOff = first(c.PayloadOff, c.PlOff, haPayloadOff)
+	}
+
+	if b.StateTopic == "" && b.CommandTopic == "" {
+		return Binding{}, fmt.Errorf("no state or command topic")
+	}
+	return b, nil
+}
+
+// topic раскрывает сокращение ~ в базовый топик
+func (c haConfig) topic(t string) string {
+	if c.Base == "" {
+		return t
+	}
+	if strings.HasPrefix(t, "~") {
+		return c.Base + t[1:]
+	}
+	if strings.HasSuffix(t, "~") {
+		return t[:len(t)-1] + c.Base
+	}
+	return t
+}
+
+// virtual регистрирует виртуальное устройство, которое хранит состояние в retained топике, и анонсирует его
+func (ha *homeAssistant) virtual(vd VirtualDevice) error {
+	if vd.Component != haComponentSwitch {
+		return fmt.Errorf("component %q is not supported", vd.Component)
+	}
+
+	base := ha.node + "/" + vd.ID
+	b := Binding{
+		ID:           vd.ID,
+		Name:         first(vd.Name, vd.ID),
+		StateTopic:   base + "/state",
+		CommandTopic: base + "/set",
+		Format:       FormatRaw,
+		PayloadOn:    haPayloadOn,
+		PayloadOff:   haPayloadOff,
+	}
+
+	s, err := bind(ha.cli, ha.devices, b)
+	if err != nil {
+		return err
+	}
+
+	// команды от других систем применяем и подтверждаем в топик состояния
+	err = ha.cli.Subscribe(b.CommandTopic, func(_ string, payload []byte) {
+		v, ok := b.boolPayload(payload)
+		if !ok {
+			log.Warnf("[HA] virtual %s: unknown command %q", vd.ID, payload)
+			return
+		}
+		err := ha.cli.Publish(b.StateTopic, []byte(b.raw(v)), true)
+		if err != nil {
+			log.Errorf("[HA] virtual %s: state publish failed: %s", vd.ID, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe to %s failed: %w", b.CommandTopic, err)
+	}
+
+	msg, err := json.Marshal(haDiscoveryMsg{
+		Name:         s.b.Name,
+		UniqueID:     ha.node + "_" + vd.ID,
+		StateTopic:   b.StateTopic,
+		CommandTopic: b.CommandTopic,
+		PayloadOn:    b.PayloadOn,
+		PayloadOff:   b.PayloadOff,
+		Device: haDevice{
+			Identifiers:  []string{ha.node},
+			Name:         ha.node,
+			Manufacturer: "zy-smart-home",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("discovery marshal failed: %w", err)
+	}
+
+	t := fmt.Sprintf("%s/%s/%s/%s/config", ha.prefix, vd.Component, ha.node, vd.ID)
+	err = ha.cli.Publish(t, msg, true)
+	if err != nil {
+		return fmt.Errorf("discovery publish failed: %w", err)
+	}
+	log.Infof("[HA] virtual device %s announced in %s", vd.ID, t)
+	return nil
+}
+
+func first(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package mqtt
+
+import (
+	"strings"
+	"sync"
+)
+
+// memoryClient брокер внутри процесса, для тестов и запуска без внешнего брокера.
+// Поддерживает wildcard-подписки + и # и retained сообщения
+type memoryClient struct {
+	subs     map[string]func(topic string, payload []byte)
+	retained map[string][]byte
+	mtx      sync.Mutex
+}
+
+func NewMemoryClient() *memoryClient {
+	return &memoryClient{
+		subs:     make(map[string]func(topic string, payload []byte)),
+		retained: make(map[string][]byte),
+	}
+}
+
+func (m *memoryClient) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	m.mtx.Lock()
+	m.subs[topic] = handler
+	var retained [][2]string
+	for t, p := range m.retained {
+		if Match(topic, t) {
+			retained = append(retained, [2]string{t, string(p)})
+		}
+	}
+	m.mtx.Unlock()
+
+	for _, r := range retained {
+		handler(r[0], []byte(r[1]))
+	}
+	return nil
+}
+
+func (m *memoryClient) Unsubscribe(topic string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.subs, topic)
+	return nil
+}
+
+func (m *memoryClient) Publish(topic string, payload []byte, retain bool) error {
+	m.mtx.Lock()
+	if retain {
+		if len(payload) == 0 {
+			delete(m.retained, topic)
+		} else {
+			m.retained[topic] = payload
+		}
+	}
+	var handlers []func(topic string, payload []byte)
+	for filter, h := range m.subs {
+		if Match(filter, topic) {
+			handlers = append(handlers, h)
+		}
+	}
+	m.mtx.Unlock()
+
+	for _, h := range handlers {
+		h(topic, payload)
+	}
+	return nil
+}
+
+// Match проверяет соответствие топика фильтру подписки
+func Match(filter, topic string) bool {
+	fp := strings.Split(filter, "/")
+	tp := strings.Split(topic, "/")
+	for i, f := range fp {
+		if f == "#" {
+			return true
+		}
+		if i >= len(tp) {
+			return false
+		}
+		if f != "+" && f != tp[i] {
+			return false
+		}
+	}
+	return len(fp) == len(tp)
+}
@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"a/b/c", "a/b/c", true},
+		{"a/b/c", "a/b", false},
+		{"a/b", "a/b/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/+/c", "a/b/d", false},
+		{"a/+", "a/b/c", false},
+		{"+/+", "a/b", true},
+		{"a/#", "a/b/c", true},
+		{"a/#", "a", true},
+		{"#", "a/b", true},
+		{"a/+/#", "a/b/c/d", true},
+		{"b/#", "a/b", false},
+	}
+	for _, c := range cases {
+		if got := Match(c.filter, c.topic); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.filter, c.topic, got, c.want)
+		}
+	}
+}
+
+type received struct {
+	topic   string
+	payload string
+}
+
+func collect(cli Client, t *testing.T, filter string) *[]received {
+	var res []received
+	err := cli.Subscribe(filter, func(topic string, payload []byte) {
+		res = append(res, received{topic, string(payload)})
+	})
+	if err != nil {
+		t.Fatalf("subscribe to %s: %s", filter, err)
+	}
+	return &res
+}
+
+func TestMemoryClientWildcards(t *testing.T) {
+	cli := NewMemoryClient()
+	plus := collect(cli, t, "home/+/temp")
+	hash := collect(cli, t, "home/#")
+
+	_ = cli.Publish("home/kitchen/temp", []byte("21"), false)
+	_ = cli.Publish("home/kitchen/humidity", []byte("40"), false)
+	_ = cli.Publish("garden/temp", []byte("10"), false)
+
+	if len(*plus) != 1 || (*plus)[0] != (received{"home/kitchen/temp", "21"}) {
+		t.Errorf("home/+/temp got %v", *plus)
+	}
+	if len(*hash) != 2 {
+		t.Errorf("home/# got %v", *hash)
+	}
+
+	_ = cli.Unsubscribe("home/#")
+	_ = cli.Publish("home/hall/temp", []byte("19"), false)
+	if len(*hash) != 2 {
+		t.Errorf("unsubscribed handler called: %v", *hash)
+	}
+	if len(*plus) != 2 {
+		t.Errorf("home/+/temp got %v", *plus)
+	}
+}
+
+func TestMemoryClientRetained(t *testing.T) {
+	cli := NewMemoryClient()
+	_ = cli.Publish("dev/a/state", []byte("ON"), true)
+	_ = cli.Publish("dev/b/state", []byte("OFF"), true)
+	_ = cli.Publish("dev/c/state", []byte("ON"), false)
+	// пустой payload удаляет retained сообщение
+	_ = cli.Publish("dev/b/state", nil, true)
+
+	got := collect(cli, t, "dev/+/state")
+	if len(*got) != 1 || (*got)[0] != (received{"dev/a/state", "ON"}) {
+		t.Errorf("retained delivery got %v", *got)
+	}
+
+	_ = cli.Publish("dev/a/state", []byte("OFF"), true)
+	again := collect(cli, t, "dev/a/state")
+	if len(*again) != 1 || (*again)[0].payload != "OFF" {
+		t.Errorf("retained message not replaced: %v", *again)
+	}
+}
@@ -0,0 +1,118 @@
+package mqtt
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/signal"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+const opTimeout = time.Second * 10
+const disconnectQuiesce = 250 // ms
+
+type Config interface {
+	Broker() string
+	ClientID() string
+	Username() string
+	Password() string
+}
+
+// Client минимальный набор операций с брокером, которым пользуются устройства.
+// Позволяет подменить брокер в тестах
+type Client interface {
+	Subscribe(topic string, handler func(topic string, payload []byte)) error
+	Unsubscribe(topic string) error
+	Publish(topic string, payload []byte, retain bool) error
+}
+
+type client struct {
+	cli  paho.Client
+	subs map[string]func(topic string, payload []byte)
+	mtx  sync.Mutex
+}
+
+func Connect(cfg Config) (*client, error) {
+	log.Infof("[MQTT] connecting to %s", cfg.Broker())
+
+	c := &client{subs: make(map[string]func(topic string, payload []byte))}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker()).
+		SetClientID(cfg.ClientID()).
+		SetUsername(cfg.Username()).
+		SetPassword(cfg.Password()).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(false).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Errorf("[MQTT] connection lost: %s", err)
+		})
+	c.cli = paho.NewClient(opts)
+
+	t := c.cli.Connect()
+	if !t.WaitTimeout(opTimeout) {
+		log.Warnf("[MQTT] broker %s is not reachable yet, retrying in background", cfg.Broker())
+	} else if t.Error() != nil {
+		return nil, fmt.Errorf("mqtt connect failed: %w", t.Error())
+	}
+
+	signal.OnShutdown(func() error {
+		log.Info("[MQTT] Disconnecting")
+		c.cli.Disconnect(disconnectQuiesce)
+		return nil
+	})
+	return c, nil
+}
+
+func (c *client) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	c.mtx.Lock()
+	c.subs[topic] = handler
+	c.mtx.Unlock()
+
+	if !c.cli.IsConnectionOpen() {
+		// подпишемся в onConnect
+		return nil
+	}
+	return c.subscribe(topic, handler)
+}
+
+func (c *client) Unsubscribe(topic string) error {
+	c.mtx.Lock()
+	delete(c.subs, topic)
+	c.mtx.Unlock()
+
+	return wait(c.cli.Unsubscribe(topic))
+}
+
+func (c *client) Publish(topic string, payload []byte, retain bool) error {
+	return wait(c.cli.Publish(topic, 1, retain, payload))
+}
+
+func (c *client) subscribe(topic string, handler func(topic string, payload []byte)) error {
+	return wait(c.cli.Subscribe(topic, 1, func(_ paho.Client, m paho.Message) {
+		handler(m.Topic(), m.Payload())
+	}))
+}
+
+func (c *client) onConnect(_ paho.Client) {
+	log.Info("[MQTT] connected")
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for topic, handler := range c.subs {
+		if err := c.subscribe(topic, handler); err != nil {
+			log.Errorf("[MQTT] subscribe to %s failed: %s", topic, err)
+		}
+	}
+}
+
+func wait(t paho.Token) error {
+	if !t.WaitTimeout(opTimeout) {
+		return fmt.Errorf("mqtt operation timed out")
+	}
+	return t.Error()
+}
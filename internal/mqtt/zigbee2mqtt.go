@@ -0,0 +1,249 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const SourceZigbee2MQTT = "zigbee2mqtt"
+
+const (
+	z2mAccessSet        = 2
+	z2mTypeCoordinator  = "Coordinator"
+	z2mAvailabilityOn   = "online"
+	z2mCapabilitySetSfx = ":set"
+)
+
+type z2mDevice struct {
+	IEEEAddress  string `json:"ieee_address"`
+	FriendlyName string `json:"friendly_name"`
+	Type         string `json:"type"`
+	Supported    bool   `json:"supported"`
+	Definition   *struct {
+		Model       string          `json:"model"`
+		Vendor      string          `json:"vendor"`
+		Description string          `json:"description"`
+		Exposes     json.RawMessage `json:"exposes"`
+	} `json:"definition"`
+}
+
+type z2mExpose struct {
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Property string      `json:"property"`
+	Access   int         `json:"access"`
+	Unit     string      `json:"unit"`
+	Features []z2mExpose `json:"features"`
+}
+
+type zigbee2mqtt struct {
+	cli     Client
+	devices *device.Registry
+	db      *gorm.DB
+	base    string
+	bound   map[string]Binding
+	mtx     sync.Mutex
+}
+
+// Zigbee2MQTT зеркалит в реестр и БД список устройств из <base>/bridge/devices
+func Zigbee2MQTT(cli Client, devices *device.Registry, db *gorm.DB, baseTopic string) error {
+	z := &zigbee2mqtt{
+		cli:     cli,
+		devices: devices,
+		db:      db,
+		base:    baseTopic,
+		bound:   make(map[string]Binding),
+	}
+
+	err := cli.Subscribe(z.base+"/bridge/devices", z.onDevices)
+	if err != nil {
+		return fmt.Errorf("zigbee2mqtt subscribe failed: %w", err)
+	}
+	err = cli.Subscribe(z.base+"/+/availability", z.onAvailability)
+	if err != nil {
+		return fmt.Errorf("zigbee2mqtt availability subscribe failed: %w", err)
+	}
+	return nil
+}
+
+func (z *zigbee2mqtt) onDevices(topic string, payload []byte) {
+	var list []z2mDevice
+	err := json.Unmarshal(payload, &list)
+	if err != nil {
+		log.Errorf("[Z2M] bad devices payload in %s: %s", topic, err)
+		return
+	}
+
+	z.mtx.Lock()
+	defer z.mtx.Unlock()
+
+	seen := make(map[string]bool, len(list))
+	for _, zd := range list {
+		if zd.Type == z2mTypeCoordinator || zd.IEEEAddress == "" {
+			continue
+		}
+		seen[zd.IEEEAddress] = true
+
+		err := z.upsert(zd)
+		if err != nil {
+			log.Errorf("[Z2M] device %s update failed: %s", zd.IEEEAddress, err)
+		}
+	}
+
+	for id, b := range z.bound {
+		if seen[id] {
+			continue
+		}
+		log.Infof("[Z2M] device %s [%s] left the bridge", id, b.Name)
+		unbind(z.cli, z.devices, b)
+		delete(z.bound, id)
+	}
+
+	res := z.db.Model(&orm.Device{}).
+		Where("source = ? AND uid NOT IN ?", SourceZigbee2MQTT, keys(seen)).
+		Update("online", false)
+	if res.Error != nil {
+		log.Errorf("[Z2M] marking missing devices offline failed: %s", res.Error)
+	}
+}
+
+func (z *zigbee2mqtt) upsert(zd z2mDevice) error {
+	rec := orm.Device{
+		Name:   zd.FriendlyName,
+		Source: SourceZigbee2MQTT,
+	}
+
+	var exposes []z2mExpose
+	if zd.Definition != nil {
+		rec.ModelID = zd.Definition.Model
+		rec.Vendor = zd.Definition.Vendor
+		rec.Exposes = string(zd.Definition.Exposes)
+
+		err := json.Unmarshal(zd.Definition.Exposes, &exposes)
+		if err != nil {
+			return fmt.Errorf("exposes decode failed: %w", err)
+		}
+	}
+	caps, settable := capabilities(exposes)
+	rec.Capabilities = strings.Join(caps, ",")
+	if settable {
+		rec.Kind = device.KindBoth
+	} else {
+		rec.Kind = device.KindSensor
+	}
+
+	// map, чтобы обнулившиеся поля тоже обновились
+	res := z.db.Where(orm.Device{UID: zd.IEEEAddress}).
+		Assign(map[string]any{
+			"name":         rec.Name,
+			"kind":         rec.Kind,
+			"source":       rec.Source,
+			"model_id":     rec.ModelID,
+			"vendor":       rec.Vendor,
+			"exposes":      rec.Exposes,
+			"capabilities": rec.Capabilities,
+			"online":       true,
+		}).
+		FirstOrCreate(&orm.Device{})
+	if res.Error != nil {
+		return fmt.Errorf("db upsert failed: %w", res.Error)
+	}
+
+	b := Binding{
+		ID:         zd.IEEEAddress,
+		Name:       zd.FriendlyName,
+		StateTopic: z.base + "/" + zd.FriendlyName,
+		Format:     FormatJSON,
+	}
+	if settable {
+		b.CommandTopic = b.StateTopic + "/set"
+	}
+
+	old, ok := z.bound[zd.IEEEAddress]
+	if ok && old == b {
+		return nil
+	}
+	if ok {
+		// переименовано или сменился набор возможностей
+		unbind(z.cli, z.devices, old)
+		delete(z.bound, zd.IEEEAddress)
+	}
+
+	_, err := bind(z.cli, z.devices, b)
+	if err != nil {
+		return err
+	}
+	z.bound[zd.IEEEAddress] = b
+	log.Infof("[Z2M] device %s [%s] %s bound", zd.IEEEAddress, zd.FriendlyName, rec.ModelID)
+	return nil
+}
+
+func (z *zigbee2mqtt) onAvailability(topic string, payload []byte) {
+	name := strings.TrimSuffix(strings.TrimPrefix(topic, z.base+"/"), "/availability")
+	if name == "bridge" {
+		return
+	}
+
+	// z2m шлёт либо {"state":"online"}, либо просто online
+	state := strings.TrimSpace(string(payload))
+	obj := struct {
+		State string `json:"state"`
+	}{}
+	if json.Unmarshal(payload, &obj) == nil {
+		state = obj.State
+	}
+
+	res := z.db.Model(&orm.Device{}).
+		Where("source = ? AND name = ?", SourceZigbee2MQTT, name).
+		Update("online", state == z2mAvailabilityOn)
+	if res.Error != nil {
+		log.Errorf("[Z2M] availability update of %s failed: %s", name, res.Error)
+	}
+}
+
+// capabilities возвращает отсортированный список свойств устройства, settable-свойства помечены суффиксом :set
+func capabilities(exposes []z2mExpose) ([]string, bool) {
+	set := map[string]bool{}
+	var walk func(list []z2mExpose)
+	walk = func(list []z2mExpose) {
+		for _, e := range list {
+			if e.Property != "" {
+				set[e.Property] = set[e.Property] || e.Access&z2mAccessSet != 0
+			}
+			walk(e.Features)
+		}
+	}
+	walk(exposes)
+
+	settable := false
+	res := make([]string, 0, len(set))
+	for p, s := range set {
+		if s {
+			settable = true
+			p += z2mCapabilitySetSfx
+		}
+		res = append(res, p)
+	}
+	sort.Strings(res)
+	return res, settable
+}
+
+func keys(m map[string]bool) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	if len(res) == 0 {
+		// NOT IN с пустым списком sqlite не принимает
+		res = append(res, "")
+	}
+	return res
+}
@@ -0,0 +1,25 @@
+package orm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Alert struct {
+	gorm.Model
+	ChatID   int64 `gorm:"index"`
+	DeviceID string
+	Property string
+	Op       string
+	// Threshold значение в json
+	Threshold  string
+	For        time.Duration
+	Hysteresis float64
+	Renotify   time.Duration
+
+	// Since когда условие стало выполняться, пусто если не выполняется
+	Since        time.Time
+	Active       bool
+	LastNotified time.Time
+}
@@ -0,0 +1,17 @@
+package orm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChatSession авторизованная сессия чата, переживающая перезапуск бота
+type ChatSession struct {
+	gorm.Model
+	ChatID    int64 `gorm:"uniqueIndex"`
+	UserID    uint
+	User      User
+	LoginAt   time.Time
+	ExpiresAt time.Time
+}
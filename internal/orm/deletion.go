@@ -0,0 +1,15 @@
+package orm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Deletion отложенное удаление сообщения с секретом. Удаляется, когда сообщение удалено
+type Deletion struct {
+	gorm.Model
+	ChatID    int64
+	MessageID int
+	At        time.Time
+}
@@ -0,0 +1,24 @@
+package orm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Device struct {
+	gorm.Model
+	UID      string `gorm:"uniqueIndex"`
+	Name     string
+	Kind     string
+	RoomID   *uint
+	Room     *Room
+	LastSeen time.Time
+	// Source откуда устройство появилось (zigbee2mqtt, ...), пусто для заданных в конфиге
+	Source       string
+	ModelID      string
+	Vendor       string
+	Exposes      string
+	Capabilities string
+	Online       bool
+}
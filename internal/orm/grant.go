@@ -0,0 +1,13 @@
+package orm
+
+import "gorm.io/gorm"
+
+// Grant доступ пользователя к устройству или ко всем устройствам комнаты
+type Grant struct {
+	gorm.Model
+	UserID   uint `gorm:"index"`
+	DeviceID string
+	RoomID   *uint
+	Room     *Room
+	Level    string
+}
@@ -0,0 +1,18 @@
+package orm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Job struct {
+	gorm.Model
+	Name string `gorm:"uniqueIndex"`
+	// Spec cron выражение или sunrise/sunset со смещением
+	Spec    string
+	Actions string
+	Enabled bool
+	ChatID  int64
+	LastRun time.Time
+}
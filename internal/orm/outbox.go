@@ -0,0 +1,12 @@
+package orm
+
+import "gorm.io/gorm"
+
+// Outbox уведомление в Telegram, ещё не доставленное адресату. Удаляется после отправки
+type Outbox struct {
+	gorm.Model
+	ChatID      int64
+	Text        string
+	ParseMode   string
+	ReplyMarkup string
+}
@@ -0,0 +1,17 @@
+package orm
+
+import "time"
+
+// ReadingRollup агрегат числовых значений свойства за интервал Bucket..Bucket+Resolution
+type ReadingRollup struct {
+	ID         uint      `gorm:"primarykey"`
+	DeviceID   uint      `gorm:"uniqueIndex:idx_rollup_key"`
+	Property   string    `gorm:"uniqueIndex:idx_rollup_key"`
+	Resolution string    `gorm:"uniqueIndex:idx_rollup_key;index:idx_rollup_resolution_bucket"`
+	Bucket     time.Time `gorm:"uniqueIndex:idx_rollup_key;index:idx_rollup_resolution_bucket"`
+	Unit       string
+	Min        float64
+	Max        float64
+	Avg        float64
+	Count      int
+}
@@ -0,0 +1,15 @@
+package orm
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCode одноразовый код восстановления доступа, хранится только хеш
+type RecoveryCode struct {
+	gorm.Model
+	UserID uint `gorm:"index"`
+	Hash   string
+	UsedAt *time.Time
+}
@@ -0,0 +1,9 @@
+package orm
+
+import "gorm.io/gorm"
+
+type Room struct {
+	gorm.Model
+	Name    string `gorm:"uniqueIndex"`
+	Devices []Device
+}
@@ -0,0 +1,13 @@
+package orm
+
+import "gorm.io/gorm"
+
+type Rule struct {
+	gorm.Model
+	Name    string `gorm:"uniqueIndex"`
+	Enabled bool
+	// Spec json с триггером, условиями и действиями правила
+	Spec string
+	// ChatID чат владельца, туда уходят уведомления без явно указанного чата
+	ChatID int64
+}
@@ -0,0 +1,19 @@
+package orm
+
+import "gorm.io/gorm"
+
+type Scene struct {
+	gorm.Model
+	Name   string `gorm:"uniqueIndex"`
+	ChatID int64
+	States []SceneState
+}
+
+type SceneState struct {
+	ID       uint `gorm:"primarykey"`
+	SceneID  uint `gorm:"index"`
+	DeviceID string
+	Property string
+	// Value значение в json
+	Value string
+}
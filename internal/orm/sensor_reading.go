@@ -0,0 +1,15 @@
+package orm
+
+import "time"
+
+type SensorReading struct {
+	ID       uint `gorm:"primarykey"`
+	DeviceID uint `gorm:"index:idx_reading_device_time"`
+	Property string
+	Type     int
+	Num      float64
+	Bool     bool
+	Str      string
+	Unit     string
+	Time     time.Time `gorm:"index:idx_reading_device_time"`
+}
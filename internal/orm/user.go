@@ -1,10 +1,32 @@
 package orm
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// статусы регистрации, пустой статус у пользователей, созданных до появления подтверждения
+const (
+	UserPending  = "pending"
+	UserApproved = "approved"
+	UserRejected = "rejected"
+)
 
 type User struct {
 	gorm.Model
 	Login  string
 	OtpKey string
 	Role   UserRole
+	// Blocked заблокированный пользователь не может авторизоваться
+	Blocked bool
+	// ChatID чат, из которого пользователь регистрировался или последний раз авторизовался
+	ChatID    int64
+	Status    string
+	DecidedBy string
+	DecidedAt *time.Time
+	// LastOtpStep шаг TOTP последнего принятого кода, коды этого и более ранних шагов повторно не принимаются
+	LastOtpStep  int64
+	FailedLogins int
+	LockedUntil  *time.Time
 }
@@ -0,0 +1,48 @@
+// Package reqid идентификаторы запросов, по которым ответ пользователю находится в логах
+package reqid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Field поле записи лога с идентификатором запроса
+const Field = "request_id"
+
+type ctxKey struct{}
+
+func New() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// From идентификатор запроса из контекста, пустой если его нет
+func From(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Hook добавляет идентификатор запроса в записи, сделанные через log.WithContext
+type Hook struct{}
+
+func (Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (Hook) Fire(e *log.Entry) error {
+	if id := From(e.Context); id != "" {
+		e.Data[Field] = id
+	}
+	return nil
+}
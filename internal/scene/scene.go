@@ -0,0 +1,229 @@
+package scene
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const defaultProperty = "state"
+
+var ErrSceneNotFound = errors.New("scene not found")
+
+// Result итог применения сцены к одному устройству
+type Result struct {
+	DeviceID   string
+	Err        error
+	RolledBack bool
+	// Skipped до устройства не дошли из-за ошибки на одном из предыдущих
+	Skipped bool
+}
+
+type scenes struct {
+	db      *gorm.DB
+	devices *device.Registry
+}
+
+func New(db *gorm.DB, devices *device.Registry) *scenes {
+	return &scenes{db: db, devices: devices}
+}
+
+func (s *scenes) Scenes(ctx context.Context) ([]orm.Scene, error) {
+	var recs []orm.Scene
+	res := s.db.WithContext(ctx).Preload("States").Order("name").Find(&recs)
+	return recs, res.Error
+}
+
+// Save запоминает текущее состояние актуаторов. Цель задаётся как device или device:prop1,prop2.
+// Без свойств сохраняется state, а если его нет, все известные свойства. Без целей сохраняются все актуаторы
+func (s *scenes) Save(ctx context.Context, name string, targets []string, chatID int64) (*orm.Scene, error) {
+	if len(targets) == 0 {
+		for _, d := range s.devices.Devices() {
+			if _, ok := d.(device.Actuator); ok {
+				targets = append(targets, d.ID())
+			}
+		}
+	}
+
+	rec := &orm.Scene{Name: name, ChatID: chatID}
+	for _, t := range targets {
+		id, props, _ := strings.Cut(t, ":")
+		act, ok := s.devices.Actuator(id)
+		if !ok {
+			return nil, fmt.Errorf("actuator %s not found", id)
+		}
+		state, err := act.State()
+		if err != nil {
+			return nil, fmt.Errorf("reading state of %s failed: %w", id, err)
+		}
+
+		var names []string
+		switch {
+		case props != "":
+			names = strings.Split(props, ",")
+		case hasKey(state, defaultProperty):
+			names = []string{defaultProperty}
+		default:
+			for p := range state {
+				names = append(names, p)
+			}
+			sort.Strings(names)
+		}
+
+		for _, p := range names {
+			v, ok := state[p]
+			if !ok {
+				return nil, fmt.Errorf("state of %s has no %s", id, p)
+			}
+			raw, err := json.Marshal(v.Raw())
+			if err != nil {
+				return nil, fmt.Errorf("marshal %s.%s failed: %w", id, p, err)
+			}
+			rec.States = append(rec.States, orm.SceneState{DeviceID: id, Property: p, Value: string(raw)})
+		}
+	}
+	if len(rec.States) == 0 {
+		return nil, fmt.Errorf("nothing to save")
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		old := &orm.Scene{}
+		res := tx.Where("name = ?", name).Limit(1).Find(old)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			if err := tx.Where("scene_id = ?", old.ID).Delete(&orm.SceneState{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(old).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(rec).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("saving scene failed: %w", err)
+	}
+	return rec, nil
+}
+
+func (s *scenes) Remove(ctx context.Context, name string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rec := &orm.Scene{}
+		res := tx.Where("name = ?", name).Limit(1).Find(rec)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrSceneNotFound
+		}
+		if err := tx.Where("scene_id = ?", rec.ID).Delete(&orm.SceneState{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(rec).Error
+	})
+}
+
+// Apply применяет сцену целиком: если какое-то устройство не удалось перевести, уже изменённые возвращаются в прежнее состояние
+func (s *scenes) Apply(ctx context.Context, name string) ([]Result, error) {
+	rec := &orm.Scene{}
+	res := s.db.WithContext(ctx).Preload("States").Where("name = ?", name).Limit(1).Find(rec)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrSceneNotFound
+	}
+
+	// группируем по устройствам, сохраняя порядок
+	var order []string
+	targets := map[string]device.Values{}
+	for _, st := range rec.States {
+		var raw any
+		err := json.Unmarshal([]byte(st.Value), &raw)
+		if err != nil {
+			return nil, fmt.Errorf("scene %s: bad value of %s.%s: %w", name, st.DeviceID, st.Property, err)
+		}
+		v, err := device.FromRaw(raw)
+		if err != nil {
+			return nil, fmt.Errorf("scene %s: bad value of %s.%s: %w", name, st.DeviceID, st.Property, err)
+		}
+		if _, ok := targets[st.DeviceID]; !ok {
+			order = append(order, st.DeviceID)
+			targets[st.DeviceID] = device.Values{}
+		}
+		targets[st.DeviceID][st.Property] = v
+	}
+
+	results := make([]Result, 0, len(order))
+	prev := map[string]device.Values{}
+	failed := false
+	for _, id := range order {
+		r := Result{DeviceID: id}
+		if failed {
+			r.Skipped = true
+			results = append(results, r)
+			continue
+		}
+		act, ok := s.devices.Actuator(id)
+		if !ok {
+			r.Err = fmt.Errorf("actuator not found")
+		} else {
+			prev[id] = previous(act, targets[id])
+			r.Err = act.SetState(targets[id])
+		}
+		results = append(results, r)
+		failed = r.Err != nil
+	}
+
+	if !failed {
+		log.Infof("[Scene] %s applied", name)
+		return results, nil
+	}
+
+	log.Warnf("[Scene] %s failed, rolling back", name)
+	for i := range results {
+		r := &results[i]
+		if r.Err != nil || r.Skipped || len(prev[r.DeviceID]) == 0 {
+			continue
+		}
+		act, _ := s.devices.Actuator(r.DeviceID)
+		err := act.SetState(prev[r.DeviceID])
+		if err != nil {
+			log.Errorf("[Scene] %s: rollback of %s failed: %s", name, r.DeviceID, err)
+			r.Err = fmt.Errorf("rollback failed: %w", err)
+			continue
+		}
+		r.RolledBack = true
+	}
+	return results, nil
+}
+
+// previous возвращает текущие значения тех свойств, которые собираемся менять
+func previous(act device.Actuator, target device.Values) device.Values {
+	state, err := act.State()
+	if err != nil {
+		return nil
+	}
+	res := device.Values{}
+	for p := range target {
+		if v, ok := state[p]; ok {
+			res[p] = v
+		}
+	}
+	return res
+}
+
+func hasKey(vals device.Values, k string) bool {
+	_, ok := vals[k]
+	return ok
+}
@@ -0,0 +1,151 @@
+package scene
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testActuator struct {
+	id    string
+	state device.Values
+	fail  bool
+}
+
+func (a *testActuator) ID() string   { return a.id }
+func (a *testActuator) Name() string { return a.id }
+func (a *testActuator) State() (device.Values, error) {
+	res := device.Values{}
+	for k, v := range a.state {
+		res[k] = v
+	}
+	return res, nil
+}
+func (a *testActuator) SetState(state device.Values) error {
+	if a.fail {
+		return fmt.Errorf("device is offline")
+	}
+	for k, v := range state {
+		a.state[k] = v
+	}
+	return nil
+}
+
+func testScenes(t *testing.T, acts ...*testActuator) *scenes {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&orm.Scene{}, &orm.SceneState{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	devices := device.NewRegistry()
+	for _, a := range acts {
+		if err := devices.Add(a); err != nil {
+			t.Fatalf("add %s: %s", a.id, err)
+		}
+	}
+	return New(db, devices)
+}
+
+func lamp(id string, on bool) *testActuator {
+	return &testActuator{id: id, state: device.Values{"state": device.Bool(on), "brightness": device.Float(50, "")}}
+}
+
+func TestSaveApply(t *testing.T) {
+	a, b := lamp("a", true), lamp("b", false)
+	s := testScenes(t, a, b)
+
+	rec, err := s.Save(context.Background(), "evening", []string{"a", "b:brightness"}, 7)
+	if err != nil {
+		t.Fatalf("save: %s", err)
+	}
+	if len(rec.States) != 2 || rec.States[0].Property != "state" || rec.States[1].Property != "brightness" {
+		t.Errorf("saved states %+v", rec.States)
+	}
+	if _, err := s.Save(context.Background(), "bad", []string{"a:color"}, 7); err == nil {
+		t.Errorf("missing property saved")
+	}
+
+	a.state["state"] = device.Bool(false)
+	b.state["brightness"] = device.Float(10, "")
+	results, err := s.Apply(context.Background(), "evening")
+	if err != nil {
+		t.Fatalf("apply: %s", err)
+	}
+	for _, r := range results {
+		if r.Err != nil || r.Skipped || r.RolledBack {
+			t.Errorf("result %+v", r)
+		}
+	}
+	if !a.state["state"].Bool || b.state["brightness"].Num != 50 {
+		t.Errorf("states a %v b %v", a.state, b.state)
+	}
+
+	if _, err := s.Apply(context.Background(), "missing"); err != ErrSceneNotFound {
+		t.Errorf("missing scene: %v", err)
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	a, b, c := lamp("a", true), lamp("b", true), lamp("c", true)
+	s := testScenes(t, a, b, c)
+	if _, err := s.Save(context.Background(), "all", []string{"a", "b", "c"}, 7); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+
+	a.state["state"] = device.Bool(false)
+	c.state["state"] = device.Bool(false)
+	b.fail = true
+	results, err := s.Apply(context.Background(), "all")
+	if err != nil {
+		t.Fatalf("apply: %s", err)
+	}
+
+	want := []Result{
+		{DeviceID: "a", RolledBack: true},
+		{DeviceID: "b", Err: fmt.Errorf("device is offline")},
+		{DeviceID: "c", Skipped: true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results %+v, want every device", results)
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.DeviceID != w.DeviceID || r.RolledBack != w.RolledBack || r.Skipped != w.Skipped || (r.Err == nil) != (w.Err == nil) {
+			t.Errorf("result %d = %+v, want %+v", i, r, w)
+		}
+	}
+	if a.state["state"].Bool || c.state["state"].Bool {
+		t.Errorf("states not restored: a %v c %v", a.state, c.state)
+	}
+}
+
+// TestCancelledContext запросы идут в контексте команды и прерываются вместе с ней
+func TestCancelledContext(t *testing.T) {
+	s := testScenes(t, lamp("a", true))
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+
+	calls := map[string]func() error{
+		"scenes": func() error { _, err := s.Scenes(ctx); return err },
+		"save":   func() error { _, err := s.Save(ctx, "x", nil, 7); return err },
+		"apply":  func() error { _, err := s.Apply(ctx, "x"); return err },
+		"remove": func() error { return s.Remove(ctx, "x") },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: error %v, want %v", name, err, context.Canceled)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cronSearchYears = 8
+
+// cron стандартное 5-польное выражение: минута час день месяц день_недели
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 и 7 это воскресенье
+}
+
+func parseCron(expr string) (*cron, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression must have %d fields, got %d", len(cronFields), len(parts))
+	}
+
+	bits := make([]uint64, len(parts))
+	for i, p := range parts {
+		b, err := parseCronField(p, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron field %d %q: %w", i+1, p, err)
+		}
+		bits[i] = b
+	}
+
+	c := &cron{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	if !c.possible() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return c, nil
+}
+
+// possible проверяет, что выбранные дни месяца есть хотя бы в одном выбранном месяце
+func (c *cron) possible() bool {
+	if c.domAny || !c.dowAny {
+		return true
+	}
+	for m := 1; m <= 12; m++ {
+		if c.month&(1<<uint(m)) == 0 {
+			continue
+		}
+		// 29 февраля бывает
+		days := time.Date(2000, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		for d := 1; d <= days; d++ {
+			if c.dom&(1<<uint(d)) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rng = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q", item[i+1:])
+			}
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", bounds[0])
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q", bounds[1])
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("range %d-%d is out of %d-%d", lo, hi, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cron) match(t time.Time) bool {
+	return c.minute&(1<<uint(t.Minute())) != 0 &&
+		c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.month&(1<<uint(t.Month())) != 0 &&
+		c.day(t)
+}
+
+// next подбирает поля от месяца к минуте, пропуская целиком неподходящие месяцы, дни и часы
+func (c *cron) next(from time.Time) (time.Time, bool) {
+	t := from.Truncate(time.Minute).Add(time.Minute)
+	// 29 февраля может не быть до восьми лет подряд
+	end := t.AddDate(cronSearchYears, 0, 0)
+	loc := t.Location()
+	for t.Before(end) {
+		y, m, d := t.Date()
+		var n time.Time
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			n = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !c.day(t):
+			n = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			n = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			n = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+		// при переводе часов time.Date может вернуть ту же минуту
+		if !n.After(t) {
+			n = t.Add(time.Minute)
+		}
+		t = n
+	}
+	return time.Time{}, false
+}
+
+func (c *cron) day(t time.Time) bool {
+	domOk := c.dom&(1<<uint(t.Day())) != 0
+	dowOk := c.dow&(1<<uint(t.Weekday())) != 0
+	// как в классическом cron: если ограничены оба поля, достаточно совпадения любого
+	if !c.domAny && !c.dowAny {
+		return domOk || dowOk
+	}
+	return domOk && dowOk
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	cases := []struct {
+		expr string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"0 7 * * 1-5", true},
+		{"*/15 8-18 * * *", true},
+		{"0,30 * 1,15 * *", true},
+		{"5/20 * * * *", true},
+		{"0 0 * * 7", true},
+		{"0 0 29 2 *", true},
+		{"0 0 31 * *", true},
+		{"0 0 31 2 1", true},
+		{"0 0 31 2 *", false},
+		{"0 0 30,31 2 *", false},
+		{"0 0 31 4,6,9,11 *", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"a * * * *", false},
+		{"1-a * * * *", false},
+	}
+	for _, c := range cases {
+		_, err := parseCron(c.expr)
+		if (err == nil) != c.ok {
+			t.Errorf("parseCron(%q): error %v, want ok %v", c.expr, err, c.ok)
+		}
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	// 2023-06-05 понедельник
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatalf("bad time %q", s)
+		}
+		return tm
+	}
+	cases := []struct {
+		expr string
+		t    string
+		want bool
+	}{
+		{"0 7 * * 1-5", "2023-06-05 07:00", true},
+		{"0 7 * * 1-5", "2023-06-04 07:00", false},
+		{"0 7 * * 1-5", "2023-06-05 07:01", false},
+		{"*/15 * * * *", "2023-06-05 10:45", true},
+		{"*/15 * * * *", "2023-06-05 10:50", false},
+		{"0 0 * * 7", "2023-06-04 00:00", true},
+		{"0 0 * * 0", "2023-06-04 00:00", true},
+		// ограничены оба поля: достаточно любого
+		{"0 0 1 * 1", "2023-06-05 00:00", true},
+		{"0 0 1 * 1", "2023-06-01 00:00", true},
+		{"0 0 1 * 1", "2023-06-02 00:00", false},
+		{"0 0 1 * *", "2023-06-05 00:00", false},
+		{"0 12 * 1,7 *", "2023-06-05 12:00", false},
+	}
+	for _, c := range cases {
+		cr, err := parseCron(c.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %s", c.expr, err)
+		}
+		if got := cr.match(at(c.t)); got != c.want {
+			t.Errorf("%q at %s = %v, want %v", c.expr, c.t, got, c.want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no tzdata: %s", err)
+	}
+	cases := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2023-06-05 10:00:30", "2023-06-05 10:01"},
+		{"0 7 * * 1-5", "2023-06-05 07:00:00", "2023-06-06 07:00"},
+		{"0 7 * * 1-5", "2023-06-09 08:00:00", "2023-06-12 07:00"},
+		{"30 23 31 12 *", "2023-06-05 00:00:00", "2023-12-31 23:30"},
+		{"0 0 29 2 *", "2023-03-01 00:00:00", "2024-02-29 00:00"},
+		{"0 0 29 2 *", "2097-03-01 00:00:00", "2104-02-29 00:00"},
+		{"*/20 9-10 * * *", "2023-06-05 10:45:00", "2023-06-06 09:00"},
+		{"0 0 31 * *", "2023-04-15 00:00:00", "2023-05-31 00:00"},
+		// 02:30 не существует при переходе на летнее время
+		{"30 2 * * *", "2023-03-25 03:00:00", "2023-03-27 02:30"},
+		{"0 3 * * *", "2023-03-26 00:00:00", "2023-03-26 03:00"},
+	}
+	for _, c := range cases {
+		cr, err := parseCron(c.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %s", c.expr, err)
+		}
+		from, _ := time.ParseInLocation("2006-01-02 15:04:05", c.from, loc)
+		got, ok := cr.next(from)
+		if !ok || got.Format("2006-01-02 15:04") != c.want {
+			t.Errorf("%q next after %s = %s %v, want %s", c.expr, c.from, got, ok, c.want)
+			continue
+		}
+		if !cr.match(got) {
+			t.Errorf("%q next after %s = %s does not match", c.expr, c.from, got)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/automation"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/signal"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type Config interface {
+	Latitude() float64
+	Longitude() float64
+}
+
+// Runner выполняет действия задания, реализуется движком автоматизации
+type Runner interface {
+	RunActions(actions []automation.Action, chatID int64) []error
+}
+
+type job struct {
+	orm.Job
+	sched   schedule
+	actions []automation.Action
+}
+
+// JobInfo задание с ближайшим временем запуска
+type JobInfo struct {
+	orm.Job
+	Next time.Time
+}
+
+type scheduler struct {
+	cfg    Config
+	db     *gorm.DB
+	runner Runner
+	jobs   []*job
+	mtx    sync.Mutex
+}
+
+func New(cfg Config, db *gorm.DB, runner Runner) (*scheduler, error) {
+	s := &scheduler{cfg: cfg, db: db, runner: runner}
+	err := s.load(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("loading jobs failed: %w", err)
+	}
+
+	ctx, cncl := context.WithCancel(context.Background())
+	signal.OnShutdown(func() error {
+		log.Info("[Scheduler] Shutdown scheduler")
+		cncl()
+		return nil
+	})
+	signal.Run(func() { s.run(ctx) })
+	return s, nil
+}
+
+func (s *scheduler) run(ctx context.Context) {
+	log.Info("[Scheduler] running scheduler")
+
+	timer := time.NewTimer(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-timer.C:
+			s.tick(now.Truncate(time.Minute))
+			timer.Reset(time.Until(now.Truncate(time.Minute).Add(time.Minute)))
+		}
+	}
+}
+
+func (s *scheduler) tick(now time.Time) {
+	s.mtx.Lock()
+	var due []*job
+	for _, j := range s.jobs {
+		if !j.Enabled || !j.sched.match(now) || !j.LastRun.Before(now) {
+			continue
+		}
+		j.LastRun = now
+		due = append(due, j)
+	}
+	s.mtx.Unlock()
+
+	// действия выполняются без блокировки: SetState ходит в брокер, а действие может обратиться к планировщику
+	for _, j := range due {
+		res := s.db.Model(&orm.Job{}).Where("id = ?", j.ID).Update("last_run", now)
+		if res.Error != nil {
+			log.Errorf("[Scheduler] job %s: saving last run failed: %s", j.Name, res.Error)
+		}
+
+		log.Infof("[Scheduler] running job %s", j.Name)
+		for _, err := range s.runner.RunActions(j.actions, j.ChatID) {
+			log.Errorf("[Scheduler] job %s: %s", j.Name, err)
+		}
+	}
+}
+
+func (s *scheduler) compile(rec orm.Job) (*job, error) {
+	sched, err := parseSpec(rec.Spec, s.cfg.Latitude(), s.cfg.Longitude())
+	if err != nil {
+		return nil, err
+	}
+	actions, err := automation.ParseActions(rec.Actions)
+	if err != nil {
+		return nil, err
+	}
+	return &job{Job: rec, sched: sched, actions: actions}, nil
+}
+
+func (s *scheduler) load(ctx context.Context) error {
+	var recs []orm.Job
+	res := s.db.WithContext(ctx).Order("name").Find(&recs)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	jobs := make([]*job, 0, len(recs))
+	for _, rec := range recs {
+		j, err := s.compile(rec)
+		if err != nil {
+			log.Errorf("[Scheduler] job %s is broken, skipped: %s", rec.Name, err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	s.mtx.Lock()
+	s.jobs = jobs
+	s.mtx.Unlock()
+	log.Infof("[Scheduler] %d jobs loaded", len(jobs))
+	return nil
+}
+
+// Reload перечитывает задания после изменений в базе в обход планировщика
+func (s *scheduler) Reload(ctx context.Context) error {
+	return s.load(ctx)
+}
+
+func (s *scheduler) Jobs(ctx context.Context) ([]JobInfo, error) {
+	var recs []orm.Job
+	res := s.db.WithContext(ctx).Order("name").Find(&recs)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	now := time.Now()
+	infos := make([]JobInfo, 0, len(recs))
+	for _, rec := range recs {
+		info := JobInfo{Job: rec}
+		if sched, err := parseSpec(rec.Spec, s.cfg.Latitude(), s.cfg.Longitude()); err == nil && rec.Enabled {
+			info.Next, _ = sched.next(now)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// AddJob сохраняет задание пользователя с ролью role из чата chatID
+func (s *scheduler) AddJob(ctx context.Context, name string, spec string, actions string, chatID int64, role string) error {
+	rec := orm.Job{Name: name, Spec: spec, Actions: actions, Enabled: true, ChatID: chatID}
+	j, err := s.compile(rec)
+	if err != nil {
+		return err
+	}
+	err = automation.CheckChats(j.actions, chatID, role)
+	if err != nil {
+		return err
+	}
+
+	res := s.db.WithContext(ctx).Create(&rec)
+	if res.Error != nil {
+		return fmt.Errorf("saving job failed: %w", res.Error)
+	}
+	return s.load(ctx)
+}
+
+func (s *scheduler) SetJobSpec(ctx context.Context, name string, spec string) error {
+	_, err := parseSpec(spec, s.cfg.Latitude(), s.cfg.Longitude())
+	if err != nil {
+		return err
+	}
+	return s.update(ctx, name, "spec", spec)
+}
+
+func (s *scheduler) SetJobActions(ctx context.Context, name string, actions string, chatID int64, role string) error {
+	parsed, err := automation.ParseActions(actions)
+	if err != nil {
+		return err
+	}
+	err = automation.CheckChats(parsed, chatID, role)
+	if err != nil {
+		return err
+	}
+	return s.update(ctx, name, "actions", actions)
+}
+
+func (s *scheduler) EnableJob(ctx context.Context, name string, enabled bool) error {
+	return s.update(ctx, name, "enabled", enabled)
+}
+
+func (s *scheduler) RemoveJob(ctx context.Context, name string) error {
+	res := s.db.WithContext(ctx).Unscoped().Where("name = ?", name).Delete(&orm.Job{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobNotFound
+	}
+	return s.load(ctx)
+}
+
+func (s *scheduler) update(ctx context.Context, name string, field string, value any) error {
+	res := s.db.WithContext(ctx).Model(&orm.Job{}).Where("name = ?", name).Update(field, value)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrJobNotFound
+	}
+	return s.load(ctx)
+}
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/automation"
+	"github.com/Farengier/smart-home/internal/orm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testConfig struct{}
+
+func (testConfig) Latitude() float64  { return testLat }
+func (testConfig) Longitude() float64 { return testLon }
+
+type testRunner struct {
+	runs []int64
+	// during вызывается при выполнении действий
+	during func()
+}
+
+func (r *testRunner) RunActions(actions []automation.Action, chatID int64) []error {
+	r.runs = append(r.runs, chatID)
+	if r.during != nil {
+		r.during()
+	}
+	return nil
+}
+
+func testScheduler(t *testing.T) (*scheduler, *testRunner) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&orm.Job{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	r := &testRunner{}
+	s, err := New(testConfig{}, db, r)
+	if err != nil {
+		t.Fatalf("new scheduler: %s", err)
+	}
+	return s, r
+}
+
+func TestAddJob(t *testing.T) {
+	s, r := testScheduler(t)
+	own := `[{"type":"notify","text":"x"}]`
+	other := `[{"type":"notify","text":"x","chat":8}]`
+
+	if err := s.AddJob(context.Background(), "morning", "0 7 * * *", own, 7, access.RoleUser); err != nil {
+		t.Fatalf("add job: %s", err)
+	}
+	if err := s.AddJob(context.Background(), "never", "0 0 31 2 *", own, 7, access.RoleUser); err == nil {
+		t.Errorf("never matching job accepted")
+	}
+	if err := s.AddJob(context.Background(), "spam", "0 7 * * *", other, 7, access.RoleUser); err == nil {
+		t.Errorf("user job notifying other chat accepted")
+	}
+	if err := s.SetJobActions(context.Background(), "morning", other, 7, access.RoleUser); err == nil {
+		t.Errorf("user actions notifying other chat accepted")
+	}
+	if err := s.SetJobActions(context.Background(), "morning", other, 7, access.RoleAdmin); err != nil {
+		t.Errorf("admin actions notifying other chat: %s", err)
+	}
+
+	jobs, err := s.Jobs(context.Background())
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("jobs %v: %v", jobs, err)
+	}
+	if jobs[0].Next.IsZero() || jobs[0].Next.Hour() != 7 || jobs[0].Next.Minute() != 0 {
+		t.Errorf("next run %s", jobs[0].Next)
+	}
+
+	at := jobs[0].Next
+	s.tick(at)
+	s.tick(at)
+	if len(r.runs) != 1 || r.runs[0] != 7 {
+		t.Errorf("runs %v, want one in chat 7", r.runs)
+	}
+	s.tick(at.Add(time.Minute))
+	if len(r.runs) != 1 {
+		t.Errorf("job run at %s", at.Add(time.Minute))
+	}
+}
+
+// TestCancelledContext запросы идут в контексте команды и прерываются вместе с ней
+func TestCancelledContext(t *testing.T) {
+	s, _ := testScheduler(t)
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+
+	own := `[{"type":"notify","text":"x"}]`
+	calls := map[string]func() error{
+		"jobs":    func() error { _, err := s.Jobs(ctx); return err },
+		"add":     func() error { return s.AddJob(ctx, "morning", "0 7 * * *", own, 7, access.RoleUser) },
+		"spec":    func() error { return s.SetJobSpec(ctx, "morning", "0 8 * * *") },
+		"actions": func() error { return s.SetJobActions(ctx, "morning", own, 7, access.RoleUser) },
+		"enable":  func() error { return s.EnableJob(ctx, "morning", false) },
+		"remove":  func() error { return s.RemoveJob(ctx, "morning") },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: error %v, want %v", name, err, context.Canceled)
+		}
+	}
+}
+
+// TestTickUnlocked действия задания выполняются без блокировки и могут обращаться к планировщику
+func TestTickUnlocked(t *testing.T) {
+	s, r := testScheduler(t)
+	own := `[{"type":"notify","text":"x"}]`
+	if err := s.AddJob(context.Background(), "morning", "0 7 * * *", own, 7, access.RoleUser); err != nil {
+		t.Fatalf("add job: %s", err)
+	}
+	r.during = func() {
+		if _, err := s.Jobs(context.Background()); err != nil {
+			t.Errorf("jobs: %s", err)
+		}
+		if err := s.EnableJob(context.Background(), "morning", false); err != nil {
+			t.Errorf("disable: %s", err)
+		}
+	}
+
+	at := time.Date(2023, 6, 5, 7, 0, 0, 0, time.Local)
+	done := make(chan struct{})
+	go func() {
+		s.tick(at)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("tick blocked by its own actions")
+	}
+	if len(r.runs) != 1 {
+		t.Errorf("runs %v, want one", r.runs)
+	}
+
+	// выключенное во время выполнения задание больше не запускается
+	s.tick(at.AddDate(0, 0, 1))
+	if len(r.runs) != 1 {
+		t.Errorf("disabled job run, runs %v", r.runs)
+	}
+}
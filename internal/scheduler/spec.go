@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	specSunrise = "sunrise"
+	specSunset  = "sunset"
+)
+
+type schedule interface {
+	// match проверяет, что задание должно запуститься в минуту t
+	match(t time.Time) bool
+	// next ищет ближайшую минуту запуска после from
+	next(from time.Time) (time.Time, bool)
+}
+
+type sunSchedule struct {
+	rising   bool
+	offset   time.Duration
+	lat, lon float64
+}
+
+// parseSpec разбирает cron выражение или sunrise/sunset со смещением: sunset, sunrise-30m, sunset+1h15m
+func parseSpec(spec string, lat, lon float64) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	for _, ev := range []string{specSunrise, specSunset} {
+		if !strings.HasPrefix(spec, ev) {
+			continue
+		}
+
+		s := &sunSchedule{rising: ev == specSunrise, lat: lat, lon: lon}
+		rest := strings.TrimSpace(spec[len(ev):])
+		if rest == "" {
+			return s, nil
+		}
+		if rest[0] != '+' && rest[0] != '-' {
+			return nil, fmt.Errorf("bad %s offset %q", ev, rest)
+		}
+		d, err := time.ParseDuration(strings.ReplaceAll(rest, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("bad %s offset %q: %w", ev, rest, err)
+		}
+		s.offset = d
+		return s, nil
+	}
+
+	return parseCron(spec)
+}
+
+func (s *sunSchedule) match(t time.Time) bool {
+	t = t.Truncate(time.Minute)
+	// смещение может перенести событие на соседние сутки
+	for _, day := range []int{-1, 0, 1} {
+		ev, ok := sunTime(t.AddDate(0, 0, day), s.lat, s.lon, s.rising)
+		if ok && ev.Add(s.offset).Truncate(time.Minute).Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// next перебирает сутки, начиная с предыдущих, на случай отрицательного смещения. В полярных широтах
+// события может не быть больше полугода, поэтому ищем в пределах года
+func (s *sunSchedule) next(from time.Time) (time.Time, bool) {
+	from = from.Truncate(time.Minute)
+	y, m, d := from.Date()
+	for day := -1; day <= 366; day++ {
+		ev, ok := sunTime(time.Date(y, m, d+day, 12, 0, 0, 0, from.Location()), s.lat, s.lon, s.rising)
+		if !ok {
+			continue
+		}
+		t := ev.Add(s.offset).Truncate(time.Minute)
+		// смещение больше суток match не находит
+		if t.After(from) && s.match(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Москва
+const testLat, testLon = 55.75, 37.62
+
+func TestParseSpec(t *testing.T) {
+	cases := []struct {
+		spec   string
+		ok     bool
+		sun    bool
+		rising bool
+		offset time.Duration
+	}{
+		{"sunrise", true, true, true, 0},
+		{" sunset ", true, true, false, 0},
+		{"sunrise-30m", true, true, true, -30 * time.Minute},
+		{"sunset+1h15m", true, true, false, 75 * time.Minute},
+		{"sunset + 10m", true, true, false, 10 * time.Minute},
+		{"sunset 10m", false, false, false, 0},
+		{"sunrise+soon", false, false, false, 0},
+		{"0 7 * * *", true, false, false, 0},
+		{"0 0 31 2 *", false, false, false, 0},
+		{"noon", false, false, false, 0},
+	}
+	for _, c := range cases {
+		s, err := parseSpec(c.spec, testLat, testLon)
+		if (err == nil) != c.ok {
+			t.Errorf("parseSpec(%q): error %v, want ok %v", c.spec, err, c.ok)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		sun, isSun := s.(*sunSchedule)
+		if isSun != c.sun {
+			t.Errorf("parseSpec(%q) = %T", c.spec, s)
+			continue
+		}
+		if isSun && (sun.rising != c.rising || sun.offset != c.offset) {
+			t.Errorf("parseSpec(%q) = rising %v offset %s", c.spec, sun.rising, sun.offset)
+		}
+	}
+}
+
+func TestSunTime(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	cases := []struct {
+		date   string
+		lat    float64
+		rising bool
+		want   string
+		ok     bool
+	}{
+		{"2023-06-21", testLat, true, "03:44", true},
+		{"2023-06-21", testLat, false, "21:18", true},
+		{"2023-12-22", testLat, true, "08:59", true},
+		{"2023-12-22", testLat, false, "15:57", true},
+		// полярная ночь и полярный день
+		{"2023-12-22", 80, true, "", false},
+		{"2023-06-21", 80, false, "", false},
+	}
+	for _, c := range cases {
+		date, _ := time.ParseInLocation("2006-01-02", c.date, loc)
+		got, ok := sunTime(date, c.lat, testLon, c.rising)
+		if ok != c.ok {
+			t.Errorf("%s lat %v rising %v: ok %v", c.date, c.lat, c.rising, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		want, _ := time.ParseInLocation("2006-01-02 15:04", c.date+" "+c.want, loc)
+		if d := got.Sub(want); d < -3*time.Minute || d > 3*time.Minute {
+			t.Errorf("%s rising %v = %s, want about %s", c.date, c.rising, got.Format("15:04"), c.want)
+		}
+	}
+}
+
+func TestSunNext(t *testing.T) {
+	loc := time.FixedZone("MSK", 3*60*60)
+	cases := []struct {
+		spec string
+		lat  float64
+		from string
+		want string
+		ok   bool
+	}{
+		{"sunrise", testLat, "2023-06-21 00:00", "2023-06-21", true},
+		{"sunrise", testLat, "2023-06-21 12:00", "2023-06-22", true},
+		{"sunset-30m", testLat, "2023-06-21 12:00", "2023-06-21", true},
+		// смещение переносит запуск на следующие сутки
+		{"sunset+3h", testLat, "2023-06-21 12:00", "2023-06-22", true},
+		{"sunset+3h", testLat, "2023-06-22 01:00", "2023-06-23", true},
+		{"sunrise-5h", testLat, "2023-06-21 12:00", "2023-06-21", true},
+		// после полярной ночи
+		{"sunrise", 75, "2023-12-01 00:00", "2024-02", true},
+		{"sunset+49h", testLat, "2023-06-21 12:00", "", false},
+	}
+	for _, c := range cases {
+		s, err := parseSpec(c.spec, c.lat, testLon)
+		if err != nil {
+			t.Fatalf("parseSpec(%q): %s", c.spec, err)
+		}
+		from, _ := time.ParseInLocation("2006-01-02 15:04", c.from, loc)
+		got, ok := s.next(from)
+		if ok != c.ok {
+			t.Errorf("%q after %s: ok %v", c.spec, c.from, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !strings.HasPrefix(got.Format("2006-01-02"), c.want) {
+			t.Errorf("%q after %s = %s, want %s", c.spec, c.from, got, c.want)
+		}
+		if !got.After(from) || !s.match(got) {
+			t.Errorf("%q after %s = %s is not a run time", c.spec, c.from, got)
+		}
+		// ни одной подходящей минуты между from и найденным временем
+		for m := from.Truncate(time.Minute).Add(time.Minute); m.Before(got); m = m.Add(time.Minute) {
+			if s.match(m) {
+				t.Errorf("%q after %s: missed %s", c.spec, c.from, m)
+				break
+			}
+		}
+	}
+}
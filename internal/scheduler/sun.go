@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"math"
+	"time"
+)
+
+// официальный зенит восхода/заката с учётом рефракции
+const sunZenith = 90.833
+
+const rad = math.Pi / 180
+
+// sunTime вычисляет время восхода (rising=true) или заката в день date по алгоритму Almanac for Computers.
+// Возвращает false для полярного дня или ночи
+func sunTime(date time.Time, lat, lon float64, rising bool) (time.Time, bool) {
+	n := float64(date.YearDay())
+	lngHour := lon / 15
+
+	base := 18.0
+	if rising {
+		base = 6
+	}
+	t := n + (base-lngHour)/24
+
+	m := 0.9856*t - 3.289
+	l := normalize(m+1.916*math.Sin(m*rad)+0.020*math.Sin(2*m*rad)+282.634, 360)
+
+	ra := normalize(math.Atan(0.91764*math.Tan(l*rad))/rad, 360)
+	ra += math.Floor(l/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	sinDec := 0.39782 * math.Sin(l*rad)
+	cosDec := math.Cos(math.Asin(sinDec))
+
+	cosH := (math.Cos(sunZenith*rad) - sinDec*math.Sin(lat*rad)) / (cosDec * math.Cos(lat*rad))
+	if cosH > 1 || cosH < -1 {
+		return time.Time{}, false
+	}
+
+	h := math.Acos(cosH) / rad
+	if rising {
+		h = 360 - h
+	}
+	h /= 15
+
+	ut := normalize(h+ra-0.06571*t-6.622-lngHour, 24)
+
+	y, mo, d := date.Date()
+	res := time.Date(y, mo, d, 0, 0, 0, 0, time.UTC).Add(time.Duration(ut * float64(time.Hour))).In(date.Location())
+
+	// UT мог попасть на соседние сутки относительно местной даты
+	local := time.Date(y, mo, d, 0, 0, 0, 0, date.Location())
+	if res.Before(local) {
+		res = res.Add(24 * time.Hour)
+	} else if res.Sub(local) >= 24*time.Hour {
+		res = res.Add(-24 * time.Hour)
+	}
+	return res, true
+}
+
+func normalize(v, max float64) float64 {
+	v = math.Mod(v, max)
+	if v < 0 {
+		v += max
+	}
+	return v
+}
@@ -0,0 +1,341 @@
+package telegram
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/signal"
+	"github.com/Farengier/smart-home/internal/telegram/tgfake"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jltorresm/otpgo"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testOtpKey = "JBSWY3DPEHPK3PXP"
+
+// сколько ждём ответов бота, с запасом на лимит отправки в чат
+const testWait = 10 * time.Second
+
+type testConfig struct {
+	endpoint  string
+	otpWindow time.Duration
+	secret    string
+}
+
+func (c testConfig) Token() string                              { return "test" }
+func (c testConfig) APIEndpoint() string                        { return c.endpoint }
+func (c testConfig) SpamFilterDurationSensitive() time.Duration { return 0 }
+func (c testConfig) SpamFilterDurationLow() time.Duration       { return 0 }
+func (c testConfig) SessionLifetime() time.Duration             { return time.Hour }
+func (c testConfig) SessionIdleTimeout() time.Duration          { return time.Hour }
+func (c testConfig) SensitiveOtpWindow() time.Duration          { return c.otpWindow }
+func (c testConfig) UpdatesMode() string                        { return ModePolling }
+func (c testConfig) WebhookURL() string                         { return "" }
+func (c testConfig) WebhookPath() string                        { return "" }
+func (c testConfig) WebhookSecret() string                      { return c.secret }
+
+type testDB struct {
+	db *gorm.DB
+}
+
+func (d testDB) GORM() *gorm.DB { return d.db }
+func (d testDB) SyncNow()       {}
+
+// testSwitch актуатор, который сразу сообщает реестру новое состояние
+type testSwitch struct {
+	id  string
+	reg *device.Registry
+
+	mtx    sync.Mutex
+	states []device.Values
+}
+
+func (s *testSwitch) ID() string   { return s.id }
+func (s *testSwitch) Name() string { return s.id }
+func (s *testSwitch) State() (device.Values, error) {
+	return s.reg.Values(s.id), nil
+}
+func (s *testSwitch) SetState(state device.Values) error {
+	s.mtx.Lock()
+	s.states = append(s.states, state)
+	s.mtx.Unlock()
+	s.reg.Report(s.id, state)
+	return nil
+}
+func (s *testSwitch) calls() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.states)
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db: %s", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&orm.User{}, &orm.UserRole{}, &orm.Grant{}, &orm.ChatSession{}, &orm.Device{}, &orm.Room{}, &orm.RecoveryCode{}, &orm.Outbox{}, &orm.Deletion{})
+	if err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	return db
+}
+
+func startTestBot(t *testing.T, cfg testConfig, db *gorm.DB, devices *device.Registry) *bot {
+	t.Helper()
+	// без Init бот не запускает обработку обновлений
+	signal.Init()
+	b, err := StartBot(cfg, testDB{db: db}, Services{Devices: devices}, nil)
+	if err != nil {
+		t.Fatalf("start bot: %s", err)
+	}
+	return b
+}
+
+func testAdmin(t *testing.T, db *gorm.DB, chatID int64) {
+	t.Helper()
+	u := &orm.User{Login: "admin", OtpKey: testOtpKey, ChatID: chatID, Status: orm.UserApproved, Role: orm.UserRole{Role: access.RoleAdmin}}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatalf("create admin: %s", err)
+	}
+}
+
+func codeAt(t *testing.T, key string, step int64) string {
+	t.Helper()
+	code, err := (&otpgo.HOTP{Key: key, Counter: uint64(step)}).Generate()
+	if err != nil {
+		t.Fatalf("generate code: %s", err)
+	}
+	return code
+}
+
+func otpNow() int64 {
+	return time.Now().Unix() / otpgo.TOTPDefaultPeriod
+}
+
+// waitSent ждёт n сообщений в чате и проверяет, что последнее содержит text
+func waitSent(t *testing.T, f interface {
+	WaitSent(chatID int64, n int, timeout time.Duration) ([]tgfake.Message, error)
+}, chatID int64, n int, text string) []tgfake.Message {
+	t.Helper()
+	msgs, err := f.WaitSent(chatID, n, testWait)
+	if err != nil {
+		t.Fatalf("%s, sent %+v", err, msgs)
+	}
+	if len(msgs) != n {
+		t.Fatalf("chat %d: %d messages, want %d: %+v", chatID, len(msgs), n, msgs)
+	}
+	if !strings.Contains(msgs[n-1].Text, text) {
+		t.Fatalf("chat %d: message %q, want %q", chatID, msgs[n-1].Text, text)
+	}
+	return msgs
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testWait)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// buttons данные кнопок сообщения по порядку
+func buttons(t *testing.T, m tgfake.Message) []string {
+	t.Helper()
+	kb := tgbotapi.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(m.ReplyMarkup), &kb); err != nil {
+		t.Fatalf("message %d keyboard %q: %s", m.MessageID, m.ReplyMarkup, err)
+	}
+	var res []string
+	for _, row := range kb.InlineKeyboard {
+		for _, btn := range row {
+			if btn.CallbackData != nil {
+				res = append(res, *btn.CallbackData)
+			}
+		}
+	}
+	return res
+}
+
+func TestRegisterApproveLogin(t *testing.T) {
+	const adminChat, userChat = 1, 7
+
+	f := tgfake.New()
+	defer f.Close()
+	db := newTestDB(t)
+	testAdmin(t, db, adminChat)
+	b := startTestBot(t, testConfig{endpoint: f.Endpoint(), otpWindow: time.Minute}, db, device.NewRegistry())
+	defer b.stop()
+
+	if len(f.Commands()) != len(b.commands) {
+		t.Errorf("%d commands registered, want %d", len(f.Commands()), len(b.commands))
+	}
+
+	f.SendText(adminChat, "/login admin "+codeAt(t, testOtpKey, otpNow()))
+	waitSent(t, f, adminChat, 1, "Successfully authenticated as admin")
+
+	f.SendText(userChat, "/register alice")
+	msgs := waitSent(t, f, userChat, 3, "")
+	if msgs[0].Method != "sendMessage" || !strings.Contains(msgs[0].Text, "Registration request is sent") {
+		t.Errorf("reply %s %q", msgs[0].Method, msgs[0].Text)
+	}
+	if msgs[1].Method != "sendPhoto" || len(msgs[1].Photo) == 0 {
+		t.Errorf("QR %s with %d bytes", msgs[1].Method, len(msgs[1].Photo))
+	}
+	if msgs[2].Method != "sendMessage" || msgs[2].Text == "" {
+		t.Errorf("recovery codes %s %q", msgs[2].Method, msgs[2].Text)
+	}
+	req := waitSent(t, f, adminChat, 2, "New registration: alice")
+	if btns := buttons(t, req[1]); len(btns) != 2 {
+		t.Errorf("approval buttons %v", btns)
+	}
+
+	f.SendText(adminChat, "/approve alice")
+	waitSent(t, f, adminChat, 3, "registration approved by admin")
+	waitSent(t, f, userChat, 4, "Your registration is approved")
+
+	usr := orm.User{}
+	if err := db.Joins("Role").First(&usr, orm.User{Login: "alice"}).Error; err != nil {
+		t.Fatalf("load alice: %s", err)
+	}
+	if usr.Status != orm.UserApproved || usr.DecidedBy != "admin" || usr.Role.Role != access.RoleUser {
+		t.Errorf("alice %s by %s as %s", usr.Status, usr.DecidedBy, usr.Role.Role)
+	}
+
+	f.SendText(userChat, "/login alice "+codeAt(t, usr.OtpKey, otpNow()))
+	waitSent(t, f, userChat, 5, "Successfully authenticated as user")
+
+	// при остановке сообщения с секретами удаляются, не дожидаясь срока
+	b.stop()
+	waitFor(t, "sensitive messages deletion", func() bool {
+		sent := f.Sent(userChat)
+		return sent[1].Deleted && sent[2].Deleted
+	})
+	for i, m := range f.Sent(userChat) {
+		if m.Deleted != (i == 1 || i == 2) {
+			t.Errorf("message %d %s %q deleted %v", i, m.Method, m.Text, m.Deleted)
+		}
+	}
+	for _, m := range f.Sent(adminChat) {
+		if m.Deleted {
+			t.Errorf("admin message %q deleted", m.Text)
+		}
+	}
+}
+
+func TestToggleNeedsOtp(t *testing.T) {
+	const chat = 3
+	// код входа устаревает до нажатия, окно с запасом на задержку ответов лимитом чата
+	const otpWindow = 3 * time.Second
+
+	f := tgfake.New()
+	defer f.Close()
+	db := newTestDB(t)
+	testAdmin(t, db, chat)
+	devices := device.NewRegistry()
+	lamp := &testSwitch{id: "lamp", reg: devices}
+	if err := devices.Add(lamp); err != nil {
+		t.Fatalf("add lamp: %s", err)
+	}
+	devices.Report("lamp", device.Values{"state": device.String("ON")})
+	b := startTestBot(t, testConfig{endpoint: f.Endpoint(), otpWindow: otpWindow}, db, devices)
+	defer b.stop()
+
+	// команда до входа выполняется после /login
+	f.SendText(chat, "/devices")
+	waitSent(t, f, chat, 1, "Authentication required")
+	step := otpNow()
+	f.SendText(chat, "/login admin "+codeAt(t, testOtpKey, step))
+	waitSent(t, f, chat, 2, "Successfully authenticated")
+	msgs := waitSent(t, f, chat, 3, "lamp")
+	list := msgs[2]
+	btns := buttons(t, list)
+	if len(btns) != 2 {
+		t.Fatalf("buttons %v, want toggle and refresh", btns)
+	}
+
+	time.Sleep(otpWindow + 100*time.Millisecond)
+	f.PressButton(chat, list.MessageID, btns[0])
+	waitSent(t, f, chat, 4, "Enter one\\-time code")
+	waitFor(t, "confirmation answer", func() bool {
+		answers := f.Answers()
+		return len(answers) == 1 && answers[0].Text == msgConfirmFirst
+	})
+	if lamp.calls() != 0 {
+		t.Fatalf("lamp toggled without a fresh code")
+	}
+
+	// код следующего шага, текущий уже потрачен на вход
+	f.SendText(chat, codeAt(t, testOtpKey, step+1))
+	waitSent(t, f, chat, 5, "Confirmed")
+	f.PressButton(chat, list.MessageID, btns[0])
+	waitFor(t, "toggle answer", func() bool {
+		answers := f.Answers()
+		return len(answers) == 2 && answers[1].Text == "lamp: OFF"
+	})
+	waitFor(t, "list update", func() bool {
+		return strings.Contains(f.Sent(chat)[2].Text, "OFF")
+	})
+	if got := devices.Values("lamp")["state"]; got.Str != "OFF" {
+		t.Errorf("lamp state %s, want OFF", got)
+	}
+	if n := len(f.Sent(chat)); n != 5 {
+		t.Errorf("%d messages, want the list edited in place", n)
+	}
+}
+
+func TestThrottledReply(t *testing.T) {
+	const chat = 5
+
+	f := tgfake.New()
+	defer f.Close()
+	b := startTestBot(t, testConfig{endpoint: f.Endpoint(), otpWindow: time.Minute}, newTestDB(t), device.NewRegistry())
+	defer b.stop()
+
+	// первая попытка получает 429, ответ повторяется после retry_after
+	f.Throttle(1, 1)
+	start := time.Now()
+	f.SendText(chat, "/start")
+	waitSent(t, f, chat, 1, "/login")
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("reply sent after %s, before retry_after", d)
+	}
+
+	f.SendText(chat, "/start")
+	waitSent(t, f, chat, 2, "/register")
+}
+
+func TestLogoutBeforeLogin(t *testing.T) {
+	const chat = 9
+
+	f := tgfake.New()
+	defer f.Close()
+	db := newTestDB(t)
+	testAdmin(t, db, chat)
+	b := startTestBot(t, testConfig{endpoint: f.Endpoint(), otpWindow: time.Minute}, db, device.NewRegistry())
+	defer b.stop()
+
+	// /logout без сессии не откладывается и не завершает следующий вход
+	f.SendText(chat, "/logout")
+	waitSent(t, f, chat, 1, "Not logged in")
+	f.SendText(chat, "/login admin "+codeAt(t, testOtpKey, otpNow()))
+	waitSent(t, f, chat, 2, "Successfully authenticated")
+	f.SendText(chat, "/logout")
+	waitSent(t, f, chat, 3, "Logged out")
+}
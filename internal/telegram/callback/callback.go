@@ -0,0 +1,73 @@
+package callback
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ограничение Telegram на размер callback_data
+const maxDataLen = 64
+
+const sep = ":"
+
+var ErrBadPayload = errors.New("bad callback payload")
+
+// Payload данные кнопки: команда, которой вернётся нажатие, действие и аргументы
+type Payload struct {
+	Cmd    string
+	Action string
+	Args   []string
+}
+
+func New(cmd string, action string, args ...string) Payload {
+	return Payload{Cmd: cmd, Action: action, Args: args}
+}
+
+// Arg возвращает аргумент по номеру или пустую строку
+func (p Payload) Arg(i int) string {
+	if i < 0 || i >= len(p.Args) {
+		return ""
+	}
+	return p.Args[i]
+}
+
+func (p Payload) Encode() (string, error) {
+	parts := make([]string, 0, len(p.Args)+2)
+	parts = append(parts, url.QueryEscape(p.Cmd), url.QueryEscape(p.Action))
+	for _, a := range p.Args {
+		parts = append(parts, url.QueryEscape(a))
+	}
+	data := strings.Join(parts, sep)
+	if len(data) > maxDataLen {
+		return "", fmt.Errorf("payload %s is longer than %d bytes", data, maxDataLen)
+	}
+	return data, nil
+}
+
+func Decode(data string) (Payload, error) {
+	parts := strings.Split(data, sep)
+	if len(parts) < 2 || parts[0] == "" {
+		return Payload{}, ErrBadPayload
+	}
+	for i, part := range parts {
+		s, err := url.QueryUnescape(part)
+		if err != nil {
+			return Payload{}, fmt.Errorf("%w: %s", ErrBadPayload, err)
+		}
+		parts[i] = s
+	}
+	return Payload{Cmd: parts[0], Action: parts[1], Args: parts[2:]}, nil
+}
+
+// Button кнопка с данными p. Если данные не влезают в ограничение Telegram, возвращается ошибка
+func Button(text string, p Payload) (tgbotapi.InlineKeyboardButton, error) {
+	data, err := p.Encode()
+	if err != nil {
+		return tgbotapi.InlineKeyboardButton{}, err
+	}
+	return tgbotapi.NewInlineKeyboardButtonData(text, data), nil
+}
@@ -0,0 +1,72 @@
+package callback
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	cases := []struct {
+		name string
+		p    Payload
+		data string
+	}{
+		{"no args", New("devices", "page"), "devices:page"},
+		{"args", New("devices", "toggle", "lamp", "2"), "devices:toggle:lamp:2"},
+		{"separator in arg", New("devices", "toggle", "0x00:aa"), "devices:toggle:0x00%3Aaa"},
+		{"spaces and unicode", New("scene", "apply", "ночь 2"), "scene:apply:%D0%BD%D0%BE%D1%87%D1%8C+2"},
+		{"empty action and arg", New("approve", "", ""), "approve::"},
+	}
+	for _, c := range cases {
+		data, err := c.p.Encode()
+		if err != nil {
+			t.Errorf("%s: encode: %s", c.name, err)
+			continue
+		}
+		if data != c.data {
+			t.Errorf("%s: encoded %q, want %q", c.name, data, c.data)
+		}
+		got, err := Decode(data)
+		if err != nil {
+			t.Errorf("%s: decode: %s", c.name, err)
+			continue
+		}
+		if got.Cmd != c.p.Cmd || got.Action != c.p.Action || len(got.Args) != len(c.p.Args) ||
+			len(got.Args) > 0 && !reflect.DeepEqual(got.Args, c.p.Args) {
+			t.Errorf("%s: decoded %+v, want %+v", c.name, got, c.p)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	p := New("devices", "toggle", strings.Repeat("x", maxDataLen))
+	if _, err := p.Encode(); err == nil {
+		t.Errorf("payload over %d bytes encoded", maxDataLen)
+	}
+	if _, err := Button("lamp", p); err == nil {
+		t.Errorf("button with long payload created")
+	}
+
+	// ограничение в байтах после экранирования
+	p = New("scene", "apply", strings.Repeat("ы", 10))
+	if _, err := p.Encode(); err == nil {
+		t.Errorf("escaped payload over %d bytes encoded", maxDataLen)
+	}
+}
+
+func TestDecodeBad(t *testing.T) {
+	for _, data := range []string{"", "devices", ":toggle", "devices:%zz", "devices:toggle:%"} {
+		if _, err := Decode(data); !errors.Is(err, ErrBadPayload) {
+			t.Errorf("Decode(%q) = %v, want ErrBadPayload", data, err)
+		}
+	}
+}
+
+func TestArg(t *testing.T) {
+	p := New("devices", "toggle", "lamp")
+	if p.Arg(0) != "lamp" || p.Arg(1) != "" || p.Arg(-1) != "" {
+		t.Errorf("args %q %q %q", p.Arg(0), p.Arg(1), p.Arg(-1))
+	}
+}
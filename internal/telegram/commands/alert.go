@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/alert"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+)
+
+type Alerts interface {
+	Alerts(ctx context.Context, chatID int64) ([]orm.Alert, error)
+	Add(ctx context.Context, rec orm.Alert) (*orm.Alert, error)
+	Remove(ctx context.Context, chatID int64, id uint) error
+	Reload(ctx context.Context) error
+}
+
+type alertCmd struct {
+	alerts Alerts
+}
+
+func Alert(alerts Alerts) *alertCmd {
+	return &alertCmd{alerts: alerts}
+}
+func (ac *alertCmd) Cmd() string {
+	return "alert"
+}
+func (ac *alertCmd) Description() string {
+	return "Уведомления о выходе значений за пороги"
+}
+func (ac *alertCmd) Usage() string {
+	return `Управление уведомлениями:
+/alert list
+/alert add \<устройство\> \<свойство\> \<оператор\> \<значение\> \[for\=10m\] \[hyst\=0\.5\] \[every\=30m\]
+/alert remove \<номер\>
+
+Операторы: \> \>\= \< \<\= \=\= \!\=
+for: сколько условие должно держаться, hyst: гистерезис снятия, every: повтор уведомления
+Пример: ` + "`/alert add bedroom_climate temperature > 27 for=10m hyst=0.5`"
+}
+func (ac *alertCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (ac *alertCmd) IsAuthRequired() bool {
+	return true
+}
+func (ac *alertCmd) RequiredRole() string {
+	return access.RoleUser
+}
+func (ac *alertCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 ||
+		params[0] == "add" && len(params) < 5 ||
+		params[0] == "remove" && len(params) < 2 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (ac *alertCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	switch params[0] {
+	case "list":
+		ac.list(r, sess.ChatID)
+	case "add":
+		ac.add(r, params[1:], sess.ChatID)
+	case "remove":
+		id, err := strconv.ParseUint(params[1], 10, 64)
+		if err != nil {
+			r.Usage()
+			break
+		}
+		err = ac.alerts.Remove(r.Context(), sess.ChatID, uint(id))
+		if errors.Is(err, alert.ErrAlertNotFound) {
+			r.ReplyWithMessage(escape(fmt.Sprintf("Alert %d not found", id)))
+			break
+		}
+		if err != nil {
+			log.WithContext(r.Context()).Errorf("[TG Bot alert] remove failed: %s", err)
+			r.InternalError()
+			break
+		}
+		r.ReplyWithMessage(escape(fmt.Sprintf("Alert %d removed", id)))
+	default:
+		r.Usage()
+	}
+	return (*actionResult)(nil)
+}
+
+func (ac *alertCmd) add(r interfaces.Replier, params []string, chatID int64) {
+	rec := orm.Alert{
+		ChatID:    chatID,
+		DeviceID:  params[0],
+		Property:  params[1],
+		Op:        params[2],
+		Threshold: params[3],
+	}
+
+	for _, opt := range params[4:] {
+		k, v, ok := strings.Cut(opt, "=")
+		if !ok {
+			r.Usage()
+			return
+		}
+
+		var err error
+		switch k {
+		case "for":
+			rec.For, err = time.ParseDuration(v)
+		case "hyst":
+			rec.Hysteresis, err = strconv.ParseFloat(v, 64)
+		case "every":
+			rec.Renotify, err = time.ParseDuration(v)
+		default:
+			err = fmt.Errorf("unknown option %s", k)
+		}
+		if err != nil {
+			r.ReplyWithMessage(escape(fmt.Sprintf("Bad option %s: %s", opt, err)))
+			return
+		}
+	}
+
+	res, err := ac.alerts.Add(r.Context(), rec)
+	if err != nil {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Alert not added: %s", err)))
+		return
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("Alert %d added", res.ID)))
+}
+
+func (ac *alertCmd) list(r interfaces.Replier, chatID int64) {
+	list, err := ac.alerts.Alerts(r.Context(), chatID)
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot alert] listing failed: %s", err)
+		r.InternalError()
+		return
+	}
+	if len(list) == 0 {
+		r.ReplyWithMessage("No alerts")
+		return
+	}
+
+	sb := strings.Builder{}
+	for _, a := range list {
+		sb.WriteString(fmt.Sprintf("%d: %s %s %s %s", a.ID, a.DeviceID, a.Property, a.Op, a.Threshold))
+		if a.For > 0 {
+			sb.WriteString(" for=" + a.For.String())
+		}
+		if a.Hysteresis > 0 {
+			sb.WriteString(" hyst=" + strconv.FormatFloat(a.Hysteresis, 'f', -1, 64))
+		}
+		if a.Renotify > 0 {
+			sb.WriteString(" every=" + a.Renotify.String())
+		}
+		if a.Active {
+			sb.WriteString(" [active]")
+		}
+		sb.WriteString("\n")
+	}
+	r.ReplyWithMessage(escape(sb.String()))
+}
@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/callback"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// decideCmd подтверждает или отклоняет заявку на регистрацию
+type decideCmd struct {
+	db        *gorm.DB
+	messenger Messenger
+	approve   bool
+}
+
+func Approve(db *gorm.DB, messenger Messenger) *decideCmd {
+	return &decideCmd{db: db, messenger: messenger, approve: true}
+}
+func Reject(db *gorm.DB, messenger Messenger) *decideCmd {
+	return &decideCmd{db: db, messenger: messenger, approve: false}
+}
+func (dc *decideCmd) Cmd() string {
+	if dc.approve {
+		return "approve"
+	}
+	return "reject"
+}
+func (dc *decideCmd) Description() string {
+	if dc.approve {
+		return "Подтверждение регистрации пользователя"
+	}
+	return "Отклонение регистрации пользователя"
+}
+func (dc *decideCmd) Usage() string {
+	return fmt.Sprintf(`Используйте
+/%s \<логин\>`, dc.Cmd())
+}
+func (dc *decideCmd) FloodControlLevel() int {
+	return domain.SpamLevelNone
+}
+func (dc *decideCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (dc *decideCmd) IsAuthRequired() bool {
+	return true
+}
+func (dc *decideCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (dc *decideCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (dc *decideCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	msg, ok := dc.decide(r, params[0], sess)
+	if ok {
+		r.ReplyWithMessage(escape(msg))
+	}
+	return (*actionResult)(nil)
+}
+
+// Callback нажатие кнопки из уведомления о регистрации, кнопки убираются из сообщения
+func (dc *decideCmd) Callback(r interfaces.Replier, p callback.Payload, sess *session.Session) {
+	msg, ok := dc.decide(r, p.Arg(0), sess)
+	if !ok {
+		return
+	}
+	r.AnswerCallback(msg)
+	r.EditMessage(escape(msg), nil)
+}
+
+func (dc *decideCmd) decide(r interfaces.Replier, login string, sess *session.Session) (string, bool) {
+	usr, ok := findUser(dc.db, r, login)
+	if !ok {
+		return "", false
+	}
+	if usr.Status != orm.UserPending {
+		return fmt.Sprintf("%s is already decided: %s by %s", usr.Login, dc.status(usr), usr.DecidedBy), true
+	}
+
+	status := orm.UserRejected
+	if dc.approve {
+		status = orm.UserApproved
+	}
+	res := dc.db.WithContext(r.Context()).Model(&orm.User{}).
+		Where("id = ? AND status = ?", usr.ID, orm.UserPending).
+		Updates(map[string]any{
+			"status":     status,
+			"decided_by": sess.User.Login,
+			"decided_at": time.Now(),
+		})
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot %s] %s failed: %s", dc.Cmd(), usr.Login, res.Error)
+		r.InternalError()
+		return "", false
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Sprintf("%s is already decided", usr.Login), true
+	}
+	log.WithContext(r.Context()).Infof("[TG Bot %s] %s by %s", dc.Cmd(), usr.Login, sess.User.Login)
+
+	if usr.ChatID != 0 {
+		if dc.approve {
+			dc.messenger.Notify(usr.ChatID, "Your registration is approved, use /login to continue")
+		} else {
+			dc.messenger.Notify(usr.ChatID, "Your registration is rejected")
+		}
+	}
+	return fmt.Sprintf("%s: registration %s by %s", usr.Login, status, sess.User.Login), true
+}
+
+// approvalKeyboard кнопки решения по заявке на регистрацию
+func approvalKeyboard(login string) (tgbotapi.InlineKeyboardMarkup, error) {
+	approve, err := callback.Button("Approve", callback.New("approve", "", login))
+	if err != nil {
+		return tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	reject, err := callback.Button("Reject", callback.New("reject", "", login))
+	if err != nil {
+		return tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(approve, reject)), nil
+}
+
+func (dc *decideCmd) status(usr *orm.User) string {
+	if usr.Status == "" {
+		return orm.UserApproved
+	}
+	return usr.Status
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// blockCmd блокирует или разблокирует пользователя. Сессии заблокированного завершаются
+type blockCmd struct {
+	db       *gorm.DB
+	sessions *session.Storage
+	block    bool
+}
+
+func Block(db *gorm.DB, sessions *session.Storage) *blockCmd {
+	return &blockCmd{db: db, sessions: sessions, block: true}
+}
+func Unblock(db *gorm.DB, sessions *session.Storage) *blockCmd {
+	return &blockCmd{db: db, sessions: sessions, block: false}
+}
+func (bc *blockCmd) Cmd() string {
+	if bc.block {
+		return "block"
+	}
+	return "unblock"
+}
+func (bc *blockCmd) Description() string {
+	if bc.block {
+		return "Блокировка пользователя"
+	}
+	return "Разблокировка пользователя"
+}
+func (bc *blockCmd) Usage() string {
+	return fmt.Sprintf(`Используйте
+/%s \<логин\>`, bc.Cmd())
+}
+func (bc *blockCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (bc *blockCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (bc *blockCmd) IsAuthRequired() bool {
+	return true
+}
+func (bc *blockCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (bc *blockCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 {
+		r.Usage()
+		return true
+	}
+	if bc.block && params[0] == sess.User.Login {
+		r.ReplyWithMessage("You can't block yourself")
+		return true
+	}
+	return false
+}
+func (bc *blockCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	usr, ok := findUser(bc.db, r, params[0])
+	if !ok {
+		return (*actionResult)(nil)
+	}
+
+	res := bc.db.WithContext(r.Context()).Model(&orm.User{}).Where("id = ?", usr.ID).Update("blocked", bc.block)
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot %s] %s failed: %s", bc.Cmd(), usr.Login, res.Error)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+	log.WithContext(r.Context()).Infof("[TG Bot %s] %s by %s", bc.Cmd(), usr.Login, sess.User.Login)
+
+	if !bc.block {
+		r.ReplyWithMessage(escape(fmt.Sprintf("%s unblocked", usr.Login)))
+		return (*actionResult)(nil)
+	}
+	n := bc.sessions.KillUser(int64(usr.ID))
+	r.ReplyWithMessage(escape(fmt.Sprintf("%s blocked, %d sessions killed", usr.Login, n)))
+	return (*actionResult)(nil)
+}
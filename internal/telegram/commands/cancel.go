@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+)
+
+type cancelCmd struct {
+}
+
+func Cancel() *cancelCmd {
+	return &cancelCmd{}
+}
+func (cc *cancelCmd) Cmd() string {
+	return "cancel"
+}
+func (cc *cancelCmd) Description() string {
+	return "Отмена текущего диалога"
+}
+func (cc *cancelCmd) Usage() string {
+	return `Для отмены пошагового ввода параметров используйте
+/cancel`
+}
+func (cc *cancelCmd) FloodControlLevel() int {
+	return domain.SpamLevelNone
+}
+func (cc *cancelCmd) IsAuthRequired() bool {
+	return false
+}
+func (cc *cancelCmd) RequiredRole() string {
+	return ""
+}
+func (cc *cancelCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	return false
+}
+func (cc *cancelCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	if !sess.EndConversation() {
+		r.ReplyWithMessage("Nothing to cancel")
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage("Cancelled")
+	return (*actionResult)(nil)
+}
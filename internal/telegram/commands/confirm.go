@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type confirmCmd struct {
+	db  *gorm.DB
+	otp *otpChecker
+}
+
+func Confirm(db *gorm.DB, messenger Messenger) *confirmCmd {
+	return &confirmCmd{db: db, otp: &otpChecker{db: db, messenger: messenger}}
+}
+func (cc *confirmCmd) Cmd() string {
+	return "confirm"
+}
+func (cc *confirmCmd) Description() string {
+	return "Подтверждение одноразовым кодом"
+}
+func (cc *confirmCmd) Usage() string {
+	return `Чувствительные команды требуют недавно введённого одноразового кода
+Для подтверждения используйте
+/confirm \<одноразовый код\>
+
+Отложенная команда будет выполнена автоматически`
+}
+func (cc *confirmCmd) FloodControlLevel() int {
+	return domain.SpamLevelSensitive
+}
+func (cc *confirmCmd) IsAuthRequired() bool {
+	return true
+}
+func (cc *confirmCmd) RequiredRole() string {
+	return ""
+}
+func (cc *confirmCmd) Steps(sess *session.Session) []interfaces.Step {
+	return []interfaces.Step{{Prompt: "Enter one\\-time code to confirm:", Validate: validateCode}}
+}
+func (cc *confirmCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (cc *confirmCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	actionRes := &actionResult{resetSpamFilter: false}
+
+	usr, err := userByID(cc.db.WithContext(r.Context()), sess.User.Id)
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot confirm] loading user %d failed: %s", sess.User.Id, err)
+		r.InternalError()
+		return actionRes
+	}
+	if !cc.otp.check(r, usr, params[0], `Wrong code, try again with /confirm \<code\>`) {
+		return actionRes
+	}
+
+	sess.OtpAt = time.Now()
+	actionRes.resetSpamFilter = true
+	r.ReplyWithMessage("Confirmed")
+	return actionRes
+}
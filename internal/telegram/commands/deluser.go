@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Reloader сервис, который держит записи базы в памяти и перечитывает их после изменений в обход него
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+type delUserCmd struct {
+	db       *gorm.DB
+	sessions *session.Storage
+	caches   []Reloader
+}
+
+// DelUser caches сервисы алертов, правил и заданий, nil пропускаются
+func DelUser(db *gorm.DB, sessions *session.Storage, caches ...Reloader) *delUserCmd {
+	return &delUserCmd{db: db, sessions: sessions, caches: caches}
+}
+func (dc *delUserCmd) Cmd() string {
+	return "deluser"
+}
+func (dc *delUserCmd) Description() string {
+	return "Удаление пользователя"
+}
+func (dc *delUserCmd) Usage() string {
+	return `Для удаления пользователя вместе с его ролью и доступами используйте
+/deluser \<логин\>
+
+Алерты из его чата удаляются, правила и задания выключаются`
+}
+func (dc *delUserCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (dc *delUserCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (dc *delUserCmd) IsAuthRequired() bool {
+	return true
+}
+func (dc *delUserCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (dc *delUserCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 {
+		r.Usage()
+		return true
+	}
+	if params[0] == sess.User.Login {
+		r.ReplyWithMessage("You can't delete yourself")
+		return true
+	}
+	return false
+}
+func (dc *delUserCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	usr, ok := findUser(dc.db, r, params[0])
+	if !ok {
+		return (*actionResult)(nil)
+	}
+
+	err := dc.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", usr.ID).Delete(&orm.Grant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", usr.ID).Delete(&orm.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", usr.ID).Delete(&orm.UserRole{}).Error; err != nil {
+			return err
+		}
+		if usr.ChatID != 0 {
+			// без владельца алерты и действия продолжили бы писать в его чат
+			if err := tx.Unscoped().Where("chat_id = ?", usr.ChatID).Delete(&orm.Alert{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&orm.Rule{}).Where("chat_id = ?", usr.ChatID).Update("enabled", false).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&orm.Job{}).Where("chat_id = ?", usr.ChatID).Update("enabled", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&orm.User{}, usr.ID).Error
+	})
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot deluser] %s failed: %s", usr.Login, err)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+	dc.sessions.KillUser(int64(usr.ID))
+	for _, c := range dc.caches {
+		if c == nil {
+			continue
+		}
+		if err := c.Reload(r.Context()); err != nil {
+			log.WithContext(r.Context()).Errorf("[TG Bot deluser] reloading after %s failed: %s", usr.Login, err)
+		}
+	}
+	log.WithContext(r.Context()).Infof("[TG Bot deluser] %s by %s", usr.Login, sess.User.Login)
+	r.ReplyWithMessage(escape(fmt.Sprintf("%s deleted", usr.Login)))
+	return (*actionResult)(nil)
+}
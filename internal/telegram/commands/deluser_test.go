@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+)
+
+type testReloader struct {
+	reloads int
+}
+
+func (r *testReloader) Reload(ctx context.Context) error {
+	r.reloads++
+	return nil
+}
+
+func TestDelUserCleansUp(t *testing.T) {
+	db := testDB(t)
+	if err := db.AutoMigrate(&orm.Grant{}, &orm.Alert{}, &orm.Rule{}, &orm.Job{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	alice := testUser(t, db, "alice", access.RoleUser, 7)
+	testUser(t, db, "bob", access.RoleUser, 8)
+	for _, chat := range []int64{7, 8} {
+		db.Create(&orm.Alert{ChatID: chat, DeviceID: "door"})
+		db.Create(&orm.Rule{Name: fmt.Sprint("rule", chat), Enabled: true, ChatID: chat})
+		db.Create(&orm.Job{Name: fmt.Sprint("job", chat), Enabled: true, ChatID: chat})
+	}
+	db.Create(&orm.Grant{UserID: alice.ID, DeviceID: "door", Level: access.LevelRead})
+
+	sessions := session.New()
+	sessions.LogIn(7, session.MakeUser(int64(alice.ID), alice.Login, access.RoleUser))
+	caches := []*testReloader{{}, {}, {}}
+	admin := &session.Session{ChatID: 1, User: session.MakeUser(1, "admin", access.RoleAdmin)}
+	r := &testReplier{}
+	DelUser(db, sessions, caches[0], caches[1], nil, caches[2]).Action(r, []string{"alice"}, admin)
+	if len(r.replies) != 1 || r.replies[0] != "alice deleted" {
+		t.Fatalf("replies %v", r.replies)
+	}
+
+	counts := []struct {
+		name  string
+		model any
+		where string
+		want  int64
+	}{
+		{"alice", &orm.User{}, "login = 'alice'", 0},
+		{"alice grants", &orm.Grant{}, fmt.Sprint("user_id = ", alice.ID), 0},
+		{"alice alerts", &orm.Alert{}, "chat_id = 7", 0},
+		{"alice enabled rules", &orm.Rule{}, "chat_id = 7 AND enabled", 0},
+		{"alice enabled jobs", &orm.Job{}, "chat_id = 7 AND enabled", 0},
+		{"alice rules kept", &orm.Rule{}, "chat_id = 7", 1},
+		{"bob alerts", &orm.Alert{}, "chat_id = 8", 1},
+		{"bob enabled rules", &orm.Rule{}, "chat_id = 8 AND enabled", 1},
+		{"bob enabled jobs", &orm.Job{}, "chat_id = 8 AND enabled", 1},
+	}
+	for _, c := range counts {
+		var n int64
+		if err := db.Model(c.model).Where(c.where).Count(&n).Error; err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if n != c.want {
+			t.Errorf("%s: %d, want %d", c.name, n, c.want)
+		}
+	}
+	for i, c := range caches {
+		if c.reloads != 1 {
+			t.Errorf("cache %d reloaded %d times, want 1", i, c.reloads)
+		}
+	}
+	if sessions.Session(7).IsAuthenticated() {
+		t.Errorf("session of alice survived")
+	}
+}
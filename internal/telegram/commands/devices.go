@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/telegram/callback"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// Access проверка и выдача доступа к устройствам
+type Access interface {
+	CanRead(userID uint, role string, deviceID string) bool
+	CanControl(userID uint, role string, deviceID string) bool
+	GrantDevice(userID uint, deviceID string, level string) error
+	GrantRoom(userID uint, room string, level string) error
+	Revoke(userID uint, target string) (int64, error)
+	AssignRoom(deviceID string, room string) error
+}
+
+// свойство, которое переключают кнопки в списке устройств
+const toggleProperty = "state"
+
+const (
+	actionToggle  = "toggle"
+	actionRefresh = "refresh"
+)
+
+type devicesCmd struct {
+	devices *device.Registry
+	access  Access
+}
+
+func Devices(devices *device.Registry, access Access) *devicesCmd {
+	return &devicesCmd{devices: devices, access: access}
+}
+func (dc *devicesCmd) Cmd() string {
+	return "devices"
+}
+func (dc *devicesCmd) Description() string {
+	return "Список устройств и их последние значения"
+}
+func (dc *devicesCmd) Usage() string {
+	return `Для просмотра списка устройств используйте
+/devices`
+}
+func (dc *devicesCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (dc *devicesCmd) IsAuthRequired() bool {
+	return true
+}
+func (dc *devicesCmd) RequiredRole() string {
+	return access.RoleGuest
+}
+func (dc *devicesCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	return false
+}
+func (dc *devicesCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	msg, kb := dc.render(r.Context(), sess)
+	if kb == nil {
+		r.ReplyWithMessage(msg)
+	} else {
+		r.ReplyWithKeyboard(msg, *kb)
+	}
+	return (*actionResult)(nil)
+}
+
+// CallbackSecurityLevel переключение меняет состояние устройства, как /set
+func (dc *devicesCmd) CallbackSecurityLevel(p callback.Payload) int {
+	if p.Action == actionToggle {
+		return domain.SecurityLevelSensitive
+	}
+	return domain.SecurityLevelNormal
+}
+
+// Callback кнопки переключения устройств и обновления списка
+func (dc *devicesCmd) Callback(r interfaces.Replier, p callback.Payload, sess *session.Session) {
+	switch p.Action {
+	case actionToggle:
+		r.AnswerCallback(dc.toggle(r.Context(), p.Arg(0), sess))
+	case actionRefresh:
+	default:
+		log.WithContext(r.Context()).Warnf("[TG Bot devices] unknown callback action %s", p.Action)
+		return
+	}
+	msg, kb := dc.render(r.Context(), sess)
+	r.EditMessage(msg, kb)
+}
+
+func (dc *devicesCmd) toggle(ctx context.Context, id string, sess *session.Session) string {
+	if !dc.access.CanControl(uint(sess.User.Id), sess.User.Role, id) {
+		return fmt.Sprintf("Access to %s denied", id)
+	}
+	act, ok := dc.devices.Actuator(id)
+	if !ok {
+		return fmt.Sprintf("Actuator %s not found", id)
+	}
+	state, err := act.State()
+	if err != nil {
+		return fmt.Sprintf("Reading %s failed: %s", id, err)
+	}
+	v, ok := toggled(state[toggleProperty])
+	if !ok {
+		return fmt.Sprintf("%s can't be toggled", id)
+	}
+
+	err = act.SetState(device.Values{toggleProperty: v})
+	if err != nil {
+		log.WithContext(ctx).Errorf("[TG Bot devices] toggling %s failed: %s", id, err)
+		return fmt.Sprintf("Toggling %s failed: %s", id, err)
+	}
+	return fmt.Sprintf("%s: %s", act.Name(), v)
+}
+
+// render список доступных устройств и кнопки переключения тех, которыми можно управлять
+func (dc *devicesCmd) render(ctx context.Context, sess *session.Session) (string, *tgbotapi.InlineKeyboardMarkup) {
+	var devs []device.Device
+	for _, d := range dc.devices.Devices() {
+		if dc.access.CanRead(uint(sess.User.Id), sess.User.Role, d.ID()) {
+			devs = append(devs, d)
+		}
+	}
+	if len(devs) == 0 {
+		return "No devices registered", nil
+	}
+
+	sb := strings.Builder{}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, d := range devs {
+		sb.WriteString(fmt.Sprintf("*%s* \\(%s\\)\n", escape(d.Name()), escape(d.ID())))
+
+		vals := dc.devices.Values(d.ID())
+		props := make([]string, 0, len(vals))
+		for p := range vals {
+			props = append(props, p)
+		}
+		sort.Strings(props)
+		for _, p := range props {
+			sb.WriteString(fmt.Sprintf(" \\* %s: %s\n", escape(p), escape(vals[p].String())))
+		}
+
+		if btn, ok := dc.toggleButton(ctx, d, vals, sess); ok {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
+		}
+	}
+
+	refresh, err := callback.Button("🔄 Refresh", callback.New(dc.Cmd(), actionRefresh))
+	if err != nil {
+		log.WithContext(ctx).Errorf("[TG Bot devices] refresh button: %s", err)
+		return sb.String(), nil
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(refresh))
+	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &kb
+}
+
+func (dc *devicesCmd) toggleButton(ctx context.Context, d device.Device, vals device.Values, sess *session.Session) (tgbotapi.InlineKeyboardButton, bool) {
+	if _, ok := d.(device.Actuator); !ok {
+		return tgbotapi.InlineKeyboardButton{}, false
+	}
+	v, ok := vals[toggleProperty]
+	if _, canToggle := toggled(v); !ok || !canToggle {
+		return tgbotapi.InlineKeyboardButton{}, false
+	}
+	if !dc.access.CanControl(uint(sess.User.Id), sess.User.Role, d.ID()) {
+		return tgbotapi.InlineKeyboardButton{}, false
+	}
+
+	btn, err := callback.Button(fmt.Sprintf("%s: %s", d.Name(), v), callback.New(dc.Cmd(), actionToggle, d.ID()))
+	if err != nil {
+		log.WithContext(ctx).Warnf("[TG Bot devices] no toggle button for %s: %s", d.ID(), err)
+		return tgbotapi.InlineKeyboardButton{}, false
+	}
+	return btn, true
+}
+
+// toggled противоположное значение для булевых состояний и строк ON/OFF
+func toggled(v device.Value) (device.Value, bool) {
+	switch v.Type {
+	case device.TypeBool:
+		return device.Bool(!v.Bool), true
+	case device.TypeString:
+		on, off := "ON", "OFF"
+		if strings.ToLower(v.Str) == v.Str {
+			on, off = "on", "off"
+		}
+		switch {
+		case strings.EqualFold(v.Str, "on"):
+			return device.String(off), true
+		case strings.EqualFold(v.Str, "off"):
+			return device.String(on), true
+		}
+	}
+	return device.Value{}, false
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	"gorm.io/gorm"
+)
+
+type grantCmd struct {
+	db     *gorm.DB
+	access Access
+}
+
+func Grant(db *gorm.DB, access Access) *grantCmd {
+	return &grantCmd{db: db, access: access}
+}
+func (gc *grantCmd) Cmd() string {
+	return "grant"
+}
+func (gc *grantCmd) Description() string {
+	return "Выдача доступа к устройству или комнате"
+}
+func (gc *grantCmd) Usage() string {
+	return `Для выдачи доступа используйте
+/grant \<логин\> device \<устройство\> read\|control
+/grant \<логин\> room \<комната\> read\|control
+
+Пользователи и администраторы имеют доступ ко всем устройствам, гости только к выданным`
+}
+func (gc *grantCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (gc *grantCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (gc *grantCmd) IsAuthRequired() bool {
+	return true
+}
+func (gc *grantCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (gc *grantCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 4 || params[1] != "device" && params[1] != "room" {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (gc *grantCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	usr, ok := findUser(gc.db, r, params[0])
+	if !ok {
+		return (*actionResult)(nil)
+	}
+
+	var err error
+	target, level := params[2], params[3]
+	if params[1] == "device" {
+		err = gc.access.GrantDevice(usr.ID, target, level)
+	} else {
+		err = gc.access.GrantRoom(usr.ID, target, level)
+	}
+	if err != nil {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Grant failed: %s", err)))
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("%s: %s access to %s %s granted", usr.Login, level, params[1], target)))
+	return (*actionResult)(nil)
+}
@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/scheduler"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+)
+
+type Scheduler interface {
+	Jobs(ctx context.Context) ([]scheduler.JobInfo, error)
+	AddJob(ctx context.Context, name string, spec string, actions string, chatID int64, role string) error
+	SetJobSpec(ctx context.Context, name string, spec string) error
+	SetJobActions(ctx context.Context, name string, actions string, chatID int64, role string) error
+	EnableJob(ctx context.Context, name string, enabled bool) error
+	RemoveJob(ctx context.Context, name string) error
+	Reload(ctx context.Context) error
+}
+
+type jobCmd struct {
+	jobs Scheduler
+}
+
+type jobAddParams struct {
+	Spec    string          `json:"spec"`
+	Actions json.RawMessage `json:"actions"`
+}
+
+func Job(jobs Scheduler) *jobCmd {
+	return &jobCmd{jobs: jobs}
+}
+func (jc *jobCmd) Cmd() string {
+	return "job"
+}
+func (jc *jobCmd) Description() string {
+	return "Управление заданиями по расписанию"
+}
+func (jc *jobCmd) Usage() string {
+	return `Управление заданиями по расписанию:
+/job list
+/job add \<имя\> \<json задания\>
+/job spec \<имя\> \<расписание\>
+/job actions \<имя\> \<json действий\>
+/job on \<имя\>
+/job off \<имя\>
+/job remove \<имя\>
+
+Расписание это cron выражение \(` + "`0 7 * * 1-5`" + `\) или восход/закат со смещением \(` + "`sunset-30m`" + `\)
+Пример задания:
+` + "`" + `{"spec":"sunset","actions":[{"type":"set","device":"hall_lamp","property":"state","value":true}]}` + "`"
+}
+func (jc *jobCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+
+// ParamsSecurityLevel задание с новыми действиями или включённое задание управляет устройствами, как /set
+func (jc *jobCmd) ParamsSecurityLevel(params []string) int {
+	if len(params) > 0 && (params[0] == "add" || params[0] == "actions" || params[0] == "on") {
+		return domain.SecurityLevelSensitive
+	}
+	return domain.SecurityLevelNormal
+}
+func (jc *jobCmd) IsAuthRequired() bool {
+	return true
+}
+func (jc *jobCmd) RequiredRole() string {
+	return access.RoleUser
+}
+func (jc *jobCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 {
+		r.Usage()
+		return true
+	}
+	switch params[0] {
+	case "list":
+		return false
+	case "add", "spec", "actions":
+		if len(params) < 3 {
+			r.Usage()
+			return true
+		}
+	default:
+		if len(params) < 2 {
+			r.Usage()
+			return true
+		}
+	}
+	return false
+}
+func (jc *jobCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	var err error
+	switch params[0] {
+	case "list":
+		jc.list(r)
+		return (*actionResult)(nil)
+	case "add":
+		p := jobAddParams{}
+		err = json.Unmarshal([]byte(strings.Join(params[2:], " ")), &p)
+		if err == nil {
+			err = jc.jobs.AddJob(r.Context(), params[1], p.Spec, string(p.Actions), sess.ChatID, sess.User.Role)
+		}
+	case "spec":
+		err = jc.jobs.SetJobSpec(r.Context(), params[1], strings.Join(params[2:], " "))
+	case "actions":
+		err = jc.jobs.SetJobActions(r.Context(), params[1], strings.Join(params[2:], " "), sess.ChatID, sess.User.Role)
+	case "on":
+		err = jc.jobs.EnableJob(r.Context(), params[1], true)
+	case "off":
+		err = jc.jobs.EnableJob(r.Context(), params[1], false)
+	case "remove":
+		err = jc.jobs.RemoveJob(r.Context(), params[1])
+	default:
+		r.Usage()
+		return (*actionResult)(nil)
+	}
+
+	if err != nil {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Job %s: %s", params[1], err)))
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("Job %s: ok", params[1])))
+	return (*actionResult)(nil)
+}
+
+func (jc *jobCmd) list(r interfaces.Replier) {
+	jobs, err := jc.jobs.Jobs(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot job] listing failed: %s", err)
+		r.InternalError()
+		return
+	}
+	if len(jobs) == 0 {
+		r.ReplyWithMessage("No jobs")
+		return
+	}
+
+	sb := strings.Builder{}
+	for _, j := range jobs {
+		next := "off"
+		if j.Enabled {
+			next = "never"
+			if !j.Next.IsZero() {
+				next = j.Next.Format(time.DateTime)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("*%s* `%s`, next: %s\n`%s`\n", escape(j.Name), escapeCode(j.Spec), escape(next), escapeCode(j.Actions)))
+	}
+	r.ReplyWithMessage(sb.String())
+}
@@ -7,19 +7,20 @@ import (
 	"github.com/Farengier/smart-home/internal/telegram/domain"
 	"github.com/Farengier/smart-home/internal/telegram/interfaces"
 	"github.com/Farengier/smart-home/internal/telegram/session"
-	"github.com/jltorresm/otpgo"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"time"
 )
 
 const wrongCreds = "Wrong credentials"
 
 type loginCmd struct {
-	db *gorm.DB
+	db  *gorm.DB
+	otp *otpChecker
 }
 
-func Login(db *gorm.DB) *loginCmd {
-	return &loginCmd{db: db}
+func Login(db *gorm.DB, messenger Messenger) *loginCmd {
+	return &loginCmd{db: db, otp: &otpChecker{db: db, messenger: messenger}}
 }
 func (lc *loginCmd) Cmd() string {
 	return "login"
@@ -29,7 +30,10 @@ func (lc *loginCmd) Description() string {
 }
 func (lc *loginCmd) Usage() string {
 	return `Для авторизации пользователя используйте команду
-/login \<логин пользователя\> \<одноразовый код\>`
+/login \<логин пользователя\> \<одноразовый код\>
+
+Вместо одноразового кода можно использовать код восстановления
+Или просто /login, логин и код будут запрошены по очереди`
 }
 func (lc *loginCmd) FloodControlLevel() int {
 	return domain.SpamLevelSensitive
@@ -37,9 +41,21 @@ func (lc *loginCmd) FloodControlLevel() int {
 func (lc *loginCmd) IsAuthRequired() bool {
 	return false
 }
+func (lc *loginCmd) RequiredRole() string {
+	return ""
+}
+func (lc *loginCmd) Steps(sess *session.Session) []interfaces.Step {
+	if sess.IsAuthenticated() {
+		return nil
+	}
+	return []interfaces.Step{
+		{Prompt: "Enter login:"},
+		{Prompt: "Enter one\\-time code:", Validate: validateCode},
+	}
+}
 func (lc *loginCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
 	if sess.IsAuthenticated() {
-		r.ReplyWithMessage(fmt.Sprintf("Already authenticated as %s [%s]", sess.User.Role, sess.User.Login))
+		r.ReplyWithMessage(escape(fmt.Sprintf("Already authenticated as %s [%s]", sess.User.Role, sess.User.Login)))
 		return true
 	}
 
@@ -56,31 +72,42 @@ func (lc *loginCmd) Action(r interfaces.Replier, params []string, sess *session.
 	login := params[0]
 	code := params[1]
 	usr := &orm.User{}
-	dbres := lc.db.Model(orm.User{}).Joins("Role").First(usr, orm.User{Login: login})
+	dbres := lc.db.WithContext(r.Context()).Model(orm.User{}).Joins("Role").First(usr, orm.User{Login: login})
 
 	if errors.Is(dbres.Error, gorm.ErrRecordNotFound) {
 		r.ReplyWithMessage(wrongCreds)
 		return actionRes
 	}
 
-	totp := otpgo.TOTP{
-		Key: usr.OtpKey,
+	if usr.Blocked {
+		log.WithContext(r.Context()).Warnf("[TG Bot Auth] blocked user %s tried to log in", usr.Login)
+		r.ReplyWithMessage("User is blocked")
+		return actionRes
 	}
-	ok, err := totp.Validate(code)
-	if err != nil {
-		log.Errorf("[TG Bot Auth Totp] validating error: %s", err)
-		r.ReplyWithMessage("Internal error, please contact admin")
+	switch usr.Status {
+	case orm.UserPending:
+		r.ReplyWithMessage("Registration is waiting for admin approval")
+		return actionRes
+	case orm.UserRejected:
+		r.ReplyWithMessage("Registration was rejected")
 		return actionRes
 	}
-	if !ok {
-		r.ReplyWithMessage(wrongCreds)
+
+	// код проверяется последним, чтобы код восстановления не тратился на вход, который всё равно не состоится
+	if !lc.otp.check(r, usr, code, wrongCreds) {
 		return actionRes
 	}
 
-	u := session.MakeUser(0, usr.Login, usr.Role.Role)
+	res := lc.db.WithContext(r.Context()).Model(&orm.User{}).Where("id = ?", usr.ID).Update("chat_id", sess.ChatID)
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot Auth] saving chat of %s failed: %s", usr.Login, res.Error)
+	}
+
+	u := session.MakeUser(int64(usr.ID), usr.Login, usr.Role.Role)
 	sess.User = u
+	sess.OtpAt = time.Now()
 	actionRes.resetSpamFilter = true
 
-	r.ReplyWithMessage(fmt.Sprintf("Successfully authenticated as %s [%s]", u.Role, u.Login))
+	r.ReplyWithMessage(escape(fmt.Sprintf("Successfully authenticated as %s [%s]", u.Role, u.Login)))
 	return actionRes
 }
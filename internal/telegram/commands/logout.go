@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+)
+
+type logoutCmd struct {
+}
+
+func Logout() *logoutCmd {
+	return &logoutCmd{}
+}
+func (lc *logoutCmd) Cmd() string {
+	return "logout"
+}
+func (lc *logoutCmd) Description() string {
+	return "Завершение сессии"
+}
+func (lc *logoutCmd) Usage() string {
+	return `Для завершения сессии используйте
+/logout`
+}
+func (lc *logoutCmd) FloodControlLevel() int {
+	return domain.SpamLevelNone
+}
+func (lc *logoutCmd) IsAuthRequired() bool {
+	// иначе /logout откладывался бы до входа и сразу завершал новую сессию
+	return false
+}
+func (lc *logoutCmd) RequiredRole() string {
+	return ""
+}
+func (lc *logoutCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	return false
+}
+func (lc *logoutCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	if !sess.IsAuthenticated() {
+		r.ReplyWithMessage("Not logged in")
+		return (*actionResult)(nil)
+	}
+	// сохранённая сессия удаляется диспетчером после выполнения команды
+	sess.Clear()
+	r.ReplyWithMessage("Logged out")
+	return (*actionResult)(nil)
+}
@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/jltorresm/otpgo"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	otpPeriod = otpgo.TOTPDefaultPeriod
+	// на сколько шагов в обе стороны допускаем расхождение часов
+	otpDelay = otpgo.TOTPDefaultDelay
+)
+
+// после стольких неверных кодов подряд логин блокируется на lockoutDuration
+const maxFailedLogins = 5
+const lockoutDuration = time.Minute * 15
+
+func validateCode(code string) error {
+	if isRecoveryCode(code) {
+		return nil
+	}
+	if len(code) != 6 || strings.Trim(code, "0123456789") != "" {
+		return errors.New("code must be 6 digits or a recovery code")
+	}
+	return nil
+}
+
+// otpChecker проверяет одноразовые коды с защитой от повторного использования и подбора.
+// Счётчики хранятся у пользователя в БД, поэтому не сбрасываются сменой чата
+type otpChecker struct {
+	db        *gorm.DB
+	messenger Messenger
+}
+
+// check проверяет код пользователя. При отказе сам отвечает в чат, на неверный код сообщением wrongMsg
+func (oc *otpChecker) check(r interfaces.Replier, usr *orm.User, code string, wrongMsg string) bool {
+	now := time.Now()
+	if usr.LockedUntil != nil && now.Before(*usr.LockedUntil) {
+		wait := usr.LockedUntil.Sub(now).Truncate(time.Second) + time.Second
+		r.ReplyWithMessage(escape(fmt.Sprintf("Too many failed attempts, try again after %s", wait)))
+		return false
+	}
+
+	if isRecoveryCode(code) {
+		return oc.recover(r, usr, code, wrongMsg, now)
+	}
+
+	step, ok, err := otpStep(usr.OtpKey, code, now)
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot Otp] validating error: %s", err)
+		r.InternalError()
+		return false
+	}
+	if ok {
+		// условие на шаг в самом запросе, чтобы одновременные попытки не приняли один код дважды
+		res := oc.db.WithContext(r.Context()).Model(&orm.User{}).
+			Where("id = ? AND last_otp_step < ?", usr.ID, step).
+			Updates(map[string]any{"last_otp_step": step, "failed_logins": 0, "locked_until": nil})
+		if res.Error != nil {
+			log.WithContext(r.Context()).Errorf("[TG Bot Otp] saving step of %s failed: %s", usr.Login, res.Error)
+			r.InternalError()
+			return false
+		}
+		if res.RowsAffected > 0 {
+			return true
+		}
+		log.WithContext(r.Context()).Warnf("[TG Bot Otp] replayed code of %s", usr.Login)
+	}
+
+	oc.fail(r.Context(), usr, now)
+	r.ReplyWithMessage(wrongMsg)
+	return false
+}
+
+// recover проверяет код восстановления вместо одноразового кода
+func (oc *otpChecker) recover(r interfaces.Replier, usr *orm.User, code string, wrongMsg string, now time.Time) bool {
+	ok, err := useRecoveryCode(oc.db.WithContext(r.Context()), usr.ID, code)
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot Otp] checking recovery code of %s failed: %s", usr.Login, err)
+		r.InternalError()
+		return false
+	}
+	if !ok {
+		oc.fail(r.Context(), usr, now)
+		r.ReplyWithMessage(wrongMsg)
+		return false
+	}
+
+	res := oc.db.WithContext(r.Context()).Model(&orm.User{}).Where("id = ?", usr.ID).
+		Updates(map[string]any{"failed_logins": 0, "locked_until": nil})
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot Otp] resetting failures of %s failed: %s", usr.Login, res.Error)
+	}
+	left, err := recoveryCodesLeft(oc.db.WithContext(r.Context()), usr.ID)
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot Otp] counting recovery codes of %s failed: %s", usr.Login, err)
+	}
+	log.WithContext(r.Context()).Warnf("[TG Bot Otp] %s used a recovery code, %d left", usr.Login, left)
+	r.ReplyWithMessage(escape(fmt.Sprintf("Recovery code accepted, %d left. Use /recovery to get new ones", left)))
+	return true
+}
+
+func (oc *otpChecker) fail(ctx context.Context, usr *orm.User, now time.Time) {
+	rec := &orm.User{}
+	res := oc.db.WithContext(ctx).Model(rec).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_logins"}}}).
+		Where("id = ?", usr.ID).
+		Update("failed_logins", gorm.Expr("failed_logins + 1"))
+	if res.Error != nil {
+		log.WithContext(ctx).Errorf("[TG Bot Otp] counting failure of %s failed: %s", usr.Login, res.Error)
+		return
+	}
+	log.WithContext(ctx).Warnf("[TG Bot Otp] wrong code of %s, %d failures in a row", usr.Login, rec.FailedLogins)
+	if rec.FailedLogins < maxFailedLogins {
+		return
+	}
+
+	until := now.Add(lockoutDuration)
+	res = oc.db.WithContext(ctx).Model(&orm.User{}).Where("id = ?", usr.ID).
+		Updates(map[string]any{"failed_logins": 0, "locked_until": until})
+	if res.Error != nil {
+		log.WithContext(ctx).Errorf("[TG Bot Otp] locking %s failed: %s", usr.Login, res.Error)
+		return
+	}
+	log.WithContext(ctx).Warnf("[TG Bot Otp] %s locked until %s", usr.Login, until.Format(time.DateTime))
+	oc.notifyAdmins(ctx, fmt.Sprintf("🔒 %s is locked for %s after %d wrong one-time codes", usr.Login, lockoutDuration, rec.FailedLogins))
+}
+
+func (oc *otpChecker) notifyAdmins(ctx context.Context, msg string) {
+	chats, err := adminChats(oc.db.WithContext(ctx))
+	if err != nil {
+		log.WithContext(ctx).Errorf("[TG Bot Otp] looking for admins failed: %s", err)
+		return
+	}
+	for _, chat := range chats {
+		oc.messenger.Notify(chat, msg)
+	}
+}
+
+// otpStep ищет шаг TOTP, которому соответствует код, с учётом расхождения часов
+func otpStep(key string, code string, now time.Time) (int64, bool, error) {
+	cur := now.Unix() / otpPeriod
+	for d := int64(0); d <= otpDelay; d++ {
+		for _, step := range []int64{cur - d, cur + d} {
+			h := otpgo.HOTP{Key: key, Counter: uint64(step)}
+			expected, err := h.Generate()
+			if err != nil {
+				return 0, false, err
+			}
+			if expected == code {
+				return step, true, nil
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+// adminChats чаты незаблокированных админов, которые хоть раз авторизовались
+func adminChats(db *gorm.DB) ([]int64, error) {
+	var chats []int64
+	res := db.Model(&orm.User{}).Joins("Role").
+		Where("Role.role = ? AND users.chat_id <> 0 AND users.blocked = ?", access.RoleAdmin, false).
+		Pluck("users.chat_id", &chats)
+	return chats, res.Error
+}
+
+func userByID(db *gorm.DB, id int64) (*orm.User, error) {
+	usr := &orm.User{}
+	res := db.Joins("Role").Where("users.id = ?", id).Limit(1).Find(usr)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return usr, nil
+}
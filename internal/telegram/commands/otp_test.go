@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jltorresm/otpgo"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testOtpKey = "JBSWY3DPEHPK3PXP"
+
+type testReplier struct {
+	replies []string
+}
+
+func (r *testReplier) Context() context.Context    { return context.Background() }
+func (r *testReplier) InternalError()              { r.replies = append(r.replies, "internal error") }
+func (r *testReplier) Usage()                      { r.replies = append(r.replies, "usage") }
+func (r *testReplier) ReplyWithMessage(msg string) { r.replies = append(r.replies, msg) }
+func (r *testReplier) ReplyWithKeyboard(msg string, _ tgbotapi.InlineKeyboardMarkup) {
+	r.replies = append(r.replies, msg)
+}
+func (r *testReplier) SensitivePicture(_ io.Reader) {}
+func (r *testReplier) SensitiveMessage(msg string)  { r.replies = append(r.replies, msg) }
+func (r *testReplier) AnswerCallback(_ string)      {}
+func (r *testReplier) EditMessage(msg string, _ *tgbotapi.InlineKeyboardMarkup) {
+	r.replies = append(r.replies, msg)
+}
+
+type testMessenger struct {
+	sent map[int64][]string
+}
+
+func (m *testMessenger) Notify(chatID int64, msg string) {
+	m.sent[chatID] = append(m.sent[chatID], msg)
+}
+func (m *testMessenger) NotifyWithKeyboard(chatID int64, msg string, _ tgbotapi.InlineKeyboardMarkup) {
+	m.Notify(chatID, msg)
+}
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&orm.User{}, &orm.UserRole{}, &orm.RecoveryCode{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	return db
+}
+
+func testUser(t *testing.T, db *gorm.DB, login string, role string, chatID int64) *orm.User {
+	t.Helper()
+	u := &orm.User{Login: login, OtpKey: testOtpKey, ChatID: chatID, Status: orm.UserApproved, Role: orm.UserRole{Role: role}}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatalf("create user: %s", err)
+	}
+	return u
+}
+
+func codeAt(t *testing.T, step int64) string {
+	t.Helper()
+	code, err := (&otpgo.HOTP{Key: testOtpKey, Counter: uint64(step)}).Generate()
+	if err != nil {
+		t.Fatalf("generate code: %s", err)
+	}
+	return code
+}
+
+func TestOtpStep(t *testing.T) {
+	now := time.Unix(1686000015, 0)
+	cur := now.Unix() / otpPeriod
+	cases := []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{"current", codeAt(t, cur), cur, true},
+		{"previous", codeAt(t, cur-1), cur - 1, true},
+		{"next", codeAt(t, cur+1), cur + 1, true},
+		{"too old", codeAt(t, cur-2), 0, false},
+		{"too new", codeAt(t, cur+2), 0, false},
+		{"wrong", "000000", 0, false},
+	}
+	for _, c := range cases {
+		// код старого шага может случайно совпасть с кодом соседнего
+		if !c.ok && (c.code == codeAt(t, cur) || c.code == codeAt(t, cur-1) || c.code == codeAt(t, cur+1)) {
+			continue
+		}
+		step, ok, err := otpStep(testOtpKey, c.code, now)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if ok != c.ok || step != c.step {
+			t.Errorf("%s: step %d %v, want %d %v", c.name, step, ok, c.step, c.ok)
+		}
+	}
+}
+
+func TestOtpReplay(t *testing.T) {
+	db := testDB(t)
+	usr := testUser(t, db, "alice", access.RoleUser, 7)
+	oc := &otpChecker{db: db, messenger: &testMessenger{sent: map[int64][]string{}}}
+	cur := time.Now().Unix() / otpPeriod
+
+	cases := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"fresh code", codeAt(t, cur-1), true},
+		{"same code again", codeAt(t, cur-1), false},
+		{"newer step", codeAt(t, cur), true},
+		{"older step after newer", codeAt(t, cur-1), false},
+		{"replayed newest", codeAt(t, cur), false},
+		{"next step", codeAt(t, cur+1), true},
+	}
+	for _, c := range cases {
+		r := &testReplier{}
+		fresh, _ := userByID(db, int64(usr.ID))
+		if got := oc.check(r, fresh, c.code, "wrong"); got != c.ok {
+			t.Errorf("%s: accepted %v, want %v (replies %v)", c.name, got, c.ok, r.replies)
+		}
+		if !c.ok && (len(r.replies) != 1 || r.replies[0] != "wrong") {
+			t.Errorf("%s: replies %v", c.name, r.replies)
+		}
+	}
+
+	var saved orm.User
+	db.First(&saved, usr.ID)
+	if saved.LastOtpStep != cur+1 {
+		t.Errorf("last step %d, want %d", saved.LastOtpStep, cur+1)
+	}
+	// принятый код сбрасывает счётчик неудач
+	if saved.FailedLogins != 0 {
+		t.Errorf("failed logins %d after accepted code", saved.FailedLogins)
+	}
+}
+
+func TestOtpLockout(t *testing.T) {
+	db := testDB(t)
+	testUser(t, db, "admin", access.RoleAdmin, 1)
+	usr := testUser(t, db, "bob", access.RoleUser, 7)
+	m := &testMessenger{sent: map[int64][]string{}}
+	oc := &otpChecker{db: db, messenger: m}
+
+	for i := 0; i < maxFailedLogins; i++ {
+		fresh, _ := userByID(db, int64(usr.ID))
+		if oc.check(&testReplier{}, fresh, "000000", "wrong") {
+			t.Fatalf("wrong code accepted")
+		}
+	}
+	if len(m.sent[1]) != 1 || !strings.Contains(m.sent[1][0], "bob is locked") {
+		t.Errorf("admin notifications %v", m.sent)
+	}
+
+	fresh, _ := userByID(db, int64(usr.ID))
+	r := &testReplier{}
+	if oc.check(r, fresh, codeAt(t, time.Now().Unix()/otpPeriod), "wrong") {
+		t.Errorf("code accepted while locked")
+	}
+	if len(r.replies) != 1 || !strings.HasPrefix(r.replies[0], "Too many failed attempts") {
+		t.Errorf("replies %v", r.replies)
+	}
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// роли по возрастанию прав
+var roleLadder = []string{access.RoleGuest, access.RoleUser, access.RoleAdmin}
+
+// roleCmd повышает или понижает роль пользователя на одну ступень
+type roleCmd struct {
+	db       *gorm.DB
+	sessions *session.Storage
+	up       bool
+}
+
+func Promote(db *gorm.DB, sessions *session.Storage) *roleCmd {
+	return &roleCmd{db: db, sessions: sessions, up: true}
+}
+func Demote(db *gorm.DB, sessions *session.Storage) *roleCmd {
+	return &roleCmd{db: db, sessions: sessions, up: false}
+}
+func (rc *roleCmd) Cmd() string {
+	if rc.up {
+		return "promote"
+	}
+	return "demote"
+}
+func (rc *roleCmd) Description() string {
+	if rc.up {
+		return "Повышение роли пользователя"
+	}
+	return "Понижение роли пользователя"
+}
+func (rc *roleCmd) Usage() string {
+	return fmt.Sprintf(`Для изменения роли используйте
+/%s \<логин\> \[роль\]
+
+Без роли меняется на одну ступень: guest, user, admin`, rc.Cmd())
+}
+func (rc *roleCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (rc *roleCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (rc *roleCmd) IsAuthRequired() bool {
+	return true
+}
+func (rc *roleCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (rc *roleCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 || len(params) > 1 && !access.IsRole(params[1]) {
+		r.Usage()
+		return true
+	}
+	if !rc.up && params[0] == sess.User.Login {
+		r.ReplyWithMessage("You can't demote yourself")
+		return true
+	}
+	return false
+}
+func (rc *roleCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	usr, ok := findUser(rc.db, r, params[0])
+	if !ok {
+		return (*actionResult)(nil)
+	}
+
+	role := rc.next(usr.Role.Role)
+	if len(params) > 1 {
+		role = params[1]
+	}
+	if role == usr.Role.Role || rc.up != access.RoleAllows(role, usr.Role.Role) {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Can't %s %s [%s] to %s", rc.Cmd(), usr.Login, usr.Role.Role, role)))
+		return (*actionResult)(nil)
+	}
+
+	err := setRole(rc.db.WithContext(r.Context()), usr.ID, role)
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot %s] %s failed: %s", rc.Cmd(), usr.Login, err)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+	rc.sessions.SetRole(int64(usr.ID), role)
+	log.WithContext(r.Context()).Infof("[TG Bot %s] %s: %s -> %s by %s", rc.Cmd(), usr.Login, usr.Role.Role, role, sess.User.Login)
+	r.ReplyWithMessage(escape(fmt.Sprintf("%s is %s now", usr.Login, role)))
+	return (*actionResult)(nil)
+}
+
+// next соседняя роль в нужную сторону, для крайних ролей возвращается она же
+func (rc *roleCmd) next(role string) string {
+	for i, rl := range roleLadder {
+		if rl != role {
+			continue
+		}
+		switch {
+		case rc.up && i < len(roleLadder)-1:
+			return roleLadder[i+1]
+		case !rc.up && i > 0:
+			return roleLadder[i-1]
+		}
+		return role
+	}
+	// неизвестная роль
+	return access.RoleGuest
+}
+
+func setRole(db *gorm.DB, userID uint, role string) error {
+	res := db.Model(&orm.UserRole{}).Where("user_id = ?", userID).Update("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	return db.Create(&orm.UserRole{UserID: int(userID), Role: role}).Error
+}
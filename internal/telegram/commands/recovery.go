@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const recoveryCodesCount = 8
+
+var recoveryCodeRe = regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}$`)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type recoveryCmd struct {
+	db *gorm.DB
+}
+
+func Recovery(db *gorm.DB) *recoveryCmd {
+	return &recoveryCmd{db: db}
+}
+func (rc *recoveryCmd) Cmd() string {
+	return "recovery"
+}
+func (rc *recoveryCmd) Description() string {
+	return "Новые коды восстановления доступа"
+}
+func (rc *recoveryCmd) Usage() string {
+	return `Для выпуска новых кодов восстановления используйте
+/recovery
+
+Старые коды перестанут действовать
+Через минуту сообщение с кодами будет удалено`
+}
+func (rc *recoveryCmd) FloodControlLevel() int {
+	return domain.SpamLevelSensitive
+}
+func (rc *recoveryCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (rc *recoveryCmd) IsAuthRequired() bool {
+	return true
+}
+func (rc *recoveryCmd) RequiredRole() string {
+	return ""
+}
+func (rc *recoveryCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	return false
+}
+func (rc *recoveryCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	codes, err := newRecoveryCodes(rc.db.WithContext(r.Context()), uint(sess.User.Id))
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot recovery] %s: %s", sess.User.Login, err)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+	r.SensitiveMessage(recoveryMessage(codes))
+	return (*actionResult)(nil)
+}
+
+// newRecoveryCodes выпускает новый набор кодов восстановления взамен старого
+func newRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	recs := make([]orm.RecoveryCode, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("generating recovery code failed: %w", err)
+		}
+		s := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+		code := s[:4] + "-" + s[4:]
+		hash, err := hashRecoveryCode(code)
+		if err != nil {
+			return nil, fmt.Errorf("hashing recovery code failed: %w", err)
+		}
+		codes = append(codes, code)
+		recs = append(recs, orm.RecoveryCode{UserID: userID, Hash: hash})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&orm.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&recs).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("saving recovery codes failed: %w", err)
+	}
+	return codes, nil
+}
+
+// useRecoveryCode помечает код использованным. Возвращает false, если кода нет или он уже использован
+func useRecoveryCode(db *gorm.DB, userID uint, code string) (bool, error) {
+	// у каждого хеша своя соль, поэтому код сверяется со всеми неиспользованными
+	var recs []orm.RecoveryCode
+	res := db.Where("user_id = ? AND used_at IS NULL", userID).Find(&recs)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	for _, rec := range recs {
+		err := bcrypt.CompareHashAndPassword([]byte(rec.Hash), []byte(strings.ToLower(code)))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			continue
+		}
+		if err != nil {
+			// например, код выпущен до перехода на bcrypt
+			log.Warnf("[TG Bot recovery] code %d of user %d is unusable: %s", rec.ID, userID, err)
+			continue
+		}
+		// условие на used_at в самом запросе, чтобы одновременные попытки не приняли код дважды
+		res = db.Model(&orm.RecoveryCode{}).Where("id = ? AND used_at IS NULL", rec.ID).Update("used_at", time.Now())
+		return res.RowsAffected > 0, res.Error
+	}
+	return false, nil
+}
+
+func recoveryCodesLeft(db *gorm.DB, userID uint) (int64, error) {
+	var n int64
+	res := db.Model(&orm.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n)
+	return n, res.Error
+}
+
+func isRecoveryCode(code string) bool {
+	return recoveryCodeRe.MatchString(strings.ToLower(code))
+}
+
+// hashRecoveryCode медленный хеш с солью: по утёкшей базе коды не подобрать перебором
+func hashRecoveryCode(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(strings.ToLower(code)), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func recoveryMessage(codes []string) string {
+	return "Recovery codes, each works once instead of a one\\-time code\\. Save them somewhere safe:\n```\n" +
+		escapeCode(strings.Join(codes, "\n")) + "\n```"
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	db := testDB(t)
+	usr := testUser(t, db, "alice", access.RoleUser, 7)
+	codes, err := newRecoveryCodes(db, usr.ID)
+	if err != nil {
+		t.Fatalf("new codes: %s", err)
+	}
+
+	var recs []orm.RecoveryCode
+	db.Where("user_id = ?", usr.ID).Find(&recs)
+	salts := map[string]bool{}
+	for _, rec := range recs {
+		if !strings.HasPrefix(rec.Hash, "$2") {
+			t.Errorf("hash %q is not bcrypt", rec.Hash)
+		}
+		salts[rec.Hash[:29]] = true
+	}
+	if len(recs) != recoveryCodesCount || len(salts) != recoveryCodesCount {
+		t.Errorf("%d codes with %d salts, want %d", len(recs), len(salts), recoveryCodesCount)
+	}
+
+	cases := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"first code", codes[0], true},
+		{"same code again", codes[0], false},
+		{"upper case", strings.ToUpper(codes[1]), true},
+		{"unknown code", "aaaa-aaaa", false},
+	}
+	for _, c := range cases {
+		ok, err := useRecoveryCode(db, usr.ID, c.code)
+		if err != nil || ok != c.ok {
+			t.Errorf("%s: used %v %v, want %v", c.name, ok, err, c.ok)
+		}
+	}
+
+	// код, выпущенный до bcrypt, не принимается, но и не ломает проверку остальных
+	db.Create(&orm.RecoveryCode{UserID: usr.ID, Hash: strings.Repeat("ab", 32)})
+	if ok, err := useRecoveryCode(db, usr.ID, codes[2]); err != nil || !ok {
+		t.Errorf("code next to a legacy hash: used %v %v", ok, err)
+	}
+}
+
+func TestLoginKeepsRecoveryCode(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func(u *orm.User)
+		reply string
+	}{
+		{"blocked", func(u *orm.User) { u.Blocked = true }, "User is blocked"},
+		{"pending", func(u *orm.User) { u.Status = orm.UserPending }, "Registration is waiting for admin approval"},
+		{"rejected", func(u *orm.User) { u.Status = orm.UserRejected }, "Registration was rejected"},
+	}
+	for _, c := range cases {
+		db := testDB(t)
+		usr := testUser(t, db, "alice", access.RoleUser, 7)
+		c.setup(usr)
+		db.Save(usr)
+		codes, err := newRecoveryCodes(db, usr.ID)
+		if err != nil {
+			t.Fatalf("%s: new codes: %s", c.name, err)
+		}
+
+		r := &testReplier{}
+		sess := &session.Session{ChatID: 7}
+		Login(db, &testMessenger{sent: map[int64][]string{}}).Action(r, []string{"alice", codes[0]}, sess)
+		if sess.IsAuthenticated() || len(r.replies) != 1 || r.replies[0] != c.reply {
+			t.Errorf("%s: authenticated %v, replies %v", c.name, sess.IsAuthenticated(), r.replies)
+		}
+		if left, _ := recoveryCodesLeft(db, usr.ID); left != recoveryCodesCount {
+			t.Errorf("%s: %d codes left, want %d", c.name, left, recoveryCodesCount)
+		}
+	}
+}
@@ -1,29 +1,35 @@
 package commands
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/Farengier/smart-home/internal/img"
+	"github.com/Farengier/smart-home/internal/access"
 	"github.com/Farengier/smart-home/internal/telegram/domain"
 	"github.com/Farengier/smart-home/internal/telegram/interfaces"
 	"github.com/Farengier/smart-home/internal/telegram/session"
-	"github.com/jltorresm/otpgo"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
-	"image/png"
 
 	"github.com/Farengier/smart-home/internal/orm"
 )
 
 const totpIssuer = "zy-smart-home"
 
+// Messenger отправка сообщений в другие чаты
+type Messenger interface {
+	Notify(chatID int64, msg string)
+	NotifyWithKeyboard(chatID int64, msg string, kb tgbotapi.InlineKeyboardMarkup)
+}
+
 type registerCmd struct {
-	db *gorm.DB
+	db        *gorm.DB
+	messenger Messenger
 }
 
-func Register(db *gorm.DB) *registerCmd {
-	return &registerCmd{db: db}
+func Register(db *gorm.DB, messenger Messenger) *registerCmd {
+	return &registerCmd{db: db, messenger: messenger}
 }
 func (rc *registerCmd) Cmd() string {
 	return "register"
@@ -36,7 +42,9 @@ func (rc *registerCmd) Usage() string {
 /register \<логин пользователя\>
 
 Держите телефон наготове для сканирования QR\-кода
-Через минуту сообщение с кодом будет удалено`
+Сохраните коды восстановления, они понадобятся при потере телефона
+Через минуту сообщения с кодами будут удалены
+Авторизоваться можно будет после подтверждения регистрации администратором`
 }
 func (rc *registerCmd) FloodControlLevel() int {
 	return domain.SpamLevelSensitive
@@ -44,9 +52,18 @@ func (rc *registerCmd) FloodControlLevel() int {
 func (rc *registerCmd) IsAuthRequired() bool {
 	return false
 }
+func (rc *registerCmd) RequiredRole() string {
+	return ""
+}
+func (rc *registerCmd) Steps(sess *session.Session) []interfaces.Step {
+	if sess.IsAuthenticated() {
+		return nil
+	}
+	return []interfaces.Step{{Prompt: "Enter login for the new user:"}}
+}
 func (rc *registerCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
 	if sess.IsAuthenticated() {
-		r.ReplyWithMessage(fmt.Sprintf("Already authenticated as %s [%s]", sess.User.Role, sess.User.Login))
+		r.ReplyWithMessage(escape(fmt.Sprintf("Already authenticated as %s [%s]", sess.User.Role, sess.User.Login)))
 		return true
 	}
 
@@ -61,49 +78,70 @@ func (rc *registerCmd) Action(r interfaces.Replier, params []string, sess *sessi
 	actionRes := &actionResult{resetSpamFilter: false}
 	login := params[0]
 	usr := &orm.User{}
-	dbres := rc.db.Joins("Role").First(usr, orm.User{Login: login})
+	dbres := rc.db.WithContext(r.Context()).Joins("Role").First(usr, orm.User{Login: login})
 	if !errors.Is(dbres.Error, gorm.ErrRecordNotFound) {
 		r.ReplyWithMessage(fmt.Sprintf("User already registered"))
 		return actionRes
 	}
 
-	totp := otpgo.TOTP{}
-	_, err := totp.Generate()
+	key, qr, err := totpQR(login)
 	if err != nil {
-		log.Errorf("[TG Bot Totp] key generate failed: %s", err)
+		log.WithContext(r.Context()).Errorf("[TG Bot register] %s", err)
 		r.InternalError()
 		return actionRes
 	}
 
-	usr.OtpKey = totp.Key
+	usr.OtpKey = key
 	usr.Login = login
-	usr.Role = orm.UserRole{Role: "user"}
-	rc.db.Create(usr)
-
-	ku := totp.KeyUri(login, totpIssuer)
-	qrcode, err := ku.QRCode()
-	if err != nil {
-		log.Errorf("[TG Bot Totp] key generate failed: %s", err)
+	usr.Role = orm.UserRole{Role: access.RoleUser}
+	usr.Status = orm.UserPending
+	usr.ChatID = sess.ChatID
+	res := rc.db.WithContext(r.Context()).Create(usr)
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot register] saving user %s failed: %s", login, res.Error)
 		r.InternalError()
 		return actionRes
 	}
-
-	im, err := img.ParseB64(qrcode)
+	codes, err := newRecoveryCodes(rc.db.WithContext(r.Context()), usr.ID)
 	if err != nil {
-		log.Errorf("[TG Bot register] img parse failed: %s", err)
+		log.WithContext(r.Context()).Errorf("[TG Bot register] %s: %s", login, err)
 		r.InternalError()
 		return actionRes
 	}
+	rc.notifyAdmins(r.Context(), usr)
 
-	bb := bytes.NewBuffer([]byte{})
-	err = png.Encode(bb, im)
+	actionRes.resetSpamFilter = true
+	r.ReplyWithMessage("Registration request is sent to admins, you can log in after approval")
+	r.SensitivePicture(qr)
+	r.SensitiveMessage(recoveryMessage(codes))
+	return actionRes
+}
+
+// notifyAdmins отправляет заявку на регистрацию всем админам
+func (rc *registerCmd) notifyAdmins(ctx context.Context, usr *orm.User) {
+	admins, err := adminChats(rc.db.WithContext(ctx))
 	if err != nil {
-		log.Errorf("[TG Bot register] encoding img failed: %s", err)
-		r.InternalError()
-		return actionRes
+		log.WithContext(ctx).Errorf("[TG Bot register] looking for admins failed: %s", err)
+		return
+	}
+	if len(admins) == 0 {
+		log.WithContext(ctx).Warnf("[TG Bot register] no admins to approve %s", usr.Login)
+		return
 	}
 
-	actionRes.resetSpamFilter = true
-	r.SensitivePicture(bb)
-	return actionRes
+	msg := fmt.Sprintf("New registration: %s (chat %d)", usr.Login, usr.ChatID)
+	kb, err := approvalKeyboard(usr.Login)
+	if err == nil {
+		for _, chat := range admins {
+			rc.messenger.NotifyWithKeyboard(chat, msg, kb)
+		}
+		return
+	}
+
+	// логин слишком длинный для кнопки, админам придётся ответить командой
+	log.WithContext(ctx).Warnf("[TG Bot register] no buttons for %s: %s", usr.Login, err)
+	msg += fmt.Sprintf("\nUse /approve %s or /reject %s", usr.Login, usr.Login)
+	for _, chat := range admins {
+		rc.messenger.Notify(chat, msg)
+	}
 }
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type resetOtpCmd struct {
+	db       *gorm.DB
+	sessions *session.Storage
+}
+
+func ResetOtp(db *gorm.DB, sessions *session.Storage) *resetOtpCmd {
+	return &resetOtpCmd{db: db, sessions: sessions}
+}
+func (rc *resetOtpCmd) Cmd() string {
+	return "resetotp"
+}
+func (rc *resetOtpCmd) Description() string {
+	return "Выпуск нового ключа одноразовых кодов"
+}
+func (rc *resetOtpCmd) Usage() string {
+	return `Для выпуска нового ключа пользователю используйте
+/resetotp \<логин\>
+
+QR\-код придёт в этот чат и будет удалён через минуту, передайте его пользователю
+Сессии пользователя будут завершены`
+}
+func (rc *resetOtpCmd) FloodControlLevel() int {
+	return domain.SpamLevelSensitive
+}
+func (rc *resetOtpCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (rc *resetOtpCmd) IsAuthRequired() bool {
+	return true
+}
+func (rc *resetOtpCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (rc *resetOtpCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (rc *resetOtpCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	usr, ok := findUser(rc.db, r, params[0])
+	if !ok {
+		return (*actionResult)(nil)
+	}
+
+	key, qr, err := totpQR(usr.Login)
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot resetotp] %s", err)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+
+	// шаг, неудачи и блокировка относились к старому ключу
+	res := rc.db.WithContext(r.Context()).Model(&orm.User{}).Where("id = ?", usr.ID).
+		Updates(map[string]any{"otp_key": key, "last_otp_step": 0, "failed_logins": 0, "locked_until": nil})
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot resetotp] %s failed: %s", usr.Login, res.Error)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+	rc.sessions.KillUser(int64(usr.ID))
+	log.WithContext(r.Context()).Infof("[TG Bot resetotp] %s by %s", usr.Login, sess.User.Login)
+
+	r.SensitivePicture(qr)
+	return (*actionResult)(nil)
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	"github.com/jltorresm/otpgo"
+)
+
+func TestResetOtpUnlocks(t *testing.T) {
+	db := testDB(t)
+	testUser(t, db, "admin", access.RoleAdmin, 1)
+	usr := testUser(t, db, "bob", access.RoleUser, 7)
+	until := time.Now().Add(lockoutDuration)
+	cur := time.Now().Unix() / otpPeriod
+	// старый ключ успел принять код из будущего шага, а потом bob заблокировали
+	db.Model(usr).Updates(map[string]any{"last_otp_step": cur + 1, "failed_logins": 3, "locked_until": until})
+
+	sessions := session.New()
+	sessions.LogIn(7, session.MakeUser(int64(usr.ID), usr.Login, access.RoleUser))
+	admin := &session.Session{ChatID: 1, User: session.MakeUser(1, "admin", access.RoleAdmin)}
+	r := &testReplier{}
+	ResetOtp(db, sessions).Action(r, []string{"bob"}, admin)
+	if len(r.replies) != 0 {
+		t.Fatalf("replies %v", r.replies)
+	}
+
+	fresh, err := userByID(db, int64(usr.ID))
+	if err != nil {
+		t.Fatalf("load bob: %s", err)
+	}
+	if fresh.OtpKey == testOtpKey || fresh.LastOtpStep != 0 || fresh.FailedLogins != 0 || fresh.LockedUntil != nil {
+		t.Errorf("after reset: key changed %v, step %d, failures %d, locked until %v",
+			fresh.OtpKey != testOtpKey, fresh.LastOtpStep, fresh.FailedLogins, fresh.LockedUntil)
+	}
+	if sessions.Session(7).IsAuthenticated() {
+		t.Errorf("session of bob survived the reset")
+	}
+
+	// код нового ключа на текущем шаге принимается сразу
+	code, err := (&otpgo.HOTP{Key: fresh.OtpKey, Counter: uint64(cur)}).Generate()
+	if err != nil {
+		t.Fatalf("generate code: %s", err)
+	}
+	oc := &otpChecker{db: db, messenger: &testMessenger{sent: map[int64][]string{}}}
+	r = &testReplier{}
+	if !oc.check(r, fresh, code, "wrong") {
+		t.Errorf("new key code rejected: %v", r.replies)
+	}
+}
@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type revokeCmd struct {
+	db     *gorm.DB
+	access Access
+}
+
+func Revoke(db *gorm.DB, access Access) *revokeCmd {
+	return &revokeCmd{db: db, access: access}
+}
+func (rc *revokeCmd) Cmd() string {
+	return "revoke"
+}
+func (rc *revokeCmd) Description() string {
+	return "Отзыв доступа к устройству или комнате"
+}
+func (rc *revokeCmd) Usage() string {
+	return `Для отзыва доступа используйте
+/revoke \<логин\> \<устройство или комната\>`
+}
+func (rc *revokeCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (rc *revokeCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (rc *revokeCmd) IsAuthRequired() bool {
+	return true
+}
+func (rc *revokeCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (rc *revokeCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 2 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (rc *revokeCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	usr, ok := findUser(rc.db, r, params[0])
+	if !ok {
+		return (*actionResult)(nil)
+	}
+
+	n, err := rc.access.Revoke(usr.ID, params[1])
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot revoke] %s from %s failed: %s", params[1], usr.Login, err)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+	if n == 0 {
+		r.ReplyWithMessage(escape(fmt.Sprintf("%s has no grants on %s", usr.Login, params[1])))
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("%s: access to %s revoked", usr.Login, params[1])))
+	return (*actionResult)(nil)
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+)
+
+type roomCmd struct {
+	access Access
+}
+
+func Room(access Access) *roomCmd {
+	return &roomCmd{access: access}
+}
+func (rc *roomCmd) Cmd() string {
+	return "room"
+}
+func (rc *roomCmd) Description() string {
+	return "Перенос устройства в комнату"
+}
+func (rc *roomCmd) Usage() string {
+	return `Для переноса устройства в комнату используйте
+/room \<устройство\> \<комната\>
+
+Комната создаётся автоматически`
+}
+func (rc *roomCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (rc *roomCmd) IsAuthRequired() bool {
+	return true
+}
+func (rc *roomCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (rc *roomCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 2 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (rc *roomCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	err := rc.access.AssignRoom(params[0], params[1])
+	if err != nil {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Moving %s failed: %s", params[0], err)))
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("%s moved to %s", params[0], params[1])))
+	return (*actionResult)(nil)
+}
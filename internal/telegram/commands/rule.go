@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+)
+
+type Automation interface {
+	Rules(ctx context.Context) ([]orm.Rule, error)
+	AddRule(ctx context.Context, name string, spec string, chatID int64, role string) error
+	RemoveRule(ctx context.Context, name string) error
+	EnableRule(ctx context.Context, name string, enabled bool) error
+	FireRule(name string) error
+	Reload(ctx context.Context) error
+}
+
+type ruleCmd struct {
+	rules Automation
+}
+
+func Rule(rules Automation) *ruleCmd {
+	return &ruleCmd{rules: rules}
+}
+func (rc *ruleCmd) Cmd() string {
+	return "rule"
+}
+func (rc *ruleCmd) Description() string {
+	return "Управление правилами автоматизации"
+}
+func (rc *ruleCmd) Usage() string {
+	return `Управление правилами автоматизации:
+/rule list
+/rule add \<имя\> \<json правила\>
+/rule remove \<имя\>
+/rule on \<имя\>
+/rule off \<имя\>
+/rule run \<имя\>
+
+Пример правила:
+` + "`" + `{"trigger":{"type":"state","device":"door","property":"contact","op":"==","value":false},"actions":[{"type":"notify","text":"Door opened"}]}` + "`"
+}
+func (rc *ruleCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+
+// ParamsSecurityLevel новое, включённое или запущенное правило управляет устройствами, как /set
+func (rc *ruleCmd) ParamsSecurityLevel(params []string) int {
+	if len(params) > 0 && (params[0] == "add" || params[0] == "on" || params[0] == "run") {
+		return domain.SecurityLevelSensitive
+	}
+	return domain.SecurityLevelNormal
+}
+func (rc *ruleCmd) IsAuthRequired() bool {
+	return true
+}
+func (rc *ruleCmd) RequiredRole() string {
+	return access.RoleUser
+}
+func (rc *ruleCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 {
+		r.Usage()
+		return true
+	}
+	if params[0] == "add" && len(params) < 3 || params[0] != "list" && params[0] != "add" && len(params) < 2 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (rc *ruleCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	var err error
+	switch params[0] {
+	case "list":
+		rc.list(r)
+		return (*actionResult)(nil)
+	case "add":
+		err = rc.rules.AddRule(r.Context(), params[1], strings.Join(params[2:], " "), sess.ChatID, sess.User.Role)
+	case "remove":
+		err = rc.rules.RemoveRule(r.Context(), params[1])
+	case "on":
+		err = rc.rules.EnableRule(r.Context(), params[1], true)
+	case "off":
+		err = rc.rules.EnableRule(r.Context(), params[1], false)
+	case "run":
+		err = rc.rules.FireRule(params[1])
+	default:
+		r.Usage()
+		return (*actionResult)(nil)
+	}
+
+	if err != nil {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Rule %s: %s", params[1], err)))
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("Rule %s: ok", params[1])))
+	return (*actionResult)(nil)
+}
+
+func (rc *ruleCmd) list(r interfaces.Replier) {
+	rules, err := rc.rules.Rules(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot rule] listing failed: %s", err)
+		r.InternalError()
+		return
+	}
+	if len(rules) == 0 {
+		r.ReplyWithMessage("No rules")
+		return
+	}
+
+	sb := strings.Builder{}
+	for _, rule := range rules {
+		state := "on"
+		if !rule.Enabled {
+			state = "off"
+		}
+		sb.WriteString(fmt.Sprintf("*%s* \\[%s\\]\n`%s`\n", escape(rule.Name), state, escapeCode(rule.Spec)))
+	}
+	r.ReplyWithMessage(sb.String())
+}
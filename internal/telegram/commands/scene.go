@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/scene"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+)
+
+type Scenes interface {
+	Scenes(ctx context.Context) ([]orm.Scene, error)
+	Save(ctx context.Context, name string, targets []string, chatID int64) (*orm.Scene, error)
+	Apply(ctx context.Context, name string) ([]scene.Result, error)
+	Remove(ctx context.Context, name string) error
+}
+
+type sceneCmd struct {
+	scenes Scenes
+}
+
+func Scene(scenes Scenes) *sceneCmd {
+	return &sceneCmd{scenes: scenes}
+}
+func (sc *sceneCmd) Cmd() string {
+	return "scene"
+}
+func (sc *sceneCmd) Description() string {
+	return "Сцены: сохранение и применение состояний устройств"
+}
+func (sc *sceneCmd) Usage() string {
+	return `Управление сценами:
+/scene list
+/scene apply \<имя\>
+/scene save \<имя\> \[устройство\[:свойство,свойство\]\] \.\.\.
+/scene remove \<имя\>
+
+Без списка устройств сохраняются все актуаторы`
+}
+func (sc *sceneCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+
+// ParamsSecurityLevel применение сцены меняет состояние устройств, как /set
+func (sc *sceneCmd) ParamsSecurityLevel(params []string) int {
+	if len(params) > 0 && params[0] == "apply" {
+		return domain.SecurityLevelSensitive
+	}
+	return domain.SecurityLevelNormal
+}
+func (sc *sceneCmd) IsAuthRequired() bool {
+	return true
+}
+func (sc *sceneCmd) RequiredRole() string {
+	return access.RoleUser
+}
+func (sc *sceneCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 1 || params[0] != "list" && len(params) < 2 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (sc *sceneCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	switch params[0] {
+	case "list":
+		sc.list(r)
+	case "apply":
+		sc.apply(r, params[1])
+	case "save":
+		rec, err := sc.scenes.Save(r.Context(), params[1], params[2:], sess.ChatID)
+		if err != nil {
+			r.ReplyWithMessage(escape(fmt.Sprintf("Scene %s: %s", params[1], err)))
+			break
+		}
+		r.ReplyWithMessage(escape(fmt.Sprintf("Scene %s saved: %d values", rec.Name, len(rec.States))))
+	case "remove":
+		err := sc.scenes.Remove(r.Context(), params[1])
+		if err != nil {
+			r.ReplyWithMessage(escape(fmt.Sprintf("Scene %s: %s", params[1], err)))
+			break
+		}
+		r.ReplyWithMessage(escape(fmt.Sprintf("Scene %s removed", params[1])))
+	default:
+		r.Usage()
+	}
+	return (*actionResult)(nil)
+}
+
+func (sc *sceneCmd) list(r interfaces.Replier) {
+	scenes, err := sc.scenes.Scenes(r.Context())
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot scene] listing failed: %s", err)
+		r.InternalError()
+		return
+	}
+	if len(scenes) == 0 {
+		r.ReplyWithMessage("No scenes")
+		return
+	}
+
+	sb := strings.Builder{}
+	for _, s := range scenes {
+		sb.WriteString(fmt.Sprintf("*%s*\n", escape(s.Name)))
+		for _, st := range s.States {
+			sb.WriteString(fmt.Sprintf(" \\* %s\\.%s \\= %s\n", escape(st.DeviceID), escape(st.Property), escape(st.Value)))
+		}
+	}
+	r.ReplyWithMessage(sb.String())
+}
+
+func (sc *sceneCmd) apply(r interfaces.Replier, name string) {
+	results, err := sc.scenes.Apply(r.Context(), name)
+	if errors.Is(err, scene.ErrSceneNotFound) {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Scene %s not found", name)))
+		return
+	}
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot scene] apply %s failed: %s", name, err)
+		r.InternalError()
+		return
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Scene %s:\n", name))
+	for _, res := range results {
+		switch {
+		case res.Err != nil:
+			sb.WriteString(fmt.Sprintf(" * %s: failed, %s\n", res.DeviceID, res.Err))
+		case res.RolledBack:
+			sb.WriteString(fmt.Sprintf(" * %s: rolled back\n", res.DeviceID))
+		case res.Skipped:
+			sb.WriteString(fmt.Sprintf(" * %s: not applied\n", res.DeviceID))
+		default:
+			sb.WriteString(fmt.Sprintf(" * %s: ok\n", res.DeviceID))
+		}
+	}
+	r.ReplyWithMessage(escape(sb.String()))
+}
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+)
+
+type sessionsCmd struct {
+	sessions *session.Storage
+}
+
+func Sessions(sessions *session.Storage) *sessionsCmd {
+	return &sessionsCmd{sessions: sessions}
+}
+func (sc *sessionsCmd) Cmd() string {
+	return "sessions"
+}
+func (sc *sessionsCmd) Description() string {
+	return "Активные сессии чатов"
+}
+func (sc *sessionsCmd) Usage() string {
+	return `Управление сессиями:
+/sessions
+/sessions kill \<чат\>`
+}
+func (sc *sessionsCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (sc *sessionsCmd) IsAuthRequired() bool {
+	return true
+}
+func (sc *sessionsCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (sc *sessionsCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) > 0 && (params[0] != "kill" || len(params) < 2) {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (sc *sessionsCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	if len(params) == 0 {
+		sc.list(r, sess)
+		return (*actionResult)(nil)
+	}
+
+	chat, err := strconv.ParseInt(params[1], 10, 64)
+	if err != nil {
+		r.Usage()
+		return (*actionResult)(nil)
+	}
+	if !sc.sessions.Kill(chat) {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Session %d not found", chat)))
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("Session %d killed", chat)))
+	return (*actionResult)(nil)
+}
+
+func (sc *sessionsCmd) list(r interfaces.Replier, sess *session.Session) {
+	sb := strings.Builder{}
+	for _, rec := range sc.sessions.Sessions() {
+		sb.WriteString(fmt.Sprintf(" * %d: ", rec.ChatID))
+		if rec.User == nil {
+			sb.WriteString("not authenticated")
+		} else {
+			sb.WriteString(fmt.Sprintf("%s [%s]", rec.User.Login, rec.User.Role))
+		}
+		if rec.ChatID == sess.ChatID {
+			sb.WriteString(" (this chat)")
+		}
+		sb.WriteString("\n")
+	}
+	r.ReplyWithMessage(escape(sb.String()))
+}
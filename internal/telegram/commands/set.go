@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+)
+
+type setCmd struct {
+	devices *device.Registry
+	access  Access
+}
+
+func Set(devices *device.Registry, access Access) *setCmd {
+	return &setCmd{devices: devices, access: access}
+}
+func (sc *setCmd) Cmd() string {
+	return "set"
+}
+func (sc *setCmd) Description() string {
+	return "Изменение состояния устройства"
+}
+func (sc *setCmd) Usage() string {
+	return `Для изменения состояния устройства используйте
+/set \<устройство\> \<свойство\> \<значение\>
+
+Недостающие параметры будут запрошены по очереди`
+}
+func (sc *setCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (sc *setCmd) SecurityLevel() int {
+	return domain.SecurityLevelSensitive
+}
+func (sc *setCmd) IsAuthRequired() bool {
+	return true
+}
+func (sc *setCmd) RequiredRole() string {
+	return access.RoleGuest
+}
+func (sc *setCmd) Steps(sess *session.Session) []interfaces.Step {
+	return []interfaces.Step{
+		{Prompt: "Enter device:", Validate: func(id string) error {
+			if _, ok := sc.devices.Actuator(id); !ok {
+				return fmt.Errorf("actuator %s not found", id)
+			}
+			return nil
+		}},
+		{Prompt: "Enter property:"},
+		{Prompt: "Enter value:"},
+	}
+}
+func (sc *setCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	if len(params) < 3 {
+		r.Usage()
+		return true
+	}
+	return false
+}
+func (sc *setCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	id, prop := params[0], params[1]
+	if !sc.access.CanControl(uint(sess.User.Id), sess.User.Role, id) {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Access to %s denied", id)))
+		return (*actionResult)(nil)
+	}
+
+	act, ok := sc.devices.Actuator(id)
+	if !ok {
+		r.ReplyWithMessage(escape(fmt.Sprintf("Actuator %s not found", id)))
+		return (*actionResult)(nil)
+	}
+
+	v := device.Parse(params[2], "")
+	err := act.SetState(device.Values{prop: v})
+	if err != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot set] %s.%s = %s failed: %s", id, prop, v, err)
+		r.ReplyWithMessage(escape(fmt.Sprintf("Setting %s.%s failed: %s", id, prop, err)))
+		return (*actionResult)(nil)
+	}
+	r.ReplyWithMessage(escape(fmt.Sprintf("%s.%s = %s", id, prop, v)))
+	return (*actionResult)(nil)
+}
@@ -28,6 +28,9 @@ func (sc *startCmd) FloodControlLevel() int {
 func (sc *startCmd) IsAuthRequired() bool {
 	return false
 }
+func (sc *startCmd) RequiredRole() string {
+	return ""
+}
 func (sc *startCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
 	return false
 }
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type usersCmd struct {
+	db *gorm.DB
+}
+
+func Users(db *gorm.DB) *usersCmd {
+	return &usersCmd{db: db}
+}
+func (uc *usersCmd) Cmd() string {
+	return "users"
+}
+func (uc *usersCmd) Description() string {
+	return "Список пользователей"
+}
+func (uc *usersCmd) Usage() string {
+	return `Для просмотра списка пользователей используйте
+/users`
+}
+func (uc *usersCmd) FloodControlLevel() int {
+	return domain.SpamLevelLow
+}
+func (uc *usersCmd) IsAuthRequired() bool {
+	return true
+}
+func (uc *usersCmd) RequiredRole() string {
+	return access.RoleAdmin
+}
+func (uc *usersCmd) PreAction(r interfaces.Replier, params []string, sess *session.Session) bool {
+	return false
+}
+func (uc *usersCmd) Action(r interfaces.Replier, params []string, sess *session.Session) interfaces.CommandActionResult {
+	var users []orm.User
+	res := uc.db.WithContext(r.Context()).Joins("Role").Order("users.login").Find(&users)
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot users] listing failed: %s", res.Error)
+		r.InternalError()
+		return (*actionResult)(nil)
+	}
+	if len(users) == 0 {
+		r.ReplyWithMessage("No users")
+		return (*actionResult)(nil)
+	}
+
+	sb := strings.Builder{}
+	for _, u := range users {
+		sb.WriteString(fmt.Sprintf(" * %s [%s]", u.Login, u.Role.Role))
+		if u.Status == orm.UserPending || u.Status == orm.UserRejected {
+			sb.WriteString(" " + u.Status)
+		}
+		if u.Blocked {
+			sb.WriteString(" blocked")
+		}
+		sb.WriteString("\n")
+	}
+	r.ReplyWithMessage(escape(sb.String()))
+	return (*actionResult)(nil)
+}
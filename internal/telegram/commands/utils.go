@@ -1,5 +1,20 @@
 package commands
 
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"strings"
+
+	"github.com/Farengier/smart-home/internal/img"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jltorresm/otpgo"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
 type actionResult struct {
 	resetSpamFilter bool
 }
@@ -10,3 +25,55 @@ func (ar *actionResult) ResetSpamFilter() bool {
 	}
 	return ar.resetSpamFilter
 }
+
+func escape(s string) string {
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, s)
+}
+
+// escapeCode экранирует текст внутри `code` блока MarkdownV2
+func escapeCode(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(s)
+}
+
+// findUser ищет пользователя по логину вместе с ролью, сообщая об ошибке в чат
+func findUser(db *gorm.DB, r interfaces.Replier, login string) (*orm.User, bool) {
+	usr := &orm.User{}
+	res := db.WithContext(r.Context()).Joins("Role").Where("users.login = ?", login).Limit(1).Find(usr)
+	if res.Error != nil {
+		log.WithContext(r.Context()).Errorf("[TG Bot] looking for user %s failed: %s", login, res.Error)
+		r.InternalError()
+		return nil, false
+	}
+	if res.RowsAffected == 0 {
+		r.ReplyWithMessage(escape(fmt.Sprintf("User %s not found", login)))
+		return nil, false
+	}
+	return usr, true
+}
+
+// totpQR генерирует новый ключ и QR-код для приложения-аутентификатора
+func totpQR(login string) (string, *bytes.Buffer, error) {
+	totp := otpgo.TOTP{}
+	_, err := totp.Generate()
+	if err != nil {
+		return "", nil, fmt.Errorf("key generate failed: %w", err)
+	}
+
+	ku := totp.KeyUri(login, totpIssuer)
+	qrcode, err := ku.QRCode()
+	if err != nil {
+		return "", nil, fmt.Errorf("qr generate failed: %w", err)
+	}
+
+	im, err := img.ParseB64(qrcode)
+	if err != nil {
+		return "", nil, fmt.Errorf("img parse failed: %w", err)
+	}
+
+	bb := bytes.NewBuffer([]byte{})
+	err = png.Encode(bb, im)
+	if err != nil {
+		return "", nil, fmt.Errorf("encoding img failed: %w", err)
+	}
+	return totp.Key, bb, nil
+}
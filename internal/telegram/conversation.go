@@ -0,0 +1,93 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/telegram/interfaces"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	log "github.com/sirupsen/logrus"
+)
+
+const cancelCmd = "cancel"
+
+// сколько ждём ответа на очередной шаг диалога
+const conversationTTL = time.Minute * 5
+
+const msgCancelHint = `
+/cancel для отмены`
+
+// converse начинает диалог, если команде не хватает параметров. Возвращает true, если диалог начат
+func (b *bot) converse(r *replier, cmd interfaces.Command, params []string, sess *session.Session) bool {
+	conv, ok := cmd.(interfaces.Conversational)
+	if !ok {
+		return false
+	}
+	steps := conv.Steps(sess)
+	if len(params) >= len(steps) {
+		return false
+	}
+
+	sess.ResetPending(cmd.Cmd())
+	sess.StartConversation(cmd.Cmd(), params, conversationTTL)
+	r.ReplyWithMessage(steps[len(params)].Prompt + msgCancelHint)
+	return true
+}
+
+// answer принимает ответ на текущий шаг диалога и, когда собраны все параметры, выполняет команду
+func (b *bot) answer(ctx context.Context, text string, sess *session.Session) {
+	r := &replier{ctx: ctx, chatID: sess.ChatID, b: b}
+	c, ok := sess.Conversation()
+	if !ok {
+		return
+	}
+	if c.Expired() {
+		sess.EndConversation()
+		r.ReplyWithMessage(fmt.Sprintf(`Dialog timed out, start again with /%s`, c.Cmd))
+		return
+	}
+
+	cmd, ok := b.commands[c.Cmd]
+	conv, isConv := cmd.(interfaces.Conversational)
+	if !ok || !isConv {
+		log.WithContext(ctx).Errorf("[TBot] chat %d: conversation of unknown command %s", sess.ChatID, c.Cmd)
+		sess.EndConversation()
+		return
+	}
+	r.cmd = cmd
+
+	steps := conv.Steps(sess)
+	if len(c.Params) >= len(steps) {
+		sess.EndConversation()
+		return
+	}
+	step := steps[len(c.Params)]
+
+	ans := strings.TrimSpace(text)
+	if ans == "" || strings.ContainsAny(ans, " \t\n") {
+		r.ReplyWithMessage(`Answer must be a single word` + "\n" + step.Prompt + msgCancelHint)
+		return
+	}
+	if step.Validate != nil {
+		if err := step.Validate(ans); err != nil {
+			r.ReplyWithMessage(escapeText(err.Error()) + "\n" + step.Prompt + msgCancelHint)
+			return
+		}
+	}
+
+	c.Params = append(c.Params, ans)
+	if len(c.Params) < len(steps) {
+		c.Deadline = time.Now().Add(conversationTTL)
+		r.ReplyWithMessage(steps[len(c.Params)].Prompt + msgCancelHint)
+		return
+	}
+
+	sess.EndConversation()
+	if !b.roleAllows(sess, cmd.RequiredRole()) {
+		r.ReplyWithMessage(msgAccessDenied)
+		return
+	}
+	b.execute(r, cmd, c.Params, sess)
+}
@@ -0,0 +1,165 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/orm"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type deletion struct {
+	chatID int64
+	msgID  int
+	at     time.Time
+	id     uint // запись orm.Deletion, 0 если сохранить не удалось
+}
+
+// deletions очередь отложенного удаления сообщений. Удаления уходят через outbox,
+// при остановке туда передаётся всё, что не успело. Удаления хранятся в базе до выполнения,
+// поэтому не выполненные до остановки повторяются после перезапуска
+type deletions struct {
+	outbox *outbox
+	db     *gorm.DB
+	wake   chan struct{}
+
+	mtx sync.Mutex
+	// упорядочены по времени удаления
+	queue []deletion
+}
+
+func newDeletions(outbox *outbox, db *gorm.DB) *deletions {
+	return &deletions{
+		outbox: outbox,
+		db:     db,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// restore ставит в очередь удаления, не выполненные до остановки. Просроченные выполнятся сразу
+func (d *deletions) restore() error {
+	var recs []orm.Deletion
+	err := d.db.Order("at").Find(&recs).Error
+	if err != nil {
+		return fmt.Errorf("loading deletions failed: %w", err)
+	}
+	for _, rec := range recs {
+		d.push(deletion{chatID: rec.ChatID, msgID: rec.MessageID, at: rec.At, id: rec.ID})
+	}
+	log.Infof("[TBot] %d scheduled deletions restored", len(recs))
+	return nil
+}
+
+func (d *deletions) add(chatID int64, msgID int, ttl time.Duration) {
+	rec := &orm.Deletion{ChatID: chatID, MessageID: msgID, At: time.Now().Add(ttl)}
+	err := d.db.Create(rec).Error
+	if err != nil {
+		// без сохранения удаление всё равно выполнится, если бот не остановится раньше
+		log.Errorf("[TBot] chat %d: saving deletion of %d failed: %s", chatID, msgID, err)
+	}
+	d.push(deletion{chatID: chatID, msgID: msgID, at: rec.At, id: rec.ID})
+}
+
+func (d *deletions) push(del deletion) {
+	d.mtx.Lock()
+	i := sort.Search(len(d.queue), func(i int) bool {
+		return d.queue[i].at.After(del.at)
+	})
+	d.queue = append(d.queue, deletion{})
+	copy(d.queue[i+1:], d.queue[i:])
+	d.queue[i] = del
+	d.mtx.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *deletions) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		for _, del := range d.due(time.Now()) {
+			d.delete(del)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next, ok := d.next(); ok {
+			timer.Reset(time.Until(next))
+		}
+
+		select {
+		case <-ctx.Done():
+			dels := d.due(time.Time{})
+			log.Infof("[TBot] deleting %d scheduled messages before shutdown", len(dels))
+			for _, del := range dels {
+				d.delete(del)
+			}
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// due забирает из очереди удаления, время которых наступило. Нулевое now забирает все
+func (d *deletions) due(now time.Time) []deletion {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	n := len(d.queue)
+	if !now.IsZero() {
+		n = sort.Search(len(d.queue), func(i int) bool {
+			return d.queue[i].at.After(now)
+		})
+	}
+	res := append([]deletion(nil), d.queue[:n]...)
+	d.queue = d.queue[n:]
+	return res
+}
+
+func (d *deletions) next() (time.Time, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if len(d.queue) == 0 {
+		return time.Time{}, false
+	}
+	return d.queue[0].at, true
+}
+
+func (d *deletions) delete(del deletion) {
+	d.outbox.requestDone(del.chatID, tgbotapi.NewDeleteMessage(del.chatID, del.msgID), func(err error) {
+		var tgErr *tgbotapi.Error
+		if err != nil && !errors.As(err, &tgErr) {
+			// outbox закрылся или сеть недоступна, удаление повторится после перезапуска
+			log.Warnf("[TBot] chat %d: deletion of %d postponed till restart: %s", del.chatID, del.msgID, err)
+			return
+		}
+		// ошибку Bot API повторять бесполезно: сообщения уже нет или его нельзя удалить
+		d.forget(del)
+	})
+}
+
+// forget удаляет выполненное удаление из базы
+func (d *deletions) forget(del deletion) {
+	if del.id == 0 {
+		return
+	}
+	res := d.db.Unscoped().Delete(&orm.Deletion{}, del.id)
+	if res.Error != nil {
+		log.Errorf("[TBot] chat %d: forgetting deletion of %d failed: %s", del.chatID, del.msgID, res.Error)
+	}
+}
@@ -0,0 +1,89 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/tgfake"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+func deletionsLeft(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(&orm.Deletion{}).Count(&n).Error; err != nil {
+		t.Fatalf("count deletions: %s", err)
+	}
+	return n
+}
+
+// TestDeletionsRestart удаление, не выполненное до остановки, выполняется после перезапуска
+func TestDeletionsRestart(t *testing.T) {
+	const chat = 4
+
+	f := tgfake.New()
+	defer f.Close()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint("test", f.Endpoint())
+	if err != nil {
+		t.Fatalf("bot api: %s", err)
+	}
+	db := newTestDB(t)
+
+	o := newOutbox(api, db)
+	octx, ocncl := context.WithCancel(context.Background())
+	odone := make(chan struct{})
+	go func() {
+		o.run(octx)
+		close(odone)
+	}()
+	sent, err := o.sendWait(chat, tgbotapi.NewMessage(chat, "secret"), testWait)
+	if err != nil {
+		t.Fatalf("send: %s", err)
+	}
+	// outbox закрылся раньше, чем до удаления дошла очередь
+	ocncl()
+	<-odone
+
+	d := newDeletions(o, db)
+	d.add(chat, sent.MessageID, 100*time.Millisecond)
+	ctx, cncl := context.WithCancel(context.Background())
+	cncl()
+	d.run(ctx)
+	if f.Sent(chat)[0].Deleted {
+		t.Fatalf("deleted through a closed outbox")
+	}
+	if n := deletionsLeft(t, db); n != 1 {
+		t.Fatalf("%d deletions saved, want 1", n)
+	}
+
+	o, cncl, done := runTestOutbox(t, f, db)
+	d = newDeletions(o, db)
+	if err := d.restore(); err != nil {
+		t.Fatalf("restore: %s", err)
+	}
+	dctx, dcncl := context.WithCancel(context.Background())
+	ddone := make(chan struct{})
+	go func() {
+		d.run(dctx)
+		close(ddone)
+	}()
+	defer func() {
+		dcncl()
+		<-ddone
+		cncl()
+		<-done
+	}()
+
+	waitFor(t, "deletion after restart", func() bool {
+		return f.Sent(chat)[0].Deleted && deletionsLeft(t, db) == 0
+	})
+
+	// сообщения уже нет, ошибка Bot API не повторяется и не оставляет запись
+	d.add(chat, sent.MessageID, 0)
+	waitFor(t, "failed deletion forgotten", func() bool {
+		return deletionsLeft(t, db) == 0
+	})
+}
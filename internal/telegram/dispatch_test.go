@@ -0,0 +1,133 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/telegram/callback"
+	"github.com/Farengier/smart-home/internal/telegram/domain"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newDispatchBot бот без Bot API: ответы остаются в очереди outbox
+func newDispatchBot(t *testing.T) *bot {
+	t.Helper()
+	db := newTestDB(t)
+	b := &bot{
+		cfg:           testConfig{otpWindow: time.Minute},
+		db:            testDB{db: db},
+		svc:           Services{Devices: device.NewRegistry()},
+		access:        access.New(db),
+		sessions:      session.New(),
+		spamDurations: map[int]time.Duration{domain.SpamLevelLow: 0, domain.SpamLevelSensitive: 0},
+		outbox:        newOutbox(nil, nil),
+	}
+	b.initCommands()
+	return b
+}
+
+// staleAdmin сессия администратора, код которой вводился давно
+func staleAdmin(b *bot, chat int64) *session.Session {
+	sess := b.sessions.Session(chat)
+	sess.User = session.MakeUser(1, "admin", access.RoleAdmin)
+	sess.OtpAt = time.Now().Add(-time.Hour)
+	return sess
+}
+
+func confirming(sess *session.Session) bool {
+	c, ok := sess.Conversation()
+	return ok && c.Cmd == confirmCmd
+}
+
+func TestDispatchNeedsOtp(t *testing.T) {
+	cases := []struct {
+		text    string
+		confirm bool
+	}{
+		{"/set lamp state ON", true},
+		{"/scene apply night", true},
+		{"/rule add r1 {}", true},
+		{"/rule on r1", true},
+		{"/rule run r1", true},
+		{"/job add j1 {}", true},
+		{"/job actions j1 []", true},
+		{"/job on j1", true},
+		{"/grant alice device lamp control", true},
+		{"/revoke alice device lamp", true},
+		{"/approve alice", true},
+		{"/reject alice", true},
+		{"/promote alice", true},
+		{"/scene list", false},
+		{"/scene save night", false},
+		{"/scene remove night", false},
+		{"/rule list", false},
+		{"/rule off r1", false},
+		{"/rule remove r1", false},
+		{"/job list", false},
+		{"/job off j1", false},
+		{"/devices", false},
+	}
+	b := newDispatchBot(t)
+	for i, c := range cases {
+		chat := int64(100 + i)
+		sess := staleAdmin(b, chat)
+		parts := strings.Split(c.text, " ")
+		cmd := b.commands[parts[0][1:]]
+		if got := b.needsOtp(cmd, parts[1:], sess); got != c.confirm {
+			t.Errorf("%s: needs otp %v, want %v", c.text, got, c.confirm)
+			continue
+		}
+		if !c.confirm {
+			continue
+		}
+
+		// команда откладывается до подтверждения и не выполняется
+		b.dispatch(context.Background(), c.text, sess)
+		if !confirming(sess) {
+			t.Errorf("%s: confirmation not requested", c.text)
+		}
+		if text, ok := sess.Pending(pendingCommandTTL); !ok || text != c.text {
+			t.Errorf("%s: pending %q", c.text, text)
+		}
+	}
+}
+
+func TestCallbackNeedsOtp(t *testing.T) {
+	cases := []struct {
+		name    string
+		p       callback.Payload
+		confirm bool
+	}{
+		{"approve button", callback.New("approve", "", "alice"), true},
+		{"reject button", callback.New("reject", "", "alice"), true},
+		{"devices toggle", callback.New("devices", "toggle", "lamp"), true},
+		{"devices refresh", callback.New("devices", "refresh"), false},
+	}
+	b := newDispatchBot(t)
+	for i, c := range cases {
+		chat := int64(200 + i)
+		sess := staleAdmin(b, chat)
+		data, err := c.p.Encode()
+		if err != nil {
+			t.Fatalf("%s: encode: %s", c.name, err)
+		}
+		if got := b.callbackNeedsOtp(b.commands[c.p.Cmd], c.p, sess); got != c.confirm {
+			t.Errorf("%s: needs otp %v, want %v", c.name, got, c.confirm)
+			continue
+		}
+		if !c.confirm {
+			continue
+		}
+
+		cq := &tgbotapi.CallbackQuery{ID: "1", Data: data, Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: chat}}}
+		b.callbackUpdate(context.Background(), cq, sess)
+		if !confirming(sess) {
+			t.Errorf("%s: confirmation not requested", c.name)
+		}
+	}
+}
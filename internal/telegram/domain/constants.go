@@ -5,3 +5,9 @@ const (
 	SpamLevelSensitive
 	SpamLevelLow
 )
+
+const (
+	SecurityLevelNormal int = iota
+	// SecurityLevelSensitive команда требует недавно введённого одноразового кода даже в авторизованной сессии
+	SecurityLevelSensitive
+)
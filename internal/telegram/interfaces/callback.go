@@ -0,0 +1,18 @@
+package interfaces
+
+import (
+	"github.com/Farengier/smart-home/internal/telegram/callback"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+)
+
+// CallbackHandler команда, которая принимает нажатия своих кнопок.
+// Перед вызовом проверяются авторизация и роль, как для самой команды
+type CallbackHandler interface {
+	Callback(r Replier, p callback.Payload, sess *session.Session)
+}
+
+// SecuredCallback команда, у кнопок которой свой уровень безопасности domain.SecurityLevel*.
+// Без него для нажатий действует уровень самой команды
+type SecuredCallback interface {
+	CallbackSecurityLevel(p callback.Payload) int
+}
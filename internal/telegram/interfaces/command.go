@@ -10,6 +10,8 @@ type Command interface {
 	Usage() string
 	FloodControlLevel() int
 	IsAuthRequired() bool
+	// RequiredRole минимальная роль пользователя для выполнения команды, пустая строка если роль не проверяется
+	RequiredRole() string
 	// PreAction делает проверки ввалидности параметров и сессии. Если возвращает true то выполенние команды прерывается
 	// Выполняется до проверки на флуд
 	PreAction(r Replier, params []string, sess *session.Session) bool
@@ -19,3 +21,14 @@ type Command interface {
 type CommandActionResult interface {
 	ResetSpamFilter() bool
 }
+
+// Secured команда с уровнем безопасности domain.SecurityLevel*. Команды без него считаются обычными
+type Secured interface {
+	SecurityLevel() int
+}
+
+// SecuredParams команда, у подкоманд которой свой уровень безопасности domain.SecurityLevel*.
+// Без него действует уровень самой команды
+type SecuredParams interface {
+	ParamsSecurityLevel(params []string) int
+}
@@ -0,0 +1,17 @@
+package interfaces
+
+import "github.com/Farengier/smart-home/internal/telegram/session"
+
+// Step шаг диалога, на котором команда запрашивает один параметр
+type Step struct {
+	// Prompt вопрос пользователю в MarkdownV2
+	Prompt string
+	// Validate проверяет ответ. Ошибка отправляется пользователю, и вопрос повторяется. Может быть nil
+	Validate func(answer string) error
+}
+
+// Conversational команда, которая может запросить недостающие параметры по шагам
+type Conversational interface {
+	// Steps шаги для параметров команды по порядку. Диалог начинается, если параметров передано меньше, чем шагов
+	Steps(sess *session.Session) []Step
+}
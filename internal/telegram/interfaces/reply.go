@@ -1,10 +1,25 @@
 package interfaces
 
-import "io"
+import (
+	"context"
+	"io"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
 
 type Replier interface {
+	// Context контекст обрабатываемого обновления с идентификатором запроса, для логов и запросов к базе
+	Context() context.Context
+	// InternalError сообщает пользователю о внутренней ошибке с идентификатором запроса для поиска в логах
 	InternalError()
 	Usage()
 	ReplyWithMessage(msg string)
+	ReplyWithKeyboard(msg string, kb tgbotapi.InlineKeyboardMarkup)
 	SensitivePicture(pic io.Reader)
+	// SensitiveMessage сообщение с секретами, которое будет удалено через минуту
+	SensitiveMessage(msg string)
+	// AnswerCallback отвечает на нажатие кнопки всплывающим текстом, вне нажатия ничего не делает
+	AnswerCallback(text string)
+	// EditMessage заменяет текст и кнопки сообщения, кнопку которого нажали. Вне нажатия отправляет новое сообщение
+	EditMessage(msg string, kb *tgbotapi.InlineKeyboardMarkup)
 }
@@ -0,0 +1,56 @@
+package telegram
+
+import "time"
+
+// limiter ограничение частоты отправки по алгоритму token bucket
+type limiter struct {
+	rate   float64 // токенов в секунду
+	burst  float64
+	tokens float64
+	last   time.Time
+	// до этого момента отправка запрещена, например по ответу 429
+	until time.Time
+}
+
+func newLimiter(rate float64, burst float64) *limiter {
+	return &limiter{rate: rate, burst: burst, tokens: burst}
+}
+
+// wait сколько ждать до следующей разрешённой отправки
+func (l *limiter) wait(now time.Time) time.Duration {
+	if now.Before(l.until) {
+		return l.until.Sub(now)
+	}
+	l.refill(now)
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *limiter) take(now time.Time) {
+	l.refill(now)
+	l.tokens--
+}
+
+func (l *limiter) pause(until time.Time) {
+	if until.After(l.until) {
+		l.until = until
+	}
+}
+
+// idle лимит полностью восстановился, limiter можно забыть
+func (l *limiter) idle(now time.Time) bool {
+	l.refill(now)
+	return !now.Before(l.until) && l.tokens >= l.burst
+}
+
+func (l *limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
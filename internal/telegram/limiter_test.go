@@ -0,0 +1,68 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	start := time.Unix(1686000000, 0)
+	type step struct {
+		at    time.Duration
+		take  bool
+		pause time.Duration // от at, 0 без паузы
+		wait  time.Duration
+		idle  bool
+	}
+	cases := []struct {
+		name  string
+		rate  float64
+		burst float64
+		steps []step
+	}{
+		{"burst then rate", 1, 3, []step{
+			{at: 0, take: true, wait: 0},
+			{at: 0, take: true, wait: 0},
+			{at: 0, take: true, wait: time.Second},
+			{at: 500 * time.Millisecond, wait: 500 * time.Millisecond},
+			{at: time.Second, take: true, wait: time.Second},
+			{at: 5 * time.Second, wait: 0, idle: true},
+		}},
+		{"fast rate", 30, 30, []step{
+			{at: 0, wait: 0, idle: true},
+			{at: 0, take: true, wait: 0},
+			{at: 0, wait: 0},
+			{at: 40 * time.Millisecond, wait: 0, idle: true},
+		}},
+		{"pause by retry_after", 1, 3, []step{
+			{at: 0, pause: 2 * time.Second, wait: 2 * time.Second},
+			{at: time.Second, wait: time.Second},
+			// более короткая пауза не сокращает уже назначенную
+			{at: time.Second, pause: 100 * time.Millisecond, wait: time.Second},
+			{at: 2 * time.Second, wait: 0, idle: true},
+		}},
+		{"pause after burst", 1, 1, []step{
+			{at: 0, take: true, wait: time.Second},
+			{at: 0, pause: 3 * time.Second, wait: 3 * time.Second},
+			{at: 3 * time.Second, wait: 0, idle: true},
+		}},
+	}
+	for _, c := range cases {
+		l := newLimiter(c.rate, c.burst)
+		for i, s := range c.steps {
+			now := start.Add(s.at)
+			if s.take {
+				l.take(now)
+			}
+			if s.pause > 0 {
+				l.pause(now.Add(s.pause))
+			}
+			if got := l.wait(now); got != s.wait {
+				t.Errorf("%s: step %d: wait %s, want %s", c.name, i, got, s.wait)
+			}
+			if got := l.idle(now); got != s.idle {
+				t.Errorf("%s: step %d: idle %v, want %v", c.name, i, got, s.idle)
+			}
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/orm"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// лимиты Telegram: около 30 сообщений в секунду всего и около одного в секунду в чат, короткие всплески допустимы
+const (
+	globalSendRate  = 30
+	globalSendBurst = 30
+	chatSendRate    = 1
+	chatSendBurst   = 3
+)
+
+// сетевые ошибки: ответы повторяются maxSendAttempts раз, уведомления до успеха
+const (
+	maxSendAttempts = 5
+	maxRetryDelay   = time.Minute
+)
+
+// sendWaitTimeout сколько обработка обновления ждёт отправки сообщения, которое ей нужно
+const sendWaitTimeout = 30 * time.Second
+
+// drainTimeout сколько при остановке досылается очередь, прежде чем остаток будет отброшен
+const drainTimeout = 10 * time.Second
+
+var (
+	errOutboxClosed = errors.New("outbox is closed")
+	errSendTimeout  = errors.New("send timed out")
+)
+
+type outMessage struct {
+	chatID int64
+	msg    tgbotapi.Chattable
+	id     uint // запись orm.Outbox, 0 если сообщение не сохраняется
+	// request вызов без нового сообщения в ответе: правка, удаление, ответ на нажатие
+	request  bool
+	attempts int
+	result   chan sendResult
+	// cancelled ожидающий перестал ждать, повторов не будет. Меняется под outbox.mtx
+	cancelled bool
+	// done получает результат вызова, если его не ждут через result
+	done func(err error)
+}
+
+type sendResult struct {
+	msg tgbotapi.Message
+	err error
+}
+
+// outbox очередь исходящих сообщений и остальных вызовов Bot API с учётом лимитов Telegram.
+// Уведомления сохраняются в базе до доставки и отправляются после перезапуска
+type outbox struct {
+	botAPI *tgbotapi.BotAPI
+	db     *gorm.DB
+	wake   chan struct{}
+
+	mtx    sync.Mutex
+	queue  []*outMessage
+	global *limiter
+	chats  map[int64]*limiter
+	closed bool
+}
+
+func newOutbox(botAPI *tgbotapi.BotAPI, db *gorm.DB) *outbox {
+	return &outbox{
+		botAPI: botAPI,
+		db:     db,
+		wake:   make(chan struct{}, 1),
+		global: newLimiter(globalSendRate, globalSendBurst),
+		chats:  map[int64]*limiter{},
+	}
+}
+
+// restore ставит в очередь уведомления, не доставленные до остановки
+func (o *outbox) restore() error {
+	var recs []orm.Outbox
+	err := o.db.Order("id").Find(&recs).Error
+	if err != nil {
+		return fmt.Errorf("loading outbox failed: %w", err)
+	}
+	for _, rec := range recs {
+		m := tgbotapi.NewMessage(rec.ChatID, rec.Text)
+		m.ParseMode = rec.ParseMode
+		if rec.ReplyMarkup != "" {
+			m.ReplyMarkup = json.RawMessage(rec.ReplyMarkup)
+		}
+		o.push(&outMessage{chatID: rec.ChatID, msg: m, id: rec.ID})
+	}
+	log.Infof("[TBot] %d undelivered notifications restored", len(recs))
+	return nil
+}
+
+// send отправляет ответ, не дожидаясь доставки
+func (o *outbox) send(m tgbotapi.MessageConfig) {
+	o.push(&outMessage{chatID: m.ChatID, msg: m})
+}
+
+// notify сохраняет уведомление и отправляет его, в том числе после перезапуска
+func (o *outbox) notify(m tgbotapi.MessageConfig) {
+	rec := &orm.Outbox{ChatID: m.ChatID, Text: m.Text, ParseMode: m.ParseMode}
+	if m.ReplyMarkup != nil {
+		kb, err := json.Marshal(m.ReplyMarkup)
+		if err != nil {
+			log.Errorf("[TBot] chat %d: encoding keyboard failed: %s", m.ChatID, err)
+		}
+		rec.ReplyMarkup = string(kb)
+	}
+	err := o.db.Create(rec).Error
+	if err != nil {
+		// без сохранения уведомление всё равно стоит попробовать отправить
+		log.Errorf("[TBot] chat %d: saving notification failed: %s", m.ChatID, err)
+	}
+	o.push(&outMessage{chatID: m.ChatID, msg: m, id: rec.ID})
+}
+
+// request выполняет вызов Bot API в очереди чата, не дожидаясь результата
+func (o *outbox) request(chatID int64, c tgbotapi.Chattable) {
+	o.push(&outMessage{chatID: chatID, msg: c, request: true})
+}
+
+// requestDone то же, что request, с done по окончании, в том числе при закрытии outbox
+func (o *outbox) requestDone(chatID int64, c tgbotapi.Chattable, done func(err error)) {
+	o.push(&outMessage{chatID: chatID, msg: c, request: true, done: done})
+}
+
+// sendWait отправляет сообщение и ждёт результата, когда нужен идентификатор отправленного сообщения.
+// Не отправленное за timeout сообщение убирается из очереди, чтобы секрет не ушёл без последующего удаления
+func (o *outbox) sendWait(chatID int64, c tgbotapi.Chattable, timeout time.Duration) (tgbotapi.Message, error) {
+	m := &outMessage{chatID: chatID, msg: c, result: make(chan sendResult, 1)}
+	o.push(m)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-m.result:
+		return res.msg, res.err
+	case <-timer.C:
+	}
+	if o.cancel(m) {
+		log.Warnf("[TBot] chat %d: message not sent in %s, dropped", chatID, timeout)
+		return tgbotapi.Message{}, errSendTimeout
+	}
+	// сообщение отправляется прямо сейчас, повторять его уже не будут
+	res := <-m.result
+	return res.msg, res.err
+}
+
+// cancel убирает сообщение из очереди. false, если оно уже отправляется
+func (o *outbox) cancel(m *outMessage) bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	m.cancelled = true
+	for i, q := range o.queue {
+		if q == m {
+			o.queue = append(o.queue[:i], o.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (o *outbox) push(m *outMessage) {
+	o.mtx.Lock()
+	if o.closed {
+		o.mtx.Unlock()
+		// сохранённое уведомление уйдёт после перезапуска
+		o.finish(m, tgbotapi.Message{}, errOutboxClosed, false)
+		return
+	}
+	o.queue = append(o.queue, m)
+	o.mtx.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *outbox) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		m, wait := o.next(time.Now())
+		if m != nil {
+			o.deliver(m)
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait > 0 {
+			timer.Reset(wait)
+		}
+		select {
+		case <-ctx.Done():
+			o.drain(time.Now().Add(drainTimeout))
+			o.close()
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// drain досылает очередь до deadline с учётом лимитов
+func (o *outbox) drain(deadline time.Time) {
+	for {
+		now := time.Now()
+		m, wait := o.next(now)
+		if m != nil {
+			o.deliver(m)
+			continue
+		}
+		if wait == 0 || now.Add(wait).After(deadline) {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// next первое сообщение, которое можно отправить сейчас, или сколько ждать до такого.
+// Сообщения одного чата уходят по порядку, занятый лимитом чат не задерживает остальные
+func (o *outbox) next(now time.Time) (*outMessage, time.Duration) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if len(o.queue) == 0 {
+		for chat, l := range o.chats {
+			if l.idle(now) {
+				delete(o.chats, chat)
+			}
+		}
+		return nil, 0
+	}
+	if wait := o.global.wait(now); wait > 0 {
+		return nil, wait
+	}
+
+	var minWait time.Duration
+	waiting := map[int64]bool{}
+	for i, m := range o.queue {
+		if waiting[m.chatID] {
+			continue
+		}
+		l, ok := o.chats[m.chatID]
+		if !ok {
+			l = newLimiter(chatSendRate, chatSendBurst)
+			o.chats[m.chatID] = l
+		}
+		if wait := l.wait(now); wait > 0 {
+			waiting[m.chatID] = true
+			if minWait == 0 || wait < minWait {
+				minWait = wait
+			}
+			continue
+		}
+
+		o.queue = append(o.queue[:i], o.queue[i+1:]...)
+		l.take(now)
+		o.global.take(now)
+		return m, 0
+	}
+	return nil, minWait
+}
+
+func (o *outbox) deliver(m *outMessage) {
+	sent, err := o.call(m)
+	if err == nil {
+		o.finish(m, sent, nil, true)
+		return
+	}
+
+	m.attempts++
+	var tgErr *tgbotapi.Error
+	switch {
+	case errors.As(err, &tgErr) && tgErr.RetryAfter > 0:
+		log.Warnf("[TBot] chat %d: too many requests, retry after %ds", m.chatID, tgErr.RetryAfter)
+		delay := time.Duration(tgErr.RetryAfter) * time.Second
+		o.pauseAll(delay)
+		o.retry(m, delay)
+	case errors.As(err, &tgErr) && strings.Contains(tgErr.Message, "message is not modified"):
+		// повторное нажатие может не менять сообщение, это не ошибка
+		o.finish(m, sent, nil, true)
+	case errors.As(err, &tgErr):
+		// ошибку Bot API повторять бесполезно: чат недоступен или сообщение неверное
+		o.finish(m, sent, err, true)
+	case m.id == 0 && m.attempts >= maxSendAttempts:
+		o.finish(m, sent, err, true)
+	default:
+		delay := time.Second << (m.attempts - 1)
+		if delay > maxRetryDelay || delay <= 0 {
+			delay = maxRetryDelay
+		}
+		log.Warnf("[TBot] chat %d: sending failed, retry in %s: %s", m.chatID, delay, err)
+		o.retry(m, delay)
+	}
+}
+
+func (o *outbox) call(m *outMessage) (tgbotapi.Message, error) {
+	if !m.request {
+		return o.botAPI.Send(m.msg)
+	}
+	_, err := o.botAPI.Request(m.msg)
+	return tgbotapi.Message{}, err
+}
+
+// retry возвращает сообщение в начало очереди, чат ждёт delay
+func (o *outbox) retry(m *outMessage, delay time.Duration) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if o.closed {
+		o.finish(m, tgbotapi.Message{}, errOutboxClosed, false)
+		return
+	}
+	if m.cancelled {
+		o.finish(m, tgbotapi.Message{}, errSendTimeout, false)
+		return
+	}
+	l, ok := o.chats[m.chatID]
+	if !ok {
+		l = newLimiter(chatSendRate, chatSendBurst)
+		o.chats[m.chatID] = l
+	}
+	l.pause(time.Now().Add(delay))
+	o.queue = append([]*outMessage{m}, o.queue...)
+}
+
+// pauseAll останавливает отправку во все чаты на delay: retry_after относится ко всему боту
+func (o *outbox) pauseAll(delay time.Duration) {
+	o.mtx.Lock()
+	o.global.pause(time.Now().Add(delay))
+	o.mtx.Unlock()
+}
+
+// finish сообщает результат ожидающему и при forget удаляет сохранённое уведомление
+func (o *outbox) finish(m *outMessage, sent tgbotapi.Message, err error, forget bool) {
+	if err != nil && !errors.Is(err, errOutboxClosed) {
+		log.Errorf("[TBot] chat %d: failed sending: %s", m.chatID, err)
+	}
+	if forget && m.id != 0 {
+		res := o.db.Unscoped().Delete(&orm.Outbox{}, m.id)
+		if res.Error != nil {
+			log.Errorf("[TBot] chat %d: deleting sent notification failed: %s", m.chatID, res.Error)
+		}
+	}
+	if m.result != nil {
+		m.result <- sendResult{msg: sent, err: err}
+	}
+	if m.done != nil {
+		m.done(err)
+	}
+}
+
+// close останавливает отправку. Сохранённые уведомления остаются в базе до следующего запуска
+func (o *outbox) close() {
+	o.mtx.Lock()
+	queue := o.queue
+	o.queue = nil
+	o.closed = true
+	o.mtx.Unlock()
+
+	dropped := 0
+	for _, m := range queue {
+		if m.id == 0 {
+			dropped++
+		}
+		o.finish(m, tgbotapi.Message{}, errOutboxClosed, false)
+	}
+	log.Infof("[TBot] outbox closed, %d replies dropped, %d notifications left for restart", dropped, len(queue)-dropped)
+}
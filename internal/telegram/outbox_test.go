@@ -0,0 +1,172 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/telegram/tgfake"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+func TestOutboxNext(t *testing.T) {
+	start := time.Now()
+	type step struct {
+		at   time.Duration
+		chat int64 // 0 ничего отправить нельзя
+		wait time.Duration
+	}
+	cases := []struct {
+		name   string
+		global *limiter
+		chats  []int64 // очередь по порядку
+		steps  []step
+	}{
+		{"chat burst, others not delayed", newLimiter(globalSendRate, globalSendBurst), []int64{1, 1, 1, 1, 2}, []step{
+			{at: 0, chat: 1},
+			{at: 0, chat: 1},
+			{at: 0, chat: 1},
+			{at: 0, chat: 2},
+			{at: 0, wait: time.Second},
+			{at: time.Second, chat: 1},
+			{at: time.Second},
+		}},
+		{"global limit", newLimiter(2, 2), []int64{1, 2, 3}, []step{
+			{at: 0, chat: 1},
+			{at: 0, chat: 2},
+			{at: 0, wait: 500 * time.Millisecond},
+			{at: 500 * time.Millisecond, chat: 3},
+		}},
+	}
+	for _, c := range cases {
+		o := newOutbox(nil, nil)
+		o.global = c.global
+		for i, chat := range c.chats {
+			o.send(tgbotapi.NewMessage(chat, string(rune('a'+i))))
+		}
+		for i, s := range c.steps {
+			m, wait := o.next(start.Add(s.at))
+			var chat int64
+			if m != nil {
+				chat = m.chatID
+			}
+			if chat != s.chat || wait != s.wait {
+				t.Errorf("%s: step %d: chat %d wait %s, want chat %d wait %s", c.name, i, chat, wait, s.chat, s.wait)
+			}
+		}
+	}
+}
+
+func runTestOutbox(t *testing.T, f interface{ Endpoint() string }, db *gorm.DB) (*outbox, context.CancelFunc, chan struct{}) {
+	t.Helper()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint("test", f.Endpoint())
+	if err != nil {
+		t.Fatalf("bot api: %s", err)
+	}
+	o := newOutbox(api, db)
+	ctx, cncl := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.run(ctx)
+		close(done)
+	}()
+	return o, cncl, done
+}
+
+func TestOutboxRetryAfter(t *testing.T) {
+	f := tgfake.New()
+	defer f.Close()
+	o, cncl, done := runTestOutbox(t, f, newTestDB(t))
+	defer func() {
+		cncl()
+		<-done
+	}()
+
+	// первая отправка получает 429, retry_after относится ко всему боту, поэтому ждут все чаты
+	f.Throttle(1, 1)
+	start := time.Now()
+	o.send(tgbotapi.NewMessage(1, "first"))
+	o.send(tgbotapi.NewMessage(1, "second"))
+	o.notify(tgbotapi.NewMessage(2, "other"))
+
+	if _, err := f.WaitSent(2, 1, testWait); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("other chat sent after %s, before retry_after", d)
+	}
+
+	msgs, err := f.WaitSent(1, 2, testWait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("retried after %s, before retry_after", d)
+	}
+	if len(msgs) != 2 || msgs[0].Text != "first" || msgs[1].Text != "second" {
+		t.Errorf("sent %+v, want first and second once each", msgs)
+	}
+}
+
+func TestOutboxRequests(t *testing.T) {
+	f := tgfake.New()
+	defer f.Close()
+	o, cncl, done := runTestOutbox(t, f, newTestDB(t))
+
+	sent, err := o.sendWait(4, tgbotapi.NewMessage(4, "text"), testWait)
+	if err != nil {
+		t.Fatalf("send: %s", err)
+	}
+	// правка без изменений не считается ошибкой и не повторяется
+	o.request(4, tgbotapi.NewEditMessageText(4, sent.MessageID, "text"))
+	o.request(4, tgbotapi.NewEditMessageText(4, sent.MessageID, "edited"))
+	o.request(4, tgbotapi.NewCallback("1", "pressed"))
+	for i := 0; i < 3; i++ {
+		o.send(tgbotapi.NewMessage(4, "more"))
+	}
+	o.request(4, tgbotapi.NewDeleteMessage(4, sent.MessageID))
+
+	// остановка досылает очередь с учётом лимита чата
+	cncl()
+	<-done
+
+	msgs := f.Sent(4)
+	if len(msgs) != 4 {
+		t.Fatalf("%d messages, want 4", len(msgs))
+	}
+	if msgs[0].Text != "edited" || !msgs[0].Deleted {
+		t.Errorf("message %q deleted %v, want edited and deleted", msgs[0].Text, msgs[0].Deleted)
+	}
+	if answers := f.Answers(); len(answers) != 1 || answers[0].Text != "pressed" {
+		t.Errorf("answers %+v", answers)
+	}
+}
+
+func TestSendWaitTimeout(t *testing.T) {
+	// без run сообщение так и остаётся в очереди
+	o := newOutbox(nil, nil)
+	_, err := o.sendWait(1, tgbotapi.NewMessage(1, "secret"), 10*time.Millisecond)
+	if !errors.Is(err, errSendTimeout) {
+		t.Errorf("error %v, want %v", err, errSendTimeout)
+	}
+	if m, _ := o.next(time.Now()); m != nil {
+		t.Errorf("timed out message left in the queue")
+	}
+
+	// сообщение, которое уже отправлялось, после отмены не повторяется
+	m := &outMessage{chatID: 1, msg: tgbotapi.NewMessage(1, "secret"), result: make(chan sendResult, 1)}
+	o.push(m)
+	o.next(time.Now())
+	if o.cancel(m) {
+		t.Errorf("cancelled a message being sent")
+	}
+	o.retry(m, time.Second)
+	if res := <-m.result; !errors.Is(res.err, errSendTimeout) {
+		t.Errorf("retry of cancelled message: %v", res.err)
+	}
+	if m, _ := o.next(time.Now().Add(time.Minute)); m != nil {
+		t.Errorf("cancelled message requeued")
+	}
+}
@@ -1,6 +1,9 @@
 package telegram
 
 import (
+	"context"
+	"fmt"
+	"github.com/Farengier/smart-home/internal/reqid"
 	"github.com/Farengier/smart-home/internal/telegram/interfaces"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	log "github.com/sirupsen/logrus"
@@ -8,14 +11,31 @@ import (
 	"time"
 )
 
+// сколько живут сообщения с секретами
+const sensitiveTTL = time.Minute
+
 type replier struct {
+	ctx    context.Context
 	b      *bot
 	chatID int64
 	cmd    interfaces.Command
+
+	// заполняются при обработке нажатия кнопки
+	callbackID string
+	messageID  int
+	answered   bool
 }
 
-func (r *replier) InternalError() {
+func (r *replier) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
 
+func (r *replier) InternalError() {
+	id := reqid.From(r.ctx)
+	r.ReplyWithMessage(escapeText(fmt.Sprintf(msgInternalErr, id)))
 }
 
 func (r *replier) Usage() {
@@ -28,20 +48,65 @@ func (r *replier) ReplyWithMessage(msg string) {
 	r.b.send(reply)
 }
 
+func (r *replier) ReplyWithKeyboard(msg string, kb tgbotapi.InlineKeyboardMarkup) {
+	reply := tgbotapi.NewMessage(r.chatID, msg)
+	reply.ParseMode = "MarkdownV2"
+	reply.ReplyMarkup = kb
+	r.b.send(reply)
+}
+
+func (r *replier) AnswerCallback(text string) {
+	if r.callbackID == "" || r.answered {
+		return
+	}
+	r.answered = true
+	r.b.outbox.request(r.chatID, tgbotapi.NewCallback(r.callbackID, text))
+}
+
+func (r *replier) EditMessage(msg string, kb *tgbotapi.InlineKeyboardMarkup) {
+	if r.messageID == 0 {
+		if kb == nil {
+			r.ReplyWithMessage(msg)
+		} else {
+			r.ReplyWithKeyboard(msg, *kb)
+		}
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(r.chatID, r.messageID, msg)
+	edit.ParseMode = "MarkdownV2"
+	if kb != nil {
+		edit.ReplyMarkup = kb
+	}
+	r.b.outbox.request(r.chatID, edit)
+}
+
 func (r *replier) SensitivePicture(pic io.Reader) {
-	msg := tgbotapi.NewPhoto(r.chatID, tgbotapi.FileReader{
-		Name:   "QR.png",
-		Reader: pic,
+	// картинку из памяти можно отправить повторно, если Telegram попросит подождать
+	data, err := io.ReadAll(pic)
+	if err != nil {
+		log.WithContext(r.ctx).Errorf("[TG Bot] reading picture failed: %s", err)
+		return
+	}
+	msg := tgbotapi.NewPhoto(r.chatID, tgbotapi.FileBytes{
+		Name:  "QR.png",
+		Bytes: data,
 	})
 
-	sentMsg, err := r.b.botAPI.Send(msg)
+	sentMsg, err := r.b.outbox.sendWait(r.chatID, msg, sendWaitTimeout)
 	if err != nil {
-		log.Errorf("[TG Bot] failed sending: %s", err)
+		return
 	}
+	r.b.deleteLater(r.chatID, sentMsg.MessageID, sensitiveTTL)
+}
+
+func (r *replier) SensitiveMessage(msg string) {
+	reply := tgbotapi.NewMessage(r.chatID, msg)
+	reply.ParseMode = "MarkdownV2"
 
-	time.Sleep(time.Minute)
-	_, err = r.b.botAPI.Send(tgbotapi.NewDeleteMessage(r.chatID, sentMsg.MessageID))
+	sentMsg, err := r.b.outbox.sendWait(r.chatID, reply, sendWaitTimeout)
 	if err != nil {
-		log.Errorf("[TG Bot] failed deleting message: %s", err)
+		return
 	}
+	r.b.deleteLater(r.chatID, sentMsg.MessageID, sensitiveTTL)
 }
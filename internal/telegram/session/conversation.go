@@ -0,0 +1,54 @@
+package session
+
+import "time"
+
+type conversationKey struct{}
+
+// Conversation диалог, в котором команда по шагам собирает параметры
+type Conversation struct {
+	Cmd      string
+	Params   []string
+	Deadline time.Time
+}
+
+func (c *Conversation) Expired() bool {
+	return time.Now().After(c.Deadline)
+}
+
+// StartConversation начинает диалог команды cmd с уже переданными параметрами, предыдущий диалог забывается
+func (s *Session) StartConversation(cmd string, params []string, ttl time.Duration) *Conversation {
+	c := &Conversation{
+		Cmd:      cmd,
+		Params:   append([]string{}, params...),
+		Deadline: time.Now().Add(ttl),
+	}
+	s.stateUser().Set(conversationKey{}, c)
+	return c
+}
+
+func (s *Session) Conversation() (*Conversation, bool) {
+	v, ok := s.stateUser().Get(conversationKey{})
+	if !ok {
+		return nil, false
+	}
+	return v.(*Conversation), true
+}
+
+// EndConversation завершает диалог, возвращает false если диалога не было
+func (s *Session) EndConversation() bool {
+	u := s.stateUser()
+	_, ok := u.Get(conversationKey{})
+	u.Delete(conversationKey{})
+	return ok
+}
+
+// stateUser пользователь, в состоянии которого хранятся данные сессии. До авторизации это анонимный пользователь
+func (s *Session) stateUser() *User {
+	if s.User != nil {
+		return s.User
+	}
+	if s.anonymous == nil {
+		s.anonymous = MakeUser(0, "", "")
+	}
+	return s.anonymous
+}
@@ -1,9 +1,23 @@
 package session
 
+import "time"
+
 type Session struct {
 	User   *User
 	ChatID int64
 	Spam   *spam
+	// LoginAt и ExpiresAt заполняются при авторизации, нулевой ExpiresAt означает бессрочную сессию
+	LoginAt   time.Time
+	ExpiresAt time.Time
+	// LastActivity время последнего обращения из чата, для завершения сессии по бездействию
+	LastActivity time.Time
+	// OtpAt время последнего введённого одноразового кода, для чувствительных команд
+	OtpAt time.Time
+
+	pending    string
+	pendingVia string
+	pendingAt  time.Time
+	anonymous  *User
 }
 
 type User struct {
@@ -15,12 +29,72 @@ type User struct {
 
 func (s *Session) Clear() {
 	s.User = nil
+	s.anonymous = nil
+	s.OtpAt = time.Time{}
+}
+
+func (s *Session) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+// Idle проверяет, что из чата не обращались дольше timeout. Нулевой timeout отключает проверку
+func (s *Session) Idle(now time.Time, timeout time.Duration) bool {
+	return timeout > 0 && !s.LastActivity.IsZero() && now.Sub(s.LastActivity) > timeout
+}
+
+// OtpFresh проверяет, что одноразовый код вводился не раньше window назад
+func (s *Session) OtpFresh(now time.Time, window time.Duration) bool {
+	return !s.OtpAt.IsZero() && now.Sub(s.OtpAt) <= window
 }
 
 func (s *Session) IsAuthenticated() bool {
 	return s.User != nil
 }
 
+// Postpone запоминает команду, которую нужно выполнить после авторизации или подтверждения командой via.
+// Запоминается только последняя
+func (s *Session) Postpone(text string, via string) {
+	s.pending = text
+	s.pendingVia = via
+	s.pendingAt = time.Now()
+}
+
+// ResetPending забывает отложенную команду, если пользователь перешёл к команде cmd, которая её не завершает
+func (s *Session) ResetPending(cmd string) {
+	if s.pending != "" && cmd != s.pendingVia {
+		s.forgetPending()
+	}
+}
+
+// Pending возвращает и забывает отложенную команду, если она не старше ttl
+func (s *Session) Pending(ttl time.Duration) (string, bool) {
+	text, at := s.pending, s.pendingAt
+	s.forgetPending()
+	if text == "" || time.Since(at) > ttl {
+		return "", false
+	}
+	return text, true
+}
+
+func (s *Session) forgetPending() {
+	s.pending = ""
+	s.pendingVia = ""
+	s.pendingAt = time.Time{}
+}
+
+func (u *User) Get(key interface{}) (interface{}, bool) {
+	v, ok := u.state[key]
+	return v, ok
+}
+
+func (u *User) Set(key interface{}, val interface{}) {
+	u.state[key] = val
+}
+
+func (u *User) Delete(key interface{}) {
+	delete(u.state, key)
+}
+
 func MakeUser(id int64, login string, role string) *User {
 	return &User{
 		Id:    id,
@@ -0,0 +1,44 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPending(t *testing.T) {
+	cases := []struct {
+		name  string
+		after []string
+		ttl   time.Duration
+		want  string
+	}{
+		{"completed by login", []string{"login"}, time.Minute, "/devices"},
+		{"login dialog restarted", []string{"login", "login"}, time.Minute, "/devices"},
+		{"other command", []string{"help"}, time.Minute, ""},
+		{"other command before login", []string{"help", "login"}, time.Minute, ""},
+		{"cancel", []string{"cancel"}, time.Minute, ""},
+		{"expired", []string{"login"}, -time.Second, ""},
+	}
+	for _, c := range cases {
+		s := &Session{}
+		s.Postpone("/devices", "login")
+		for _, cmd := range c.after {
+			s.ResetPending(cmd)
+		}
+		got, ok := s.Pending(c.ttl)
+		if got != c.want || ok != (c.want != "") {
+			t.Errorf("%s: pending %q %v, want %q", c.name, got, ok, c.want)
+		}
+		if again, ok := s.Pending(c.ttl); ok {
+			t.Errorf("%s: pending returned twice: %q", c.name, again)
+		}
+	}
+
+	s := &Session{}
+	s.Postpone("/devices", "login")
+	s.Postpone("/scene apply night", "confirm")
+	s.ResetPending("confirm")
+	if got, _ := s.Pending(time.Minute); got != "/scene apply night" {
+		t.Errorf("only the last command must be kept, got %q", got)
+	}
+}
@@ -1,13 +1,36 @@
 package session
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// Record авторизованная сессия, сохраняемая между перезапусками
+type Record struct {
+	ChatID    int64
+	User      *User
+	LoginAt   time.Time
+	ExpiresAt time.Time
+}
+
+// Store постоянное хранилище авторизованных сессий
+type Store interface {
+	Load() ([]Record, error)
+	Save(r Record) error
+	Delete(chat int64) error
+	DeleteUser(userID int64) error
+}
+
 type Storage struct {
 	users    map[int64]*User
 	sessions map[int64]*Session
+	store    Store
+	lifetime time.Duration
+	idle     time.Duration
 	mtx      sync.RWMutex
 }
 
@@ -19,25 +42,129 @@ func New() *Storage {
 	return a
 }
 
+// NewPersistent хранилище, которое сохраняет авторизованные сессии в store и восстанавливает их при создании.
+// Сессии живут lifetime с момента авторизации и завершаются после idle бездействия, 0 без ограничения
+func NewPersistent(store Store, lifetime time.Duration, idle time.Duration) (*Storage, error) {
+	a := New()
+	a.store = store
+	a.lifetime = lifetime
+	a.idle = idle
+
+	recs, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading sessions failed: %w", err)
+	}
+	now := time.Now()
+	for _, rec := range recs {
+		if !rec.ExpiresAt.IsZero() && rec.ExpiresAt.Before(now) {
+			a.forget(rec.ChatID)
+			continue
+		}
+		s := a.newSession(rec.ChatID)
+		s.User = rec.User
+		s.LoginAt = rec.LoginAt
+		s.ExpiresAt = rec.ExpiresAt
+		// время бездействия не сохраняется, отсчитываем его заново с перезапуска
+		s.LastActivity = now
+		a.sessions[rec.ChatID] = s
+		a.users[rec.ChatID] = rec.User
+	}
+	log.Infof("[TBot] %d sessions restored", len(a.sessions))
+	return a, nil
+}
+
 func (a *Storage) Session(chat int64) *Session {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
 	s, ok := a.sessions[chat]
 	if !ok {
-		s = &Session{
-			ChatID: chat,
-			Spam:   &spam{times: map[int]time.Time{}},
-		}
+		s = a.newSession(chat)
 		a.sessions[chat] = s
 	}
+	if u, ok := a.users[chat]; ok && s.User != nil {
+		// роль могла смениться из другого чата
+		s.User = u
+	}
+	now := time.Now()
+	switch {
+	case s.User == nil:
+	case s.Expired(now):
+		log.Infof("[TBot] chat %d: session of %s expired", chat, s.User.Login)
+		a.logOut(s)
+	case s.Idle(now, a.idle):
+		log.Infof("[TBot] chat %d: session of %s expired by inactivity", chat, s.User.Login)
+		a.logOut(s)
+	}
+	s.LastActivity = now
 	return s
 }
 
+func (a *Storage) newSession(chat int64) *Session {
+	return &Session{
+		ChatID: chat,
+		Spam:   &spam{times: map[int]time.Time{}},
+	}
+}
+
+// LogIn авторизует пользователя в чате и сохраняет сессию
 func (a *Storage) LogIn(chat int64, u *User) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
+
+	s, ok := a.sessions[chat]
+	if !ok {
+		s = a.newSession(chat)
+		a.sessions[chat] = s
+	}
+	s.User = u
+	s.LoginAt = time.Now()
+	s.LastActivity = s.LoginAt
+	s.ExpiresAt = time.Time{}
+	if a.lifetime > 0 {
+		s.ExpiresAt = s.LoginAt.Add(a.lifetime)
+	}
 	a.users[chat] = u
+
+	if a.store == nil {
+		return
+	}
+	err := a.store.Save(Record{ChatID: chat, User: u, LoginAt: s.LoginAt, ExpiresAt: s.ExpiresAt})
+	if err != nil {
+		log.Errorf("[TBot] chat %d: saving session failed: %s", chat, err)
+	}
+}
+
+// LogOut завершает авторизацию в чате, сама сессия остаётся
+func (a *Storage) LogOut(chat int64) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	s, ok := a.sessions[chat]
+	if !ok || s.User == nil {
+		a.forget(chat)
+		return false
+	}
+	a.logOut(s)
+	return true
+}
+
+func (a *Storage) logOut(s *Session) {
+	s.Clear()
+	s.LoginAt = time.Time{}
+	s.ExpiresAt = time.Time{}
+	a.forget(s.ChatID)
+}
+
+// forget удаляет авторизацию чата из памяти и хранилища
+func (a *Storage) forget(chat int64) {
+	delete(a.users, chat)
+	if a.store == nil {
+		return
+	}
+	if err := a.store.Delete(chat); err != nil {
+		log.Errorf("[TBot] chat %d: deleting session failed: %s", chat, err)
+	}
 }
 
 func (a *Storage) User(chat int64) (*User, bool) {
@@ -46,3 +173,66 @@ func (a *Storage) User(chat int64) (*User, bool) {
 	u, ok := a.users[chat]
 	return u, ok
 }
+
+// Sessions возвращает снимки всех сессий, упорядоченные по чату. User пустой у неавторизованных.
+// Сами сессии меняет только их чат без блокировки, поэтому наружу отдаются копии
+func (a *Storage) Sessions() []Record {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	res := make([]Record, 0, len(a.sessions))
+	for chat, s := range a.sessions {
+		res = append(res, Record{ChatID: chat, User: a.users[chat], LoginAt: s.LoginAt, ExpiresAt: s.ExpiresAt})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ChatID < res[j].ChatID
+	})
+	return res
+}
+
+// Kill завершает сессию чата. Следующее сообщение из чата начнёт новую сессию
+func (a *Storage) Kill(chat int64) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	_, ok := a.sessions[chat]
+	delete(a.sessions, chat)
+	a.forget(chat)
+	return ok
+}
+
+// KillUser завершает все сессии пользователя
+func (a *Storage) KillUser(userID int64) int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	n := 0
+	for chat, u := range a.users {
+		if u.Id == userID {
+			delete(a.sessions, chat)
+			delete(a.users, chat)
+			n++
+		}
+	}
+	if a.store != nil {
+		if err := a.store.DeleteUser(userID); err != nil {
+			log.Errorf("[TBot] deleting sessions of user %d failed: %s", userID, err)
+		}
+	}
+	return n
+}
+
+// SetRole меняет роль пользователя в его активных сессиях. Пользователь заменяется копией,
+// чат получит её при следующем обращении к Session
+func (a *Storage) SetRole(userID int64, role string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for chat, u := range a.users {
+		if u.Id == userID {
+			cp := *u
+			cp.Role = role
+			a.users[chat] = &cp
+		}
+	}
+}
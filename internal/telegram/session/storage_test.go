@@ -0,0 +1,101 @@
+package session
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetRole(t *testing.T) {
+	st := New()
+	alice := MakeUser(1, "alice", "user")
+	st.LogIn(7, alice)
+	st.LogIn(8, alice)
+	st.LogIn(9, MakeUser(2, "bob", "user"))
+	st.Session(10)
+
+	sess := st.Session(7)
+	st.SetRole(1, "admin")
+	if sess.User.Role != "user" {
+		t.Errorf("role changed under the chat: %s", sess.User.Role)
+	}
+	if got := st.Session(7).User.Role; got != "admin" {
+		t.Errorf("chat 7 role %s, want admin", got)
+	}
+
+	want := map[int64]string{7: "alice admin", 8: "alice admin", 9: "bob user", 10: ""}
+	recs := st.Sessions()
+	if len(recs) != len(want) {
+		t.Fatalf("%d sessions, want %d", len(recs), len(want))
+	}
+	for i, rec := range recs {
+		if i > 0 && recs[i-1].ChatID >= rec.ChatID {
+			t.Errorf("sessions not ordered by chat: %d after %d", rec.ChatID, recs[i-1].ChatID)
+		}
+		got := ""
+		if rec.User != nil {
+			got = rec.User.Login + " " + rec.User.Role
+		}
+		if got != want[rec.ChatID] {
+			t.Errorf("chat %d: %q, want %q", rec.ChatID, got, want[rec.ChatID])
+		}
+	}
+}
+
+func TestKillUser(t *testing.T) {
+	st := New()
+	st.LogIn(7, MakeUser(1, "alice", "user"))
+	st.LogIn(8, MakeUser(1, "alice", "user"))
+	st.LogIn(9, MakeUser(2, "bob", "user"))
+
+	if n := st.KillUser(1); n != 2 {
+		t.Errorf("killed %d sessions, want 2", n)
+	}
+	if st.Session(7).IsAuthenticated() || st.Session(8).IsAuthenticated() {
+		t.Errorf("alice still authenticated")
+	}
+	if !st.Session(9).IsAuthenticated() {
+		t.Errorf("bob logged out")
+	}
+	if st.Kill(9) != true || st.Kill(11) != false {
+		t.Errorf("kill results")
+	}
+}
+
+// TestConcurrentAdmin чаты работают со своими сессиями, пока админ из другого чата меняет роли и завершает сессии.
+// Гонки ловит go test -race
+func TestConcurrentAdmin(t *testing.T) {
+	st := New()
+	wg := sync.WaitGroup{}
+	for chat := int64(1); chat <= 4; chat++ {
+		wg.Add(1)
+		go func(chat int64) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				sess := st.Session(chat)
+				if !sess.IsAuthenticated() {
+					sess.User = MakeUser(chat%2, "u", "user")
+					st.LogIn(chat, sess.User)
+				}
+				_ = sess.User.Role
+				sess.User.Set("step", i)
+			}
+		}(chat)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			st.SetRole(int64(i%2), "admin")
+			for _, rec := range st.Sessions() {
+				if rec.User != nil {
+					_ = rec.User.Login + rec.User.Role
+				}
+			}
+			if i%10 == 0 {
+				st.KillUser(1)
+				st.Kill(2)
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,56 @@
+package telegram
+
+import (
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/telegram/session"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sessionStore хранит авторизованные сессии чатов в БД
+type sessionStore struct {
+	db *gorm.DB
+}
+
+// Load возвращает сессии вместе с текущими ролями пользователей. Сессии заблокированных и удалённых пользователей пропускаются
+func (ss *sessionStore) Load() ([]session.Record, error) {
+	var recs []orm.ChatSession
+	res := ss.db.Preload("User.Role").
+		Joins("JOIN users ON users.id = chat_sessions.user_id AND users.deleted_at IS NULL AND users.blocked = ?", false).
+		Find(&recs)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	out := make([]session.Record, 0, len(recs))
+	for _, rec := range recs {
+		out = append(out, session.Record{
+			ChatID:    rec.ChatID,
+			User:      session.MakeUser(int64(rec.UserID), rec.User.Login, rec.User.Role.Role),
+			LoginAt:   rec.LoginAt,
+			ExpiresAt: rec.ExpiresAt,
+		})
+	}
+	return out, nil
+}
+
+func (ss *sessionStore) Save(r session.Record) error {
+	rec := &orm.ChatSession{
+		ChatID:    r.ChatID,
+		UserID:    uint(r.User.Id),
+		LoginAt:   r.LoginAt,
+		ExpiresAt: r.ExpiresAt,
+	}
+	return ss.db.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "login_at", "expires_at", "updated_at", "deleted_at"}),
+	}).Create(rec).Error
+}
+
+func (ss *sessionStore) Delete(chat int64) error {
+	return ss.db.Unscoped().Where("chat_id = ?", chat).Delete(&orm.ChatSession{}).Error
+}
+
+func (ss *sessionStore) DeleteUser(userID int64) error {
+	return ss.db.Unscoped().Where("user_id = ?", userID).Delete(&orm.ChatSession{}).Error
+}
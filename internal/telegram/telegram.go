@@ -3,25 +3,61 @@ package telegram
 import (
 	"context"
 	"fmt"
+	"github.com/Farengier/smart-home/internal/access"
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/reqid"
+	"github.com/Farengier/smart-home/internal/telegram/callback"
 	"github.com/Farengier/smart-home/internal/telegram/commands"
 	"github.com/Farengier/smart-home/internal/telegram/domain"
 	"github.com/Farengier/smart-home/internal/telegram/interfaces"
 	"github.com/Farengier/smart-home/internal/telegram/session"
 	"gorm.io/gorm"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Farengier/smart-home/internal/signal"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
 
-const msgInternalErr = "Internal error, please contact admin"
+const msgInternalErr = "Internal error, reference %s"
+const msgAccessDenied = "Access denied"
+const msgConfirmFirst = "Confirm with one-time code, then press again"
+const msgLoginRequired = `Authentication required\. Use /login \<login\> \<code\>, then /%s will be run automatically`
+
+// сколько отложенная до авторизации команда ждёт /login
+const pendingCommandTTL = time.Minute * 10
+
+const confirmCmd = "confirm"
+const loginCmd = "login"
+
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
 
 type Config interface {
 	Token() string
+	// APIEndpoint формат адреса Bot API как tgbotapi.APIEndpoint, пустой для api.telegram.org
+	APIEndpoint() string
 	SpamFilterDurationSensitive() time.Duration
 	SpamFilterDurationLow() time.Duration
+	// SessionLifetime сколько живёт авторизация в чате, 0 без ограничения
+	SessionLifetime() time.Duration
+	// SessionIdleTimeout через сколько бездействия авторизация завершается, 0 без ограничения
+	SessionIdleTimeout() time.Duration
+	// SensitiveOtpWindow как давно можно было вводить одноразовый код для выполнения чувствительных команд
+	SensitiveOtpWindow() time.Duration
+	// UpdatesMode откуда бот получает обновления: ModePolling или ModeWebhook
+	UpdatesMode() string
+	// WebhookURL адрес, который сообщается Telegram для вебхука
+	WebhookURL() string
+	// WebhookPath путь обработчика на веб-сервере, по умолчанию путь из WebhookURL
+	WebhookPath() string
+	// WebhookSecret значение заголовка X-Telegram-Bot-Api-Secret-Token
+	WebhookSecret() string
 }
 
 type DB interface {
@@ -29,21 +65,60 @@ type DB interface {
 	SyncNow()
 }
 
+// Services подсистемы, которыми управляют команды бота
+type Services struct {
+	Devices    *device.Registry
+	Automation commands.Automation
+	Scheduler  commands.Scheduler
+	Scenes     commands.Scenes
+	Alerts     commands.Alerts
+}
+
 type bot struct {
 	cfg           Config
 	botAPI        *tgbotapi.BotAPI
 	sessions      *session.Storage
 	db            DB
+	svc           Services
+	access        commands.Access
 	spamDurations map[int]time.Duration
 	handlers      map[string]func(upd tgbotapi.Update)
 	commands      map[string]interfaces.Command
+	workers       *workers
+	deletions     *deletions
+	outbox        *outbox
+	// stop прекращает приём обновлений, после обработки последних бот останавливается
+	stop func()
 }
 
 func (b *bot) initCommands() {
 	cmds := []interfaces.Command{
 		commands.Start(),
-		commands.Login(b.db.GORM()),
-		commands.Register(b.db.GORM()),
+		commands.Cancel(),
+		commands.Login(b.db.GORM(), b),
+		commands.Logout(),
+		commands.Confirm(b.db.GORM(), b),
+		commands.Recovery(b.db.GORM()),
+		commands.Register(b.db.GORM(), b),
+		commands.Approve(b.db.GORM(), b),
+		commands.Reject(b.db.GORM(), b),
+		commands.Devices(b.svc.Devices, b.access),
+		commands.Set(b.svc.Devices, b.access),
+		commands.Grant(b.db.GORM(), b.access),
+		commands.Revoke(b.db.GORM(), b.access),
+		commands.Room(b.access),
+		commands.Users(b.db.GORM()),
+		commands.Promote(b.db.GORM(), b.sessions),
+		commands.Demote(b.db.GORM(), b.sessions),
+		commands.Block(b.db.GORM(), b.sessions),
+		commands.Unblock(b.db.GORM(), b.sessions),
+		commands.DelUser(b.db.GORM(), b.sessions, b.svc.Alerts, b.svc.Automation, b.svc.Scheduler),
+		commands.ResetOtp(b.db.GORM(), b.sessions),
+		commands.Sessions(b.sessions),
+		commands.Rule(b.svc.Automation),
+		commands.Job(b.svc.Scheduler),
+		commands.Scene(b.svc.Scenes),
+		commands.Alert(b.svc.Alerts),
 	}
 
 	b.commands = map[string]interfaces.Command{}
@@ -55,26 +130,98 @@ func (b *bot) initCommands() {
 	}
 }
 
-func StartBot(cfg Config, db DB) error {
+func StartBot(cfg Config, db DB, svc Services, router *mux.Router) (*bot, error) {
 	ctx := context.Background()
-	tgbot, err := tgbotapi.NewBotAPI(cfg.Token())
+	endpoint := cfg.APIEndpoint()
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	tgbot, err := tgbotapi.NewBotAPIWithAPIEndpoint(cfg.Token(), endpoint)
 	if err != nil {
-		return fmt.Errorf("telegram bot start failed: %w", err)
+		return nil, fmt.Errorf("telegram bot start failed: %w", err)
 	}
 
 	tgbot.Debug = true
 
+	sessions, err := session.NewPersistent(&sessionStore{db: db.GORM()}, cfg.SessionLifetime(), cfg.SessionIdleTimeout())
+	if err != nil {
+		return nil, fmt.Errorf("telegram sessions restore failed: %w", err)
+	}
+
 	instance := &bot{
 		cfg:      cfg,
 		botAPI:   tgbot,
 		db:       db,
-		sessions: session.New(),
+		svc:      svc,
+		access:   access.New(db.GORM()),
+		sessions: sessions,
 		spamDurations: map[int]time.Duration{
 			domain.SpamLevelLow:       cfg.SpamFilterDurationLow(),
 			domain.SpamLevelSensitive: cfg.SpamFilterDurationSensitive(),
 		},
+		outbox: newOutbox(tgbot, db.GORM()),
 	}
+	instance.deletions = newDeletions(instance.outbox, db.GORM())
+	instance.workers = newWorkers(updateWorkers, instance.update)
 	instance.setCommands()
+	err = instance.outbox.restore()
+	if err != nil {
+		return nil, fmt.Errorf("telegram outbox restore failed: %w", err)
+	}
+	err = instance.deletions.restore()
+	if err != nil {
+		return nil, fmt.Errorf("telegram deletions restore failed: %w", err)
+	}
+
+	tbctx, cncl := context.WithCancel(ctx)
+	var updates <-chan incoming
+	switch cfg.UpdatesMode() {
+	case ModeWebhook:
+		updates, err = instance.listenWebhook(tbctx, router)
+	case ModePolling:
+		updates, err = instance.poll()
+	default:
+		err = fmt.Errorf("unknown updates mode %s", cfg.UpdatesMode())
+	}
+	if err != nil {
+		cncl()
+		return nil, fmt.Errorf("telegram updates receiving failed: %w", err)
+	}
+
+	var stopOnce sync.Once
+	instance.stop = func() {
+		stopOnce.Do(func() {
+			tgbot.StopReceivingUpdates()
+			cncl()
+		})
+	}
+	signal.OnShutdown(func() error {
+		log.Info("[TBot] Shutdown telegram bot")
+		instance.stop()
+		return nil
+	})
+	dctx, dcncl := context.WithCancel(ctx)
+	octx, ocncl := context.WithCancel(ctx)
+	signal.Run(func() {
+		instance.deletions.run(dctx)
+		// удаления при остановке уходят через outbox, поэтому он останавливается последним
+		ocncl()
+	})
+	signal.Run(func() { instance.outbox.run(octx) })
+	signal.Run(func() {
+		instance.read(tbctx, updates)
+		// обработка последних обновлений могла запланировать отправку и удаления
+		dcncl()
+	})
+	return instance, nil
+}
+
+func (b *bot) poll() (<-chan incoming, error) {
+	// при установленном вебхуке getUpdates не работает
+	_, err := b.botAPI.Request(tgbotapi.DeleteWebhookConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("deleting webhook failed: %w", err)
+	}
 
 	// Create a new UpdateConfig struct with an offset of 0. Offsets are used
 	// to make sure Telegram knows we've handled previous values and we don't
@@ -86,17 +233,17 @@ func StartBot(cfg Config, db DB) error {
 	// frequent requests without having to send nearly as many.
 	updateConfig.Timeout = 30
 	// Start polling Telegram for updates.
-	updates := tgbot.GetUpdatesChan(updateConfig)
+	polled := b.botAPI.GetUpdatesChan(updateConfig)
 
-	tbctx, cncl := context.WithCancel(ctx)
-	signal.OnShutdown(func() error {
-		log.Info("[TBot] Shutdown telegram bot")
-		tgbot.StopReceivingUpdates()
-		cncl()
-		return nil
-	})
-	signal.Run(func() { instance.read(tbctx, updates) })
-	return nil
+	// по идентификатору из ответа о внутренней ошибке находятся записи в логах
+	updates := make(chan incoming)
+	go func() {
+		defer close(updates)
+		for upd := range polled {
+			updates <- incoming{ctx: reqid.With(context.Background(), reqid.New()), upd: upd}
+		}
+	}()
+	return updates, nil
 }
 
 func (b *bot) setCommands() {
@@ -120,33 +267,90 @@ func (b *bot) setCommands() {
 	}
 }
 
-func (b *bot) read(ctx context.Context, updates tgbotapi.UpdatesChannel) {
+func (b *bot) read(ctx context.Context, updates <-chan incoming) {
+	defer b.workers.stop()
 	// Let's go through each update that we're getting from Telegram.
 	for {
 		select {
-		case upd := <-updates:
-			b.update(upd)
+		case in, ok := <-updates:
+			if !ok {
+				return
+			}
+			b.workers.push(in)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (b *bot) update(upd tgbotapi.Update) {
-	if upd.CallbackQuery != nil {
-		_ = b.sessions.Session(upd.CallbackQuery.Message.Chat.ID)
+func (b *bot) update(in incoming) {
+	ctx, upd := in.ctx, in.upd
+	log.WithContext(ctx).Debugf("[TBot] update %d", upd.UpdateID)
+
+	if upd.CallbackQuery != nil && upd.CallbackQuery.Message != nil {
+		sess := b.sessions.Session(upd.CallbackQuery.Message.Chat.ID)
+		b.callbackUpdate(ctx, upd.CallbackQuery, sess)
 		return
 	}
 	if upd.Message != nil {
 		sess := b.sessions.Session(upd.Message.Chat.ID)
-		b.msgUpdate(upd, sess)
+		b.msgUpdate(ctx, upd, sess)
+		return
+	}
+}
+
+func (b *bot) msgUpdate(ctx context.Context, upd tgbotapi.Update, sess *session.Session) {
+	if _, ok := sess.Conversation(); ok && !strings.HasPrefix(upd.Message.Text, "/") {
+		b.answer(ctx, upd.Message.Text, sess)
+		return
+	}
+	b.dispatch(ctx, upd.Message.Text, sess)
+}
+
+// callbackUpdate передаёт нажатие кнопки команде, указанной в данных кнопки
+func (b *bot) callbackUpdate(ctx context.Context, cq *tgbotapi.CallbackQuery, sess *session.Session) {
+	r := &replier{ctx: ctx, chatID: sess.ChatID, b: b, callbackID: cq.ID, messageID: cq.Message.MessageID}
+	// на нажатие нужно ответить в любом случае, иначе кнопка останется в состоянии загрузки
+	defer r.AnswerCallback("")
+
+	p, err := callback.Decode(cq.Data)
+	if err != nil {
+		log.WithContext(ctx).Warnf("[TBot] chat %d: callback %s: %s", sess.ChatID, cq.Data, err)
+		return
+	}
+
+	cmd, ok := b.commands[p.Cmd]
+	h, isHandler := cmd.(interfaces.CallbackHandler)
+	if !ok || !isHandler {
+		log.WithContext(ctx).Warnf("[TBot] chat %d: no callback handler for %s", sess.ChatID, p.Cmd)
+		r.AnswerCallback("Unknown button")
+		return
+	}
+	r.cmd = cmd
+	sess.ResetPending(cmd.Cmd())
+
+	if cmd.IsAuthRequired() && !sess.IsAuthenticated() {
+		r.AnswerCallback("Authentication required, use /login")
+		return
+	}
+	if !b.roleAllows(sess, cmd.RequiredRole()) {
+		log.WithContext(ctx).Warnf("[TBot] chat %d: %s callback denied", sess.ChatID, cmd.Cmd())
+		r.AnswerCallback(msgAccessDenied)
+		return
+	}
+	if b.callbackNeedsOtp(cmd, p, sess) {
+		// нажатие не откладывается, после подтверждения кнопку нажимают ещё раз
+		r.AnswerCallback(msgConfirmFirst)
+		b.converse(r, b.commands[confirmCmd], nil, sess)
 		return
 	}
+
+	h.Callback(r, p, sess)
 }
 
-func (b *bot) msgUpdate(upd tgbotapi.Update, sess *session.Session) {
-	parts := strings.Split(upd.Message.Text, " ")
-	r := &replier{chatID: sess.ChatID, b: b}
+func (b *bot) dispatch(ctx context.Context, text string, sess *session.Session) {
+	parts := strings.Split(text, " ")
+	r := &replier{ctx: ctx, chatID: sess.ChatID, b: b}
 	if len(parts) == 0 {
 		r.ReplyWithMessage("empty message")
 		return
@@ -159,28 +363,115 @@ func (b *bot) msgUpdate(upd tgbotapi.Update, sess *session.Session) {
 	}
 
 	cmd, ok := b.commands[parts[0][1:]]
-	r = &replier{chatID: sess.ChatID, b: b, cmd: cmd}
+	r = &replier{ctx: ctx, chatID: sess.ChatID, b: b, cmd: cmd}
 	if !ok {
 		r.ReplyWithMessage("unknown command")
 		return
 	}
 
+	// новая команда прерывает незаконченный диалог и отменяет отложенную команду, если не завершает её
+	sess.ResetPending(cmd.Cmd())
+	if cmd.Cmd() != cancelCmd {
+		sess.EndConversation()
+	}
+
 	if cmd.IsAuthRequired() && !sess.IsAuthenticated() {
-		// TODO
+		// после успешного /login команда будет выполнена автоматически
+		sess.Postpone(text, loginCmd)
+		r.ReplyWithMessage(fmt.Sprintf(msgLoginRequired, cmd.Cmd()))
+		return
+	}
+
+	if !b.roleAllows(sess, cmd.RequiredRole()) {
+		log.WithContext(ctx).Warnf("[TBot] chat %d: %s denied", sess.ChatID, cmd.Cmd())
+		r.ReplyWithMessage(msgAccessDenied)
 		return
 	}
 
-	if cmd.PreAction(r, parts[1:], sess) {
+	if b.needsOtp(cmd, parts[1:], sess) {
+		// после подтверждения кодом команда будет выполнена автоматически
+		sess.Postpone(text, confirmCmd)
+		b.converse(r, b.commands[confirmCmd], nil, sess)
+		return
+	}
+
+	if b.converse(r, cmd, parts[1:], sess) {
+		return
+	}
+
+	b.execute(r, cmd, parts[1:], sess)
+}
+
+func (b *bot) execute(r *replier, cmd interfaces.Command, params []string, sess *session.Session) {
+	if cmd.PreAction(r, params, sess) {
 		return
 	}
 
 	b.spamCheck(r, sess, cmd.FloodControlLevel())
 
-	ares := cmd.Action(r, parts[1:], sess)
+	wasAuthenticated := sess.IsAuthenticated()
+	otpAt := sess.OtpAt
+	ares := cmd.Action(r, params, sess)
 
 	if ares.ResetSpamFilter() {
 		sess.Spam.Set(cmd.FloodControlLevel(), time.Time{})
 	}
+
+	// команды меняют только пользователя сессии, сохранением авторизации занимается хранилище
+	switch {
+	case !wasAuthenticated && sess.IsAuthenticated():
+		b.sessions.LogIn(sess.ChatID, sess.User)
+		b.replayPending(r.ctx, sess)
+	case wasAuthenticated && !sess.IsAuthenticated():
+		b.sessions.LogOut(sess.ChatID)
+	case !sess.OtpAt.Equal(otpAt):
+		b.replayPending(r.ctx, sess)
+	}
+}
+
+// replayPending выполняет команду, отложенную до авторизации
+func (b *bot) replayPending(ctx context.Context, sess *session.Session) {
+	text, ok := sess.Pending(pendingCommandTTL)
+	if !ok {
+		return
+	}
+	log.WithContext(ctx).Infof("[TBot] chat %d: replaying %s after login", sess.ChatID, strings.SplitN(text, " ", 2)[0])
+	b.dispatch(ctx, text, sess)
+}
+
+// needsOtp проверяет, что чувствительной команде с параметрами params не хватает свежего одноразового кода
+func (b *bot) needsOtp(cmd interfaces.Command, params []string, sess *session.Session) bool {
+	if sp, ok := cmd.(interfaces.SecuredParams); ok {
+		if sp.ParamsSecurityLevel(params) != domain.SecurityLevelSensitive {
+			return false
+		}
+		return !sess.OtpFresh(time.Now(), b.cfg.SensitiveOtpWindow())
+	}
+	sc, ok := cmd.(interfaces.Secured)
+	if !ok || sc.SecurityLevel() != domain.SecurityLevelSensitive {
+		return false
+	}
+	return !sess.OtpFresh(time.Now(), b.cfg.SensitiveOtpWindow())
+}
+
+// callbackNeedsOtp то же для нажатия кнопки p
+func (b *bot) callbackNeedsOtp(cmd interfaces.Command, p callback.Payload, sess *session.Session) bool {
+	sc, ok := cmd.(interfaces.SecuredCallback)
+	if !ok {
+		return b.needsOtp(cmd, nil, sess)
+	}
+	if sc.CallbackSecurityLevel(p) != domain.SecurityLevelSensitive {
+		return false
+	}
+	return !sess.OtpFresh(time.Now(), b.cfg.SensitiveOtpWindow())
+}
+
+// roleAllows проверяет, что роль пользователя сессии не ниже требуемой командой
+func (b *bot) roleAllows(sess *session.Session, required string) bool {
+	if required == "" {
+		return true
+	}
+	return sess.IsAuthenticated() && access.RoleAllows(sess.User.Role, required)
 }
 
 func (b *bot) spamCheck(r *replier, sess *session.Session, l int) bool {
@@ -0,0 +1,426 @@
+// Package tgfake поддельный Bot API для прогона диалогов с ботом без Telegram
+package tgfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ограничение getUpdates по умолчанию, как в Telegram
+const defaultUpdatesLimit = 100
+
+// Message сообщение, отправленное ботом
+type Message struct {
+	ChatID      int64
+	MessageID   int
+	Method      string
+	Text        string
+	ParseMode   string
+	ReplyMarkup string
+	Photo       []byte
+	Deleted     bool
+}
+
+// Answer ответ бота на нажатие кнопки
+type Answer struct {
+	CallbackID string
+	Text       string
+}
+
+type server struct {
+	srv  *httptest.Server
+	done chan struct{}
+
+	mu       sync.Mutex
+	changed  chan struct{}
+	updates  []tgbotapi.Update
+	updateID int
+	msgID    int
+	sent     []*Message
+	commands []tgbotapi.BotCommand
+	answers  []Answer
+	// сколько ещё отправок отклонить с 429 и через сколько секунд разрешить повтор
+	throttled  int
+	retryAfter int
+}
+
+// New запускает сервер, адрес для бота возвращает Endpoint
+func New() *server {
+	s := &server{
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint формат адреса для tgbotapi.NewBotAPIWithAPIEndpoint
+func (s *server) Endpoint() string {
+	return s.srv.URL + "/bot%s/%s"
+}
+
+func (s *server) Close() {
+	close(s.done)
+	s.srv.Close()
+}
+
+// SendText пользователь чата chatID пишет боту
+func (s *server) SendText(chatID int64, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.msgID++
+	s.push(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: s.msgID,
+		From:      &tgbotapi.User{ID: chatID},
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}})
+}
+
+// PressButton пользователь нажимает кнопку с данными data под сообщением messageID
+func (s *server) PressButton(chatID int64, messageID int, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.push(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   strconv.Itoa(s.updateID + 1),
+		From: &tgbotapi.User{ID: chatID},
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		},
+		Data: data,
+	}})
+}
+
+// Sent копии сообщений, отправленных в чат, включая удалённые
+func (s *server) Sent(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []Message
+	for _, m := range s.sent {
+		if m.ChatID == chatID {
+			res = append(res, *m)
+		}
+	}
+	return res
+}
+
+// WaitSent ждёт, пока в чат будет отправлено хотя бы n сообщений
+func (s *server) WaitSent(chatID int64, n int, timeout time.Duration) ([]Message, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		s.mu.Unlock()
+
+		msgs := s.Sent(chatID)
+		if len(msgs) >= n {
+			return msgs, nil
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return msgs, fmt.Errorf("chat %d: got %d messages of %d", chatID, len(msgs), n)
+		}
+	}
+}
+
+// Throttle следующие n отправок сообщений получат 429 Too Many Requests с retry_after
+func (s *server) Throttle(n int, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttled = n
+	s.retryAfter = retryAfter
+}
+
+// Answers ответы на нажатия кнопок в порядке получения
+func (s *server) Answers() []Answer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Answer(nil), s.answers...)
+}
+
+// Commands список команд из последнего setMyCommands
+func (s *server) Commands() []tgbotapi.BotCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]tgbotapi.BotCommand(nil), s.commands...)
+}
+
+// push добавляет обновление, вызывается под mu
+func (s *server) push(upd tgbotapi.Update) {
+	s.updateID++
+	upd.UpdateID = s.updateID
+	s.updates = append(s.updates, upd)
+	s.notify()
+}
+
+// notify будит всех ожидающих изменений, вызывается под mu
+func (s *server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *server) handle(rw http.ResponseWriter, r *http.Request) {
+	// /bot<token>/<method>
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		fail(rw, http.StatusNotFound, "Not Found")
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			fail(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	switch parts[1] {
+	case "getMe":
+		reply(rw, tgbotapi.User{ID: 1, IsBot: true, FirstName: "Fake", UserName: "fake_bot"})
+	case "getUpdates":
+		s.getUpdates(rw, r)
+	case "sendMessage", "sendPhoto":
+		if s.throttle(rw) {
+			return
+		}
+		if parts[1] == "sendPhoto" {
+			s.sendPhoto(rw, r)
+		} else {
+			s.sendMessage(rw, r)
+		}
+	case "editMessageText":
+		s.editMessageText(rw, r)
+	case "deleteMessage":
+		s.deleteMessage(rw, r)
+	case "setMyCommands":
+		s.setMyCommands(rw, r)
+	case "answerCallbackQuery":
+		s.answerCallbackQuery(rw, r)
+	case "deleteWebhook", "setWebhook":
+		reply(rw, true)
+	default:
+		fail(rw, http.StatusNotFound, "Not Found: method "+parts[1])
+	}
+}
+
+func (s *server) getUpdates(rw http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+	timeout, _ := strconv.Atoi(r.FormValue("timeout"))
+	limit, _ := strconv.Atoi(r.FormValue("limit"))
+	if limit <= 0 {
+		limit = defaultUpdatesLimit
+	}
+
+	deadline := time.After(time.Duration(timeout) * time.Second)
+	for {
+		s.mu.Lock()
+		// запрос с offset подтверждает все предыдущие обновления
+		for len(s.updates) > 0 && s.updates[0].UpdateID < offset {
+			s.updates = s.updates[1:]
+		}
+		res := s.updates
+		if len(res) > limit {
+			res = res[:limit]
+		}
+		res = append([]tgbotapi.Update{}, res...)
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(res) > 0 || timeout <= 0 {
+			reply(rw, res)
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			reply(rw, res)
+			return
+		case <-s.done:
+			reply(rw, res)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// throttle отвечает 429, если отправка должна быть отклонена
+func (s *server) throttle(rw http.ResponseWriter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.throttled <= 0 {
+		return false
+	}
+	s.throttled--
+	writeResponse(rw, http.StatusTooManyRequests, tgbotapi.APIResponse{
+		Ok:          false,
+		ErrorCode:   http.StatusTooManyRequests,
+		Description: fmt.Sprintf("Too Many Requests: retry after %d", s.retryAfter),
+		Parameters:  &tgbotapi.ResponseParameters{RetryAfter: s.retryAfter},
+	})
+	return true
+}
+
+func (s *server) sendMessage(rw http.ResponseWriter, r *http.Request) {
+	m, err := s.record(r, "sendMessage", r.FormValue("text"), nil)
+	if err != nil {
+		fail(rw, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+	reply(rw, tgMessage(&m))
+}
+
+func (s *server) sendPhoto(rw http.ResponseWriter, r *http.Request) {
+	var photo []byte
+	if f, _, err := r.FormFile("photo"); err == nil {
+		photo, _ = io.ReadAll(f)
+		_ = f.Close()
+	}
+	m, err := s.record(r, "sendPhoto", r.FormValue("caption"), photo)
+	if err != nil {
+		fail(rw, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+	res := tgMessage(&m)
+	res.Caption, res.Text = res.Text, ""
+	res.Photo = []tgbotapi.PhotoSize{{FileID: fmt.Sprintf("photo%d", m.MessageID), FileSize: len(m.Photo)}}
+	reply(rw, res)
+}
+
+func (s *server) editMessageText(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.find(r)
+	if m == nil {
+		fail(rw, http.StatusBadRequest, "Bad Request: message to edit not found")
+		return
+	}
+	if m.Text == r.FormValue("text") && m.ReplyMarkup == r.FormValue("reply_markup") {
+		fail(rw, http.StatusBadRequest, "Bad Request: message is not modified")
+		return
+	}
+	m.Text = r.FormValue("text")
+	m.ParseMode = r.FormValue("parse_mode")
+	m.ReplyMarkup = r.FormValue("reply_markup")
+	s.notify()
+	reply(rw, tgMessage(m))
+}
+
+func (s *server) deleteMessage(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.find(r)
+	if m == nil || m.Deleted {
+		fail(rw, http.StatusBadRequest, "Bad Request: message to delete not found")
+		return
+	}
+	m.Deleted = true
+	s.notify()
+	reply(rw, true)
+}
+
+func (s *server) answerCallbackQuery(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.answers = append(s.answers, Answer{CallbackID: r.FormValue("callback_query_id"), Text: r.FormValue("text")})
+	s.notify()
+	s.mu.Unlock()
+	reply(rw, true)
+}
+
+func (s *server) setMyCommands(rw http.ResponseWriter, r *http.Request) {
+	var cmds []tgbotapi.BotCommand
+	err := json.Unmarshal([]byte(r.FormValue("commands")), &cmds)
+	if err != nil {
+		fail(rw, http.StatusBadRequest, "Bad Request: can't parse commands: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.commands = cmds
+	s.mu.Unlock()
+	reply(rw, true)
+}
+
+// record сохраняет новое исходящее сообщение
+func (s *server) record(r *http.Request, method string, text string, photo []byte) (Message, error) {
+	chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+	if err != nil {
+		return Message{}, fmt.Errorf("chat_id: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.msgID++
+	m := &Message{
+		ChatID:      chatID,
+		MessageID:   s.msgID,
+		Method:      method,
+		Text:        text,
+		ParseMode:   r.FormValue("parse_mode"),
+		ReplyMarkup: r.FormValue("reply_markup"),
+		Photo:       photo,
+	}
+	s.sent = append(s.sent, m)
+	s.notify()
+	return *m, nil
+}
+
+// find сообщение по chat_id и message_id запроса, вызывается под mu
+func (s *server) find(r *http.Request) *Message {
+	chatID, _ := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+	msgID, _ := strconv.Atoi(r.FormValue("message_id"))
+	for _, m := range s.sent {
+		if m.ChatID == chatID && m.MessageID == msgID {
+			return m
+		}
+	}
+	return nil
+}
+
+func tgMessage(m *Message) tgbotapi.Message {
+	return tgbotapi.Message{
+		MessageID: m.MessageID,
+		From:      &tgbotapi.User{ID: 1, IsBot: true},
+		Chat:      &tgbotapi.Chat{ID: m.ChatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      m.Text,
+	}
+}
+
+func reply(rw http.ResponseWriter, result any) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		fail(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeResponse(rw, http.StatusOK, tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func fail(rw http.ResponseWriter, code int, description string) {
+	writeResponse(rw, code, tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description})
+}
+
+func writeResponse(rw http.ResponseWriter, code int, resp tgbotapi.APIResponse) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(resp)
+}
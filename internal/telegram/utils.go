@@ -1,16 +1,36 @@
 package telegram
 
 import (
+	"time"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	log "github.com/sirupsen/logrus"
 )
 
 func strp(str string) *string {
 	return &str
 }
 
-func (b *bot) send(c tgbotapi.Chattable) {
-	if _, err := b.botAPI.Send(c); err != nil {
-		log.Errorf("[TG Bot] failed sending: %s", err)
-	}
+func (b *bot) send(m tgbotapi.MessageConfig) {
+	b.outbox.send(m)
+}
+
+// Notify отправляет в чат простое текстовое уведомление, недоставленное отправится после перезапуска
+func (b *bot) Notify(chatID int64, msg string) {
+	b.outbox.notify(tgbotapi.NewMessage(chatID, msg))
+}
+
+// NotifyWithKeyboard отправляет в чат уведомление с кнопками, недоставленное отправится после перезапуска
+func (b *bot) NotifyWithKeyboard(chatID int64, msg string, kb tgbotapi.InlineKeyboardMarkup) {
+	m := tgbotapi.NewMessage(chatID, msg)
+	m.ReplyMarkup = kb
+	b.outbox.notify(m)
+}
+
+func escapeText(s string) string {
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, s)
+}
+
+// deleteLater удаляет сообщение через ttl, не задерживая обработку обновлений
+func (b *bot) deleteLater(chatID int64, msgID int, ttl time.Duration) {
+	b.deletions.add(chatID, msgID, ttl)
 }
@@ -0,0 +1,84 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Farengier/smart-home/internal/reqid"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// как в GetUpdatesChan
+const webhookBufferLen = 100
+
+// listenWebhook вешает обработчик обновлений на роутер веб-сервера и сообщает адрес Telegram
+func (b *bot) listenWebhook(ctx context.Context, router *mux.Router) (<-chan incoming, error) {
+	if router == nil {
+		return nil, fmt.Errorf("webhook mode requires web server")
+	}
+	if b.cfg.WebhookSecret() == "" {
+		return nil, fmt.Errorf("webhook secret is empty")
+	}
+	hookURL, err := url.Parse(b.cfg.WebhookURL())
+	if err != nil || hookURL.Scheme != "https" {
+		return nil, fmt.Errorf("webhook url %q must be https", b.cfg.WebhookURL())
+	}
+	path := b.cfg.WebhookPath()
+	if path == "" {
+		path = hookURL.Path
+	}
+
+	updates := make(chan incoming, webhookBufferLen)
+	router.Handle(path, b.webhookHandler(ctx, updates)).Methods(http.MethodPost)
+	log.Infof("[TBot] [init] webhook handler on %s", path)
+
+	// WebhookConfig из tgbotapi не умеет secret_token
+	params := tgbotapi.Params{}
+	params["url"] = hookURL.String()
+	params["secret_token"] = b.cfg.WebhookSecret()
+	_, err = b.botAPI.MakeRequest("setWebhook", params)
+	if err != nil {
+		return nil, fmt.Errorf("setting webhook failed: %w", err)
+	}
+	return updates, nil
+}
+
+func (b *bot) webhookHandler(ctx context.Context, updates chan<- incoming) http.HandlerFunc {
+	secret := []byte(b.cfg.WebhookSecret())
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), secret) != 1 {
+			log.WithContext(r.Context()).Warnf("[TBot] webhook request from %s with wrong secret token", r.RemoteAddr)
+			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		upd, err := b.botAPI.HandleUpdate(r)
+		if err != nil {
+			log.WithContext(r.Context()).Warnf("[TBot] webhook bad update: %s", err)
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// контекст запроса заканчивается с ответом, обработке достаётся только идентификатор из журнала веб-сервера
+		id := reqid.From(r.Context())
+		if id == "" {
+			id = reqid.New()
+		}
+		select {
+		case updates <- incoming{ctx: reqid.With(context.Background(), id), upd: *upd}:
+		case <-ctx.Done():
+			// Telegram повторит доставку после перезапуска
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Farengier/smart-home/internal/reqid"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	const body = `{"update_id":5,"message":{"message_id":1,"chat":{"id":7,"type":"private"},"text":"/start"}}`
+	cases := []struct {
+		name   string
+		secret string
+		reqID  string
+		code   int
+	}{
+		{"request id carried", "s3cret", "abc", http.StatusOK},
+		{"no request id", "s3cret", "", http.StatusOK},
+		{"wrong secret", "wrong", "abc", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		b := &bot{cfg: testConfig{secret: "s3cret"}, botAPI: &tgbotapi.BotAPI{}}
+		updates := make(chan incoming, 1)
+		h := b.webhookHandler(context.Background(), updates)
+
+		reqCtx, cncl := context.WithCancel(context.Background())
+		if c.reqID != "" {
+			reqCtx = reqid.With(reqCtx, c.reqID)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body)).WithContext(reqCtx)
+		req.Header.Set(secretTokenHeader, c.secret)
+		rw := httptest.NewRecorder()
+		h(rw, req)
+		// обработка идёт уже после ответа на запрос
+		cncl()
+
+		if rw.Code != c.code {
+			t.Errorf("%s: code %d, want %d", c.name, rw.Code, c.code)
+		}
+		if c.code != http.StatusOK {
+			if len(updates) != 0 {
+				t.Errorf("%s: update accepted", c.name)
+			}
+			continue
+		}
+		in := <-updates
+		if in.upd.UpdateID != 5 || in.upd.Message == nil || in.upd.Message.Chat.ID != 7 {
+			t.Errorf("%s: update %+v", c.name, in.upd)
+		}
+		id := reqid.From(in.ctx)
+		if (c.reqID != "" && id != c.reqID) || id == "" {
+			t.Errorf("%s: request id %q, want %q", c.name, id, c.reqID)
+		}
+		if in.ctx.Err() != nil {
+			t.Errorf("%s: update context ended with the request", c.name)
+		}
+	}
+}
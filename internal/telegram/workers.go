@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// сколько обновлений из разных чатов обрабатывается одновременно
+const updateWorkers = 4
+
+// incoming обновление с контекстом получения, в нём идентификатор запроса для логов
+type incoming struct {
+	ctx context.Context
+	upd tgbotapi.Update
+}
+
+// workers обрабатывает обновления параллельно, сохраняя порядок внутри каждого чата
+type workers struct {
+	handle func(in incoming)
+	chats  chan int64
+	wg     sync.WaitGroup
+
+	mtx sync.Mutex
+	// очереди чатов, которые сейчас в работе. Чат есть в карте, пока его очередь разбирает воркер
+	queues map[int64][]incoming
+}
+
+func newWorkers(n int, handle func(in incoming)) *workers {
+	w := &workers{
+		handle: handle,
+		chats:  make(chan int64, n),
+		queues: map[int64][]incoming{},
+	}
+	w.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go w.work()
+	}
+	return w
+}
+
+// push ставит обновление в очередь его чата
+func (w *workers) push(in incoming) {
+	chat, ok := updateChat(in.upd)
+	if !ok {
+		return
+	}
+
+	w.mtx.Lock()
+	q, busy := w.queues[chat]
+	w.queues[chat] = append(q, in)
+	w.mtx.Unlock()
+
+	if !busy {
+		w.chats <- chat
+	}
+}
+
+// stop дожидается обработки всех поставленных обновлений
+func (w *workers) stop() {
+	close(w.chats)
+	w.wg.Wait()
+}
+
+func (w *workers) work() {
+	defer w.wg.Done()
+	for chat := range w.chats {
+		for {
+			in, ok := w.next(chat)
+			if !ok {
+				break
+			}
+			w.handle(in)
+		}
+	}
+}
+
+// next следующее обновление чата. Пустая очередь освобождает чат для других воркеров
+func (w *workers) next(chat int64) (incoming, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	q := w.queues[chat]
+	if len(q) == 0 {
+		delete(w.queues, chat)
+		return incoming{}, false
+	}
+	w.queues[chat] = q[1:]
+	return q[0], true
+}
+
+func updateChat(upd tgbotapi.Update) (int64, bool) {
+	switch {
+	case upd.CallbackQuery != nil && upd.CallbackQuery.Message != nil:
+		return upd.CallbackQuery.Message.Chat.ID, true
+	case upd.Message != nil:
+		return upd.Message.Chat.ID, true
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func chatUpdate(id int, chat int64, callback bool) incoming {
+	msg := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chat}}
+	if callback {
+		return incoming{ctx: context.Background(), upd: tgbotapi.Update{UpdateID: id, CallbackQuery: &tgbotapi.CallbackQuery{Message: msg}}}
+	}
+	return incoming{ctx: context.Background(), upd: tgbotapi.Update{UpdateID: id, Message: msg}}
+}
+
+func TestWorkersOrder(t *testing.T) {
+	const chats, perChat = 5, 40
+
+	mtx := sync.Mutex{}
+	got := map[int64][]int{}
+	busy := map[int64]bool{}
+	var running, maxRunning int
+
+	w := newWorkers(3, func(in incoming) {
+		chat, _ := updateChat(in.upd)
+		mtx.Lock()
+		if busy[chat] {
+			t.Errorf("chat %d handled concurrently", chat)
+		}
+		busy[chat] = true
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mtx.Unlock()
+
+		// медленный чат не должен задерживать остальные
+		if chat == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		mtx.Lock()
+		busy[chat] = false
+		running--
+		got[chat] = append(got[chat], in.upd.UpdateID)
+		mtx.Unlock()
+	})
+
+	id := 0
+	want := map[int64][]int{}
+	for i := 0; i < perChat; i++ {
+		for chat := int64(0); chat < chats; chat++ {
+			id++
+			w.push(chatUpdate(id, chat, i%3 == 0))
+			want[chat] = append(want[chat], id)
+		}
+	}
+	// обновление без чата пропускается
+	w.push(incoming{ctx: context.Background(), upd: tgbotapi.Update{UpdateID: -1}})
+	w.stop()
+
+	for chat := int64(0); chat < chats; chat++ {
+		if len(got[chat]) != len(want[chat]) {
+			t.Errorf("chat %d: %d updates handled, want %d", chat, len(got[chat]), len(want[chat]))
+			continue
+		}
+		for i := range want[chat] {
+			if got[chat][i] != want[chat][i] {
+				t.Errorf("chat %d: order %v, want %v", chat, got[chat], want[chat])
+				break
+			}
+		}
+	}
+	if maxRunning < 2 {
+		t.Errorf("chats were not handled in parallel")
+	}
+}
@@ -0,0 +1,276 @@
+package timeseries
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"github.com/Farengier/smart-home/internal/signal"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	Resolution5m = "5m"
+	Resolution1h = "1h"
+	Resolution1d = "1d"
+)
+
+const runInterval = time.Minute * 5
+
+// за один запрос обрабатываем не больше стольких интервалов, чтобы не держать в памяти неделю сырых данных
+const bucketsPerChunk = 12
+
+type Config interface {
+	// RawRetention сколько хранить сырые значения
+	RawRetention() time.Duration
+	// Retention сколько хранить агрегаты разрешения res, 0 хранить всегда
+	Retention(res string) time.Duration
+}
+
+type level struct {
+	name   string
+	step   time.Duration
+	source string
+}
+
+// уровни агрегации, каждый строится из предыдущего
+var levels = []level{
+	{name: Resolution5m, step: time.Minute * 5},
+	{name: Resolution1h, step: time.Hour, source: Resolution5m},
+	{name: Resolution1d, step: time.Hour * 24, source: Resolution1h},
+}
+
+type key struct {
+	deviceID uint
+	property string
+	bucket   time.Time
+}
+
+type agg struct {
+	unit       string
+	min, max   float64
+	sum        float64
+	count      int
+	hasSamples bool
+}
+
+type store struct {
+	cfg Config
+	db  *gorm.DB
+}
+
+// Start запускает периодическое агрегирование и очистку значений сенсоров
+func Start(cfg Config, db *gorm.DB) {
+	s := &store{cfg: cfg, db: db}
+
+	ctx, cncl := context.WithCancel(context.Background())
+	signal.OnShutdown(func() error {
+		log.Info("[TimeSeries] Shutdown")
+		cncl()
+		return nil
+	})
+	signal.Run(func() { s.run(ctx) })
+}
+
+func (s *store) run(ctx context.Context) {
+	log.Info("[TimeSeries] running rollups")
+
+	t := time.NewTicker(runInterval)
+	defer t.Stop()
+
+	s.maintain(time.Now().UTC())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.maintain(now.UTC())
+		}
+	}
+}
+
+func (s *store) maintain(now time.Time) {
+	for _, l := range levels {
+		err := s.rollup(l, now)
+		if err != nil {
+			log.Errorf("[TimeSeries] %s rollup failed: %s", l.name, err)
+			// следующие уровни строятся из этого, ждём следующего запуска
+			return
+		}
+	}
+	s.cleanup(now)
+}
+
+func (s *store) rollup(l level, now time.Time) error {
+	to := now.Truncate(l.step)
+	from, err := s.watermark(l, now)
+	if err != nil {
+		return err
+	}
+
+	for from.Before(to) {
+		end := from.Add(l.step * bucketsPerChunk)
+		if end.After(to) {
+			end = to
+		}
+
+		var aggs map[key]*agg
+		if l.source == "" {
+			aggs, err = s.fromRaw(l, from, end)
+		} else {
+			aggs, err = s.fromRollups(l, from, end)
+		}
+		if err != nil {
+			return err
+		}
+		err = s.save(l, aggs)
+		if err != nil {
+			return err
+		}
+		from = end
+	}
+	return nil
+}
+
+// watermark начало первого ещё не посчитанного интервала
+func (s *store) watermark(l level, now time.Time) (time.Time, error) {
+	last := orm.ReadingRollup{}
+	res := s.db.Where("resolution = ?", l.name).Order("bucket desc").Limit(1).Find(&last)
+	if res.Error != nil {
+		return time.Time{}, res.Error
+	}
+	if res.RowsAffected > 0 {
+		// последний интервал мог быть посчитан по неполным данным источника, пересчитываем его
+		return last.Bucket.UTC(), nil
+	}
+
+	// считать раньше, чем хранятся исходные данные, нет смысла
+	var first time.Time
+	if l.source == "" {
+		rec := orm.SensorReading{}
+		res = s.db.Order("time").Limit(1).Find(&rec)
+		first = rec.Time
+	} else {
+		rec := orm.ReadingRollup{}
+		res = s.db.Where("resolution = ?", l.source).Order("bucket").Limit(1).Find(&rec)
+		first = rec.Bucket
+	}
+	if res.Error != nil {
+		return time.Time{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return now.Truncate(l.step), nil
+	}
+	return first.UTC().Truncate(l.step), nil
+}
+
+func (s *store) fromRaw(l level, from, to time.Time) (map[key]*agg, error) {
+	var rows []orm.SensorReading
+	res := s.db.Where("type = ? AND time >= ? AND time < ?", int(device.TypeFloat), from, to).Find(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	aggs := map[key]*agg{}
+	for _, r := range rows {
+		k := key{deviceID: r.DeviceID, property: r.Property, bucket: r.Time.UTC().Truncate(l.step)}
+		a := aggs[k]
+		if a == nil {
+			a = &agg{}
+			aggs[k] = a
+		}
+		a.add(r.Num, r.Num, r.Num, 1, r.Unit)
+	}
+	return aggs, nil
+}
+
+func (s *store) fromRollups(l level, from, to time.Time) (map[key]*agg, error) {
+	var rows []orm.ReadingRollup
+	res := s.db.Where("resolution = ? AND bucket >= ? AND bucket < ?", l.source, from, to).Find(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	aggs := map[key]*agg{}
+	for _, r := range rows {
+		k := key{deviceID: r.DeviceID, property: r.Property, bucket: r.Bucket.UTC().Truncate(l.step)}
+		a := aggs[k]
+		if a == nil {
+			a = &agg{}
+			aggs[k] = a
+		}
+		a.add(r.Min, r.Max, r.Avg*float64(r.Count), r.Count, r.Unit)
+	}
+	return aggs, nil
+}
+
+func (a *agg) add(min, max, sum float64, count int, unit string) {
+	if !a.hasSamples || min < a.min {
+		a.min = min
+	}
+	if !a.hasSamples || max > a.max {
+		a.max = max
+	}
+	a.sum += sum
+	a.count += count
+	a.unit = unit
+	a.hasSamples = true
+}
+
+func (s *store) save(l level, aggs map[key]*agg) error {
+	if len(aggs) == 0 {
+		return nil
+	}
+
+	recs := make([]orm.ReadingRollup, 0, len(aggs))
+	for k, a := range aggs {
+		recs = append(recs, orm.ReadingRollup{
+			DeviceID:   k.deviceID,
+			Property:   k.property,
+			Resolution: l.name,
+			Bucket:     k.bucket,
+			Unit:       a.unit,
+			Min:        a.min,
+			Max:        a.max,
+			Avg:        a.sum / float64(a.count),
+			Count:      a.count,
+		})
+	}
+
+	res := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}, {Name: "property"}, {Name: "resolution"}, {Name: "bucket"}},
+		DoUpdates: clause.AssignmentColumns([]string{"unit", "min", "max", "avg", "count"}),
+	}).Create(&recs)
+	if res.Error != nil {
+		return fmt.Errorf("saving rollups failed: %w", res.Error)
+	}
+	return nil
+}
+
+func (s *store) cleanup(now time.Time) {
+	if d := s.cfg.RawRetention(); d > 0 {
+		res := s.db.Where("time < ?", now.Add(-d)).Delete(&orm.SensorReading{})
+		if res.Error != nil {
+			log.Errorf("[TimeSeries] raw cleanup failed: %s", res.Error)
+		} else if res.RowsAffected > 0 {
+			log.Infof("[TimeSeries] removed %d raw readings", res.RowsAffected)
+		}
+	}
+
+	for _, l := range levels {
+		d := s.cfg.Retention(l.name)
+		if d <= 0 {
+			continue
+		}
+		res := s.db.Where("resolution = ? AND bucket < ?", l.name, now.Add(-d)).Delete(&orm.ReadingRollup{})
+		if res.Error != nil {
+			log.Errorf("[TimeSeries] %s cleanup failed: %s", l.name, res.Error)
+		} else if res.RowsAffected > 0 {
+			log.Infof("[TimeSeries] removed %d %s rollups", res.RowsAffected, l.name)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package timeseries
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Farengier/smart-home/internal/device"
+	"github.com/Farengier/smart-home/internal/orm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testConfig struct {
+	raw       time.Duration
+	retention map[string]time.Duration
+}
+
+func (c testConfig) RawRetention() time.Duration        { return c.raw }
+func (c testConfig) Retention(res string) time.Duration { return c.retention[res] }
+
+func testStore(t *testing.T, cfg testConfig) *store {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&orm.SensorReading{}, &orm.ReadingRollup{}); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+	return &store{cfg: cfg, db: db}
+}
+
+var day = time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+
+func at(clock string) time.Time {
+	t, _ := time.Parse("15:04", clock)
+	return day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+}
+
+func reading(dev uint, clock string, v float64) orm.SensorReading {
+	return orm.SensorReading{DeviceID: dev, Property: "temperature", Type: int(device.TypeFloat), Num: v, Unit: "°C", Time: at(clock)}
+}
+
+// rollups в виде "res dev hh:mm min/max/avg/count", отсортированные
+func rollups(t *testing.T, s *store, res string) []string {
+	t.Helper()
+	var recs []orm.ReadingRollup
+	if err := s.db.Where("resolution = ?", res).Find(&recs).Error; err != nil {
+		t.Fatalf("rollups: %s", err)
+	}
+	var out []string
+	for _, r := range recs {
+		out = append(out, fmt.Sprintf("%d %s %g/%g/%g/%d", r.DeviceID, r.Bucket.UTC().Format("15:04"), r.Min, r.Max, r.Avg, r.Count))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestRollups(t *testing.T) {
+	s := testStore(t, testConfig{})
+	steps := []struct {
+		name     string
+		readings []orm.SensorReading
+		now      string
+		want     map[string][]string
+	}{
+		{
+			name: "5m buckets, current bucket is not closed",
+			readings: []orm.SensorReading{
+				reading(1, "10:01", 20), reading(1, "10:03", 22), reading(1, "10:07", 30), reading(1, "10:11", 99),
+				reading(2, "10:02", 40),
+				{DeviceID: 1, Property: "contact", Type: int(device.TypeBool), Bool: true, Time: at("10:02")},
+			},
+			now: "10:12",
+			want: map[string][]string{
+				Resolution5m: {"1 10:00 20/22/21/2", "1 10:05 30/30/30/1", "2 10:00 40/40/40/1"},
+				Resolution1h: nil,
+			},
+		},
+		{
+			name:     "late reading recomputes last bucket",
+			readings: []orm.SensorReading{reading(1, "10:09", 40)},
+			now:      "10:14",
+			want: map[string][]string{
+				Resolution5m: {"1 10:00 20/22/21/2", "1 10:05 30/40/35/2", "2 10:00 40/40/40/1"},
+			},
+		},
+		{
+			name:     "hourly average is weighted by count, gaps over several chunks",
+			readings: []orm.SensorReading{reading(1, "12:30", 10)},
+			now:      "13:01",
+			want: map[string][]string{
+				Resolution5m: {"1 10:00 20/22/21/2", "1 10:05 30/40/35/2", "1 10:10 99/99/99/1", "1 12:30 10/10/10/1", "2 10:00 40/40/40/1"},
+				Resolution1h: {"1 10:00 20/99/42.2/5", "1 12:00 10/10/10/1", "2 10:00 40/40/40/1"},
+				Resolution1d: nil,
+			},
+		},
+		{
+			name: "daily rollup from hourly",
+			now:  "23:59",
+			want: map[string][]string{Resolution1d: nil},
+		},
+	}
+	for _, st := range steps {
+		if len(st.readings) > 0 {
+			if err := s.db.Create(&st.readings).Error; err != nil {
+				t.Fatalf("%s: insert: %s", st.name, err)
+			}
+		}
+		s.maintain(at(st.now))
+		for res, want := range st.want {
+			got := rollups(t, s, res)
+			if strings.Join(got, "; ") != strings.Join(want, "; ") {
+				t.Errorf("%s: %s rollups\n got %v\nwant %v", st.name, res, got, want)
+			}
+		}
+	}
+
+	s.maintain(day.AddDate(0, 0, 1).Add(time.Minute))
+	if got := rollups(t, s, Resolution1d); strings.Join(got, "; ") != "1 00:00 10/99/36.833333333333336/6; 2 00:00 40/40/40/1" {
+		t.Errorf("daily rollups %v", got)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	cases := []struct {
+		name      string
+		raw       time.Duration
+		retention map[string]time.Duration
+		wantRaw   int64
+		want      map[string]int
+	}{
+		{"keep forever", 0, nil, 3, map[string]int{Resolution5m: 3, Resolution1h: 2}},
+		{"raw only", time.Hour, nil, 1, map[string]int{Resolution5m: 3, Resolution1h: 2}},
+		{"5m and raw", 90 * time.Minute, map[string]time.Duration{Resolution5m: 30 * time.Minute}, 2, map[string]int{Resolution5m: 1, Resolution1h: 2}},
+		{"hourly", 0, map[string]time.Duration{Resolution1h: 2 * time.Hour}, 3, map[string]int{Resolution5m: 3, Resolution1h: 1}},
+	}
+	for _, c := range cases {
+		s := testStore(t, testConfig{raw: c.raw, retention: c.retention})
+		readings := []orm.SensorReading{reading(1, "10:00", 1), reading(1, "11:00", 2), reading(1, "11:40", 3)}
+		if err := s.db.Create(&readings).Error; err != nil {
+			t.Fatalf("insert: %s", err)
+		}
+		s.maintain(at("12:01"))
+
+		var raw int64
+		s.db.Model(&orm.SensorReading{}).Count(&raw)
+		if raw != c.wantRaw {
+			t.Errorf("%s: %d raw readings left, want %d", c.name, raw, c.wantRaw)
+		}
+		for res, want := range c.want {
+			if got := len(rollups(t, s, res)); got != want {
+				t.Errorf("%s: %d %s rollups left, want %d", c.name, got, res, want)
+			}
+		}
+	}
+}
@@ -7,31 +7,48 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Farengier/smart-home/internal/reqid"
 	"github.com/Farengier/smart-home/internal/signal"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
 
+const requestIDHeader = "X-Request-Id"
+
 type Config interface {
 	Addr() string
 	WriteTimeout() time.Duration
 	ReadTimeout() time.Duration
 }
 
-func Start(cfg Config) {
-	log.Info("[Web] Starting server")
+type server struct {
+	cfg    Config
+	router *mux.Router
+}
 
+func New(cfg Config) *server {
 	r := mux.NewRouter()
+	r.Use(requestID)
 	r.HandleFunc("/", testHandler)
 	r.HandleFunc("/products", testHandler)
 	r.HandleFunc("/articles", testHandler)
+	return &server{cfg: cfg, router: r}
+}
+
+// Router маршруты нужно добавлять до Start
+func (s *server) Router() *mux.Router {
+	return s.router
+}
+
+func (s *server) Start() {
+	log.Info("[Web] Starting server")
 
 	bctx, cncl := context.WithCancel(context.Background())
 	srv := &http.Server{
-		Handler:      r,
-		Addr:         cfg.Addr(),
-		WriteTimeout: cfg.WriteTimeout(),
-		ReadTimeout:  cfg.ReadTimeout(),
+		Handler:      s.router,
+		Addr:         s.cfg.Addr(),
+		WriteTimeout: s.cfg.WriteTimeout(),
+		ReadTimeout:  s.cfg.ReadTimeout(),
 		BaseContext: func(_ net.Listener) context.Context {
 			return bctx
 		},
@@ -50,6 +67,17 @@ func Start(cfg Config) {
 	signal.Run(func() { _ = srv.ListenAndServe() })
 }
 
+// requestID присваивает запросу идентификатор и возвращает его в заголовке ответа
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := reqid.New()
+		rw.Header().Set(requestIDHeader, id)
+		ctx := reqid.With(r.Context(), id)
+		log.WithContext(ctx).Debugf("[Web] %s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
 func testHandler(rw http.ResponseWriter, r *http.Request) {
 	_, _ = fmt.Fprintf(rw, "test handler ok")
 }